@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"firestore-rules/src/check"
+)
+
+// runCheck reports every problem found in each input. Warnings are printed but
+// do not change the exit status.
+func runCheck(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: firestore-rules check [files]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	return forEachInput(flags.Args(), func(name string, src []byte) int {
+		rules := parseInput(name, src)
+		if rules == nil {
+			return exitError
+		}
+		_, diags := check.Check(rules)
+		printErrors(name, diags)
+		if diags.HasErrors() {
+			return exitError
+		}
+		return exitOK
+	})
+}
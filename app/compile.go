@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"firestore-rules/src/compile"
+	"firestore-rules/src/format"
+)
+
+// runCompile translates each input into rules that Firestore accepts, writing
+// the result to standard output or to the file named by -o. Type declarations
+// become validation functions called from the allow statements of the match
+// blocks they describe.
+func runCompile(args []string) int {
+	flags := flag.NewFlagSet("compile", flag.ContinueOnError)
+	output := flags.String("o", "", "write the output to `file`")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: firestore-rules compile [-o file] [files]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *output != "" && flags.NArg() > 1 {
+		fmt.Fprintf(os.Stderr, "firestore-rules compile: -o needs a single input file\n")
+		return exitUsage
+	}
+	return forEachInput(flags.Args(), func(name string, src []byte) int {
+		rules := parseInput(name, src)
+		if rules == nil {
+			return exitError
+		}
+		diags := compile.Rules(rules)
+		printErrors(name, diags)
+		if diags.HasErrors() {
+			return exitError
+		}
+		out := format.Rules(rules)
+		if *output == "" {
+			fmt.Print(out)
+			return exitOK
+		}
+		if err := ioutil.WriteFile(*output, []byte(out), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		return exitOK
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"firestore-rules/src/eval"
+	"firestore-rules/src/parser"
+	"firestore-rules/src/store"
+)
+
+// lets collects the -let flags of eval in the order they were given.
+type lets []string
+
+func (l *lets) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *lets) Set(s string) error {
+	if !strings.Contains(s, "=") {
+		return fmt.Errorf("want name=expression, not %q", s)
+	}
+	*l = append(*l, s)
+	return nil
+}
+
+// runEval evaluates the expression given as its argument and prints the
+// result. Variables are set with -let, the functions declared at the top of
+// the service in the file named by -rules can be called, and get() and
+// exists() read the documents in the fixture file named by -docs.
+func runEval(args []string) int {
+	flags := flag.NewFlagSet("eval", flag.ContinueOnError)
+	rulesFile := flags.String("rules", "", "make the service-level functions of `file` callable")
+	docsFile := flags.String("docs", "", "read documents for get() and exists() from the JSON or YAML fixture `file`")
+	var bindings lets
+	flags.Var(&bindings, "let", "set a variable to the value of an expression, as `name=expr`; may be repeated")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: firestore-rules eval [-rules file] [-docs file] [-let name=expr]... expr\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	env := eval.NewEnv(nil)
+	env.Debug = func(v eval.Value) {
+		fmt.Fprintf(os.Stderr, "debug: %s\n", eval.Format(v))
+	}
+	if *docsFile != "" {
+		docs, err := store.LoadFile(*docsFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		env.SetStore(docs)
+	}
+	if *rulesFile != "" {
+		src, err := ioutil.ReadFile(*rulesFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		rules := parseInput(*rulesFile, src)
+		if rules == nil {
+			return exitError
+		}
+		if rules.Service != nil {
+			for _, stmt := range rules.Service.Statements {
+				if fd, ok := stmt.(*parser.FunctionDef); ok {
+					env.Define(fd)
+				}
+			}
+		}
+	}
+	for _, binding := range bindings {
+		k := strings.Index(binding, "=")
+		name := strings.TrimSpace(binding[:k])
+		v, ok := evalInput("-let "+name, binding[k+1:], env)
+		if !ok {
+			return exitError
+		}
+		env.Set(name, v)
+	}
+	v, ok := evalInput("<expr>", flags.Arg(0), env)
+	if !ok {
+		return exitError
+	}
+	fmt.Println(eval.Format(v))
+	return exitOK
+}
+
+// evalInput parses and evaluates src, printing any error against name.
+func evalInput(name, src string, env *eval.Env) (eval.Value, bool) {
+	tokens := parser.New(src)
+	e, err := parser.ParseExpr(tokens)
+	if err != nil {
+		printErrors(name, err)
+		return nil, false
+	}
+	if t := tokens.Peek(); t.Kind != parser.Eof {
+		printError(name, t.Start, fmt.Sprintf("unexpected %s after expression", t.Value))
+		return nil, false
+	}
+	v := eval.Eval(e, env)
+	if err, ok := v.(*eval.Error); ok {
+		printError(name, err.Node.Pos(), err.Msg)
+		return nil, false
+	}
+	return v, true
+}
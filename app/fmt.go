@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"firestore-rules/src/format"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// runFmt formats each named file, or standard input if there are none. By
+// default the result is written to standard output; -w rewrites the files in
+// place and -d prints a diff instead.
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write result to the source file instead of stdout")
+	diff := flags.Bool("d", false, "display diffs instead of rewriting files")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: firestore-rules fmt [-w] [-d] [files]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 && *write {
+		fmt.Fprintf(os.Stderr, "firestore-rules fmt: cannot use -w with standard input\n")
+		return exitUsage
+	}
+	return forEachInput(flags.Args(), func(name string, src []byte) int {
+		rules := parseInput(name, src)
+		if rules == nil {
+			return exitError
+		}
+		out := []byte(format.Rules(rules))
+		if *diff && !bytes.Equal(src, out) {
+			d, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				A:        difflib.SplitLines(string(src)),
+				B:        difflib.SplitLines(string(out)),
+				FromFile: name + ".orig",
+				ToFile:   name,
+				Context:  3,
+			})
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitError
+			}
+			fmt.Print(d)
+		}
+		if *write && !bytes.Equal(src, out) {
+			if err := ioutil.WriteFile(name, out, 0644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitError
+			}
+		}
+		if !*write && !*diff {
+			os.Stdout.Write(out)
+		}
+		return exitOK
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"firestore-rules/src/check"
+	"firestore-rules/src/parser"
+)
+
+// Exit codes shared by every command.
+const (
+	exitOK    = 0 // success
+	exitError = 1 // an input had errors, or a check or test failed
+	exitUsage = 2 // bad command line
+)
+
+const stdinName = "<stdin>"
+
+// forEachInput calls f with the name and contents of each file in names, or of
+// standard input if names is empty. It returns the largest status returned by
+// f, or exitError if a file cannot be read.
+func forEachInput(names []string, f func(name string, src []byte) int) int {
+	if len(names) == 0 {
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		return f(stdinName, src)
+	}
+	status := exitOK
+	for _, name := range names {
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = exitError
+			continue
+		}
+		if s := f(name, src); s > status {
+			status = s
+		}
+	}
+	return status
+}
+
+// parseInput parses src, printing any errors. The result is nil if there were
+// errors.
+func parseInput(name string, src []byte) *parser.Rules {
+	rules, err := parser.ParseRules(parser.New(string(src)))
+	if err != nil {
+		printErrors(name, err)
+		return nil
+	}
+	return rules
+}
+
+// printErrors prints each error in err on a line of its own in the
+// file:line:col: msg form understood by editors.
+func printErrors(name string, err error) {
+	switch err := err.(type) {
+	case parser.ErrorList:
+		for _, e := range err {
+			printError(name, e.StartPos, e.Msg)
+		}
+	case parser.ParseError:
+		printError(name, err.StartPos, err.Msg)
+	case check.Diagnostics:
+		for _, d := range err {
+			printDiagnostic(name, d)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+	}
+}
+
+func printDiagnostic(name string, d check.Diagnostic) {
+	if d.Severity == check.Warning {
+		printError(name, d.Start, "warning: "+d.Msg)
+		return
+	}
+	printError(name, d.Start, d.Msg)
+}
+
+func printError(name string, pos parser.InputPosition, msg string) {
+	fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", name, pos.Line+1, pos.Col+1, msg)
+}
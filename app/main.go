@@ -1,56 +1,63 @@
+// Command firestore-rules works with Firestore security rules files.
+//
+// Usage:
+//
+//	firestore-rules <command> [arguments]
+//
+// Every command reads the files named on the command line, or standard input
+// if there are none. Errors are printed as file:line:col: message. The exit
+// status is 0 on success, 1 if an input had errors or a check failed, and 2
+// if the command line was wrong.
 package main
 
-type Field struct {
-	name          string
-	typ           string
-	invariant     string
-	allowCreateIf string
-	allowUpdateIf string
-}
+import (
+	"fmt"
+	"os"
+)
 
-type Doc struct {
-	path          string
-	fields        []Field
-	allowCreateIf string
-	allowUpdateIf string
+type command struct {
+	name  string
+	short string
+	run   func(args []string) int
 }
 
-var issueDoc = Doc{
-	path: "/issues/{doc}",
-	fields: []Field{
-		{
-			name:          "id",
-			typ:           "string",
-			invariant:     "${value} == ${doc} && ${value}.size() == 10",
-			allowUpdateIf: "${value} == ${value.prev}",
-		},
-		{
-			name: "author",
-			typ:  "string",
-		},
-		{
-			name:          "created",
-			typ:           "timestamp",
-			allowCreateIf: "${created} =~ ${now}",
-			allowUpdateIf: "${created} == ${created.prev}",
-		},
-		{
-			name:          "modified",
-			typ:           "timestamp",
-			allowCreateIf: "${modified} == ${created}",
-			allowUpdateIf: "${modified} =~ request.time()",
-		},
-		{
-			name:          "title",
-			typ:           "string",
-			invariant:     "${title}.size() > 10 && ${title}.size() < 100",
-			allowUpdateIf: "${author} == request.auth.uid",
-		},
-	},
-	allowCreateIf: "request.auth.uid != null && request.resource.author == request.auth.uid",
-	allowUpdateIf: "request.auth.uid == request.resource.data.author",
+var commands []command
+
+func init() {
+	commands = []command{
+		{"parse", "check that rules files are syntactically valid", runParse},
+		{"check", "report problems in rules files", runCheck},
+		{"fmt", "reformat rules files in the canonical layout", runFmt},
+		{"compile", "compile rules files to plain Firestore rules", runCompile},
+		{"eval", "evaluate a rules expression", runEval},
+		{"test", "run rules test suites", runTest},
+		{"help", "print this message", runHelp},
+	}
 }
 
 func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			os.Exit(c.run(os.Args[2:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "firestore-rules: unknown command %q\n", os.Args[1])
+	usage()
+	os.Exit(exitUsage)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: firestore-rules <command> [arguments]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.short)
+	}
+}
 
+func runHelp(args []string) int {
+	usage()
+	return exitOK
 }
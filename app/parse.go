@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runParse parses each input and reports syntax errors. With -ast it also
+// prints the parsed rules fully parenthesized, which shows how operators were
+// grouped.
+func runParse(args []string) int {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	ast := flags.Bool("ast", false, "print the parsed rules")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: firestore-rules parse [-ast] [files]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	return forEachInput(flags.Args(), func(name string, src []byte) int {
+		rules := parseInput(name, src)
+		if rules == nil {
+			return exitError
+		}
+		if *ast {
+			fmt.Print(rules)
+		}
+		return exitOK
+	})
+}
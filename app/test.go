@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"firestore-rules/src/compile"
+	"firestore-rules/src/format"
+	"firestore-rules/src/suite"
+)
+
+// runTest runs the test suites named on the command line against their rules,
+// printing each case that fails with the traces of its decisions. Rules with
+// type declarations are compiled first, so that the validation generated from
+// the types is tested too. With -v passing cases are listed too, and -junit
+// writes the results as JUnit XML.
+func runTest(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	rulesFile := flags.String("rules", "", "test the rules in `file` instead of those named by each suite")
+	junitFile := flags.String("junit", "", "write the results as JUnit XML to `file`")
+	verbose := flags.Bool("v", false, "list every case, not only those that fail")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: firestore-rules test [-rules file] [-junit file] [-v] suites\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	status := exitOK
+	var reports []suite.Report
+	for _, name := range flags.Args() {
+		report, ok := runSuite(name, *rulesFile, *verbose)
+		if !ok {
+			status = exitError
+		}
+		if report != nil {
+			reports = append(reports, *report)
+		}
+	}
+	if *junitFile != "" {
+		f, err := os.Create(*junitFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		err = suite.WriteJUnit(f, reports)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	}
+	return status
+}
+
+// runSuite runs the suite in the named file and prints its results. The
+// report is nil if the suite or its rules could not be read.
+func runSuite(name, rulesFile string, verbose bool) (*suite.Report, bool) {
+	s, err := suite.LoadFile(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, false
+	}
+	if rulesFile != "" {
+		s.Rules = rulesFile
+	}
+	if s.Rules == "" {
+		fmt.Fprintf(os.Stderr, "%s: no rules file\n", name)
+		return nil, false
+	}
+	src, err := ioutil.ReadFile(s.Rules)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, false
+	}
+	rules := parseInput(s.Rules, src)
+	if rules == nil {
+		return nil, false
+	}
+	if compile.HasTypes(rules) {
+		// Test the validation generated from the types, tracing against the
+		// compiled source.
+		diags := compile.Rules(rules)
+		printErrors(s.Rules, diags)
+		if diags.HasErrors() {
+			return nil, false
+		}
+		src = []byte(format.Rules(rules))
+		if rules = parseInput(s.Rules+" (compiled)", src); rules == nil {
+			return nil, false
+		}
+	}
+
+	report := &suite.Report{Name: name, Results: suite.Run(rules, s), Source: string(src)}
+	failed := 0
+	for _, r := range report.Results {
+		switch {
+		case r.Err != nil:
+			failed++
+			fmt.Printf("--- ERROR: %s\n    %v\n", r.Name, r.Err)
+		case !r.Passed():
+			failed++
+			fmt.Printf("--- FAIL: %s\n", r.Name)
+			for _, f := range r.Failures {
+				fmt.Printf("    %s\n", f)
+			}
+			fmt.Print(indent(suite.Traces(r, report.Source), "    "))
+		case verbose:
+			fmt.Printf("--- PASS: %s\n", r.Name)
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("FAIL\t%s\t%d of %d cases failed\n", name, failed, len(report.Results))
+		return report, false
+	}
+	fmt.Printf("ok\t%s\t%d cases\n", name, len(report.Results))
+	return report, true
+}
+
+// indent prefixes each line of s with prefix.
+func indent(s, prefix string) string {
+	if s == "" {
+		return ""
+	}
+	return prefix + strings.Replace(strings.TrimSuffix(s, "\n"), "\n", "\n"+prefix, -1) + "\n"
+}
@@ -2,4 +2,8 @@ module firestore-rules
 
 go 1.14
 
-require github.com/stretchr/testify v1.6.1
+require (
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/stretchr/testify v1.6.1
+	gopkg.in/yaml.v3 v3.0.1
+)
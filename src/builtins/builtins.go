@@ -0,0 +1,202 @@
+// Package builtins is a catalog of the variables, functions, namespaces and
+// methods that the Firestore rules language provides. Each entry has its
+// parameter and result types and a short description, for use by the type
+// checker and by editor tools.
+package builtins
+
+import (
+	"sort"
+	"strings"
+
+	"firestore-rules/src/types"
+)
+
+// Var is a global variable such as request.
+type Var struct {
+	Name string
+	Type *types.Type
+	Doc  string
+}
+
+// Namespace is a global name such as math that only qualifies functions.
+type Namespace struct {
+	Name string
+	Doc  string
+}
+
+// Param is a parameter of a Func.
+type Param struct {
+	Name string
+	// Accepts lists the kinds of argument allowed. An empty list allows any
+	// value. A parameter that accepts float also accepts int.
+	Accepts []types.Kind
+}
+
+// Func is a global function, a function in a namespace, or a method.
+type Func struct {
+	Name string
+	// Namespace is the namespace of a function such as math.abs. It is empty
+	// for global functions and methods.
+	Namespace string
+	// Receiver is the kind of value a method is called on. It is
+	// types.Invalid for functions.
+	Receiver types.Kind
+	Params   []Param
+	Result   *types.Type
+	// Derive, if set, computes a more precise result type than Result from
+	// the types of the receiver and the arguments, for methods such as
+	// list.toSet() whose result depends on them. The receiver is nil for
+	// functions.
+	Derive func(recv *types.Type, args []*types.Type) *types.Type
+	Doc    string
+}
+
+// IsMethod reports whether f is called on a value.
+func (f *Func) IsMethod() bool {
+	return f.Receiver != types.Invalid
+}
+
+// QualifiedName is the name used to call f, with its namespace or receiver
+// kind, as in math.abs or string.size.
+func (f *Func) QualifiedName() string {
+	switch {
+	case f.Namespace != "":
+		return f.Namespace + "." + f.Name
+	case f.IsMethod():
+		return f.Receiver.String() + "." + f.Name
+	default:
+		return f.Name
+	}
+}
+
+// Signature returns f in the form math.pow(base float, exponent float) float.
+func (f *Func) Signature() string {
+	params := make([]string, len(f.Params))
+	for k, p := range f.Params {
+		params[k] = p.Name
+		if len(p.Accepts) > 0 {
+			kinds := make([]string, len(p.Accepts))
+			for j, kind := range p.Accepts {
+				kinds[j] = kind.String()
+			}
+			params[k] += " " + strings.Join(kinds, "|")
+		}
+	}
+	return f.QualifiedName() + "(" + strings.Join(params, ", ") + ") " + f.Result.String()
+}
+
+// ResultType returns the type of a call of f with the given receiver and
+// argument types.
+func (f *Func) ResultType(recv *types.Type, args []*types.Type) *types.Type {
+	if f.Derive != nil {
+		return f.Derive(recv, args)
+	}
+	return f.Result
+}
+
+// Accept reports whether an argument of type t may be passed for p.
+func (p Param) Accept(t *types.Type) bool {
+	if len(p.Accepts) == 0 || t.Unknown() {
+		return true
+	}
+	for _, kind := range p.Accepts {
+		if t.Kind == kind || kind == types.Float && t.Kind == types.Int {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	varsByName       = map[string]*Var{}
+	namespacesByName = map[string]*Namespace{}
+	globalsByName    = map[string]*Func{}
+	nsFuncs          = map[string]map[string]*Func{}
+	methodsByKind    = map[types.Kind]map[string]*Func{}
+)
+
+func init() {
+	for _, v := range vars {
+		varsByName[v.Name] = v
+	}
+	for _, ns := range namespaces {
+		namespacesByName[ns.Name] = ns
+		nsFuncs[ns.Name] = map[string]*Func{}
+	}
+	for _, f := range funcs {
+		switch {
+		case f.Namespace != "":
+			nsFuncs[f.Namespace][f.Name] = f
+		case f.IsMethod():
+			if methodsByKind[f.Receiver] == nil {
+				methodsByKind[f.Receiver] = map[string]*Func{}
+			}
+			methodsByKind[f.Receiver][f.Name] = f
+		default:
+			globalsByName[f.Name] = f
+		}
+	}
+}
+
+// LookupVar returns the global variable with the given name, or nil.
+func LookupVar(name string) *Var {
+	return varsByName[name]
+}
+
+// LookupNamespace returns the namespace with the given name, or nil.
+func LookupNamespace(name string) *Namespace {
+	return namespacesByName[name]
+}
+
+// LookupGlobal returns the global function with the given name, or nil.
+func LookupGlobal(name string) *Func {
+	return globalsByName[name]
+}
+
+// LookupFunc returns the function name in namespace ns, or nil.
+func LookupFunc(ns, name string) *Func {
+	return nsFuncs[ns][name]
+}
+
+// LookupMethod returns the method name of values of the given kind, or nil.
+func LookupMethod(recv types.Kind, name string) *Func {
+	return methodsByKind[recv][name]
+}
+
+// Vars returns every global variable, sorted by name.
+func Vars() []*Var {
+	result := append([]*Var(nil), vars...)
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Namespaces returns every namespace, sorted by name.
+func Namespaces() []*Namespace {
+	result := append([]*Namespace(nil), namespaces...)
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Globals returns every global function, sorted by name.
+func Globals() []*Func {
+	return sorted(globalsByName)
+}
+
+// Funcs returns the functions of namespace ns, sorted by name.
+func Funcs(ns string) []*Func {
+	return sorted(nsFuncs[ns])
+}
+
+// Methods returns the methods of values of the given kind, sorted by name.
+func Methods(recv types.Kind) []*Func {
+	return sorted(methodsByKind[recv])
+}
+
+func sorted(m map[string]*Func) []*Func {
+	result := make([]*Func, 0, len(m))
+	for _, f := range m {
+		result = append(result, f)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
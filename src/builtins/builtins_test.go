@@ -0,0 +1,69 @@
+package builtins
+
+import (
+	"testing"
+
+	"firestore-rules/src/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCatalog(t *testing.T) {
+	for _, f := range funcs {
+		assert.NotEmpty(t, f.Doc, f.QualifiedName())
+		assert.NotNil(t, f.Result, f.QualifiedName())
+		if f.Namespace != "" {
+			assert.NotNil(t, LookupNamespace(f.Namespace), f.QualifiedName())
+			assert.False(t, f.IsMethod(), f.QualifiedName())
+		}
+	}
+	for _, v := range vars {
+		assert.NotEmpty(t, v.Doc, v.Name)
+	}
+	for _, ns := range namespaces {
+		assert.NotEmpty(t, ns.Doc, ns.Name)
+		assert.NotEmpty(t, Funcs(ns.Name), ns.Name)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	assert.Equal(t, types.Request, LookupVar("request").Type)
+	assert.Nil(t, LookupVar("nope"))
+
+	assert.Equal(t, "math.abs", LookupFunc("math", "abs").QualifiedName())
+	assert.Nil(t, LookupFunc("math", "nope"))
+	assert.Nil(t, LookupFunc("nope", "abs"))
+
+	assert.Equal(t, "get", LookupGlobal("get").QualifiedName())
+	assert.Equal(t, "string.size", LookupMethod(types.String, "size").QualifiedName())
+	assert.Nil(t, LookupMethod(types.Bool, "size"))
+
+	names := []string{}
+	for _, f := range Methods(types.MapDiff) {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"addedKeys", "affectedKeys", "changedKeys", "removedKeys", "unchangedKeys"}, names)
+}
+
+func TestSignature(t *testing.T) {
+	assert.Equal(t, "math.pow(base float, exponent float) float", LookupFunc("math", "pow").Signature())
+	assert.Equal(t, "list.hasAll(values list|set) bool", LookupMethod(types.List, "hasAll").Signature())
+	assert.Equal(t, "debug(value) any", LookupGlobal("debug").Signature())
+}
+
+func TestResultType(t *testing.T) {
+	toSet := LookupMethod(types.List, "toSet")
+	assert.Equal(t, "set<string>", toSet.ResultType(types.ListOf(types.StringType), nil).String())
+	abs := LookupFunc("math", "abs")
+	assert.Equal(t, types.IntType, abs.ResultType(nil, []*types.Type{types.IntType}))
+	size := LookupMethod(types.String, "size")
+	assert.Equal(t, types.IntType, size.ResultType(types.StringType, nil))
+}
+
+func TestAccept(t *testing.T) {
+	p := param("value", floatK)
+	assert.True(t, p.Accept(types.IntType))
+	assert.True(t, p.Accept(types.FloatType))
+	assert.True(t, p.Accept(types.AnyType))
+	assert.False(t, p.Accept(types.StringType))
+	assert.True(t, param("value").Accept(types.StringType))
+}
@@ -0,0 +1,248 @@
+package builtins
+
+import "firestore-rules/src/types"
+
+// Kinds used in parameter lists.
+const (
+	boolK      = types.Bool
+	intK       = types.Int
+	floatK     = types.Float
+	stringK    = types.String
+	bytesK     = types.Bytes
+	pathK      = types.Path
+	timestampK = types.Timestamp
+	durationK  = types.Duration
+	latlngK    = types.LatLng
+	listK      = types.List
+	setK       = types.Set
+	mapK       = types.Map
+)
+
+func param(name string, accepts ...types.Kind) Param {
+	return Param{Name: name, Accepts: accepts}
+}
+
+func global(name string, result *types.Type, doc string, params ...Param) *Func {
+	return &Func{Name: name, Params: params, Result: result, Doc: doc}
+}
+
+func nsFunc(ns, name string, result *types.Type, doc string, params ...Param) *Func {
+	return &Func{Name: name, Namespace: ns, Params: params, Result: result, Doc: doc}
+}
+
+func method(recv types.Kind, name string, result *types.Type, doc string, params ...Param) *Func {
+	return &Func{Name: name, Receiver: recv, Params: params, Result: result, Doc: doc}
+}
+
+// derive sets the Derive function of f.
+func (f *Func) derive(d func(recv *types.Type, args []*types.Type) *types.Type) *Func {
+	f.Derive = d
+	return f
+}
+
+func elemOf(t *types.Type) *types.Type {
+	if t == nil || t.Elem == nil {
+		return types.AnyType
+	}
+	return t.Elem
+}
+
+func sameAsReceiver(recv *types.Type, args []*types.Type) *types.Type {
+	return recv
+}
+
+func sameAsArg(recv *types.Type, args []*types.Type) *types.Type {
+	if len(args) == 0 {
+		return types.AnyType
+	}
+	return args[0]
+}
+
+func setOfReceiverElems(recv *types.Type, args []*types.Type) *types.Type {
+	return types.SetOf(elemOf(recv))
+}
+
+func listOfReceiverElems(recv *types.Type, args []*types.Type) *types.Type {
+	return types.ListOf(elemOf(recv))
+}
+
+var vars = []*Var{
+	{"request", types.Request, "The incoming request: the authentication state, the method, the path, the query, the document being written and the time."},
+	{"resource", types.Resource, "The document as it is stored before the request, or null if it does not exist."},
+}
+
+var namespaces = []*Namespace{
+	{"duration", "Functions that create and manipulate durations."},
+	{"hashing", "Functions that compute hashes of strings and bytes."},
+	{"latlng", "Functions that create geographic points."},
+	{"math", "Mathematical functions."},
+	{"timestamp", "Functions that create timestamps."},
+}
+
+var setKeys = types.SetOf(types.StringType)
+
+var funcs = []*Func{
+	// Global functions.
+	global("debug", types.AnyType, "Logs its argument to the emulator log and returns it unchanged.",
+		param("value")).derive(sameAsArg),
+	global("exists", types.BoolType, "Reports whether a document exists at the given path.",
+		param("path", pathK)),
+	global("existsAfter", types.BoolType, "Reports whether a document would exist at the given path if the current request succeeded.",
+		param("path", pathK)),
+	global("float", types.FloatType, "Converts an int or a string to a float.",
+		param("value", intK, floatK, stringK)),
+	global("get", types.Resource, "Returns the document at the given path.",
+		param("path", pathK)),
+	global("getAfter", types.Resource, "Returns the document at the given path as it would be if the current request succeeded.",
+		param("path", pathK)),
+	global("int", types.IntType, "Converts a float or a string to an int.",
+		param("value", intK, floatK, stringK)),
+	global("path", types.PathType, "Converts a string to a path.",
+		param("value", stringK)),
+	global("string", types.StringType, "Converts a bool, int, float, null or path to a string.",
+		param("value", boolK, intK, floatK, stringK, types.Null, pathK)),
+
+	// duration
+	nsFunc("duration", "abs", types.DurType, "Returns the absolute value of a duration.",
+		param("duration", durationK)),
+	nsFunc("duration", "time", types.DurType, "Creates a duration from hours, minutes, seconds and nanoseconds.",
+		param("hours", intK), param("mins", intK), param("secs", intK), param("nanos", intK)),
+	nsFunc("duration", "value", types.DurType, "Creates a duration from a magnitude and a unit: w, d, h, m, s, ms or ns.",
+		param("magnitude", intK), param("unit", stringK)),
+
+	// hashing
+	nsFunc("hashing", "crc32", types.BytesType, "Returns the CRC32 hash of a string or bytes.",
+		param("value", stringK, bytesK)),
+	nsFunc("hashing", "crc32c", types.BytesType, "Returns the CRC32C hash of a string or bytes.",
+		param("value", stringK, bytesK)),
+	nsFunc("hashing", "md5", types.BytesType, "Returns the MD5 hash of a string or bytes.",
+		param("value", stringK, bytesK)),
+	nsFunc("hashing", "sha256", types.BytesType, "Returns the SHA-256 hash of a string or bytes.",
+		param("value", stringK, bytesK)),
+
+	// latlng
+	nsFunc("latlng", "value", types.LatLngType, "Creates a point from a latitude and a longitude in degrees.",
+		param("lat", floatK), param("lng", floatK)),
+
+	// math
+	nsFunc("math", "abs", types.FloatType, "Returns the absolute value of a number, as an int if the number is an int.",
+		param("value", floatK)).derive(sameAsArg),
+	nsFunc("math", "ceil", types.IntType, "Rounds a number up to an int.",
+		param("value", floatK)),
+	nsFunc("math", "floor", types.IntType, "Rounds a number down to an int.",
+		param("value", floatK)),
+	nsFunc("math", "isInfinite", types.BoolType, "Reports whether a number is positive or negative infinity.",
+		param("value", floatK)),
+	nsFunc("math", "isNaN", types.BoolType, "Reports whether a number is not a number.",
+		param("value", floatK)),
+	nsFunc("math", "pow", types.FloatType, "Raises base to the power exponent.",
+		param("base", floatK), param("exponent", floatK)),
+	nsFunc("math", "round", types.IntType, "Rounds a number to the nearest int, away from zero at halves.",
+		param("value", floatK)),
+	nsFunc("math", "sqrt", types.FloatType, "Returns the square root of a number.",
+		param("value", floatK)),
+
+	// timestamp
+	nsFunc("timestamp", "date", types.TimeType, "Creates a timestamp at midnight UTC on the given date.",
+		param("year", intK), param("month", intK), param("day", intK)),
+	nsFunc("timestamp", "value", types.TimeType, "Creates a timestamp from milliseconds since the Unix epoch.",
+		param("epochMillis", intK)),
+
+	// bytes
+	method(bytesK, "size", types.IntType, "Returns the number of bytes."),
+	method(bytesK, "toBase64", types.StringType, "Returns the bytes encoded in base 64."),
+	method(bytesK, "toHexString", types.StringType, "Returns the bytes encoded in hexadecimal."),
+
+	// duration
+	method(durationK, "nanos", types.IntType, "Returns the fractional seconds of the duration in nanoseconds."),
+	method(durationK, "seconds", types.IntType, "Returns the whole seconds of the duration."),
+
+	// latlng
+	method(latlngK, "distance", types.FloatType, "Returns the distance in meters to another point.",
+		param("other", latlngK)),
+	method(latlngK, "latitude", types.FloatType, "Returns the latitude in degrees."),
+	method(latlngK, "longitude", types.FloatType, "Returns the longitude in degrees."),
+
+	// list
+	method(listK, "concat", types.ListOf(types.AnyType), "Returns the list followed by the elements of another list.",
+		param("list", listK)).derive(func(recv *types.Type, args []*types.Type) *types.Type {
+		if len(args) == 1 && args[0].Kind == types.List {
+			return types.Unify(recv, args[0])
+		}
+		return recv
+	}),
+	method(listK, "hasAll", types.BoolType, "Reports whether the list contains every element of another list or set.",
+		param("values", listK, setK)),
+	method(listK, "hasAny", types.BoolType, "Reports whether the list contains any element of another list or set.",
+		param("values", listK, setK)),
+	method(listK, "hasOnly", types.BoolType, "Reports whether every element of the list is in another list or set.",
+		param("values", listK, setK)),
+	method(listK, "join", types.StringType, "Joins the elements of a list of strings with a separator.",
+		param("separator", stringK)),
+	method(listK, "removeAll", types.ListOf(types.AnyType), "Returns the list without the elements of another list.",
+		param("values", listK)).derive(sameAsReceiver),
+	method(listK, "size", types.IntType, "Returns the number of elements."),
+	method(listK, "toSet", types.SetOf(types.AnyType), "Returns a set of the elements of the list.").derive(setOfReceiverElems),
+
+	// map
+	method(mapK, "diff", types.MapDiffType, "Describes how the map differs from another map.",
+		param("other", mapK)),
+	method(mapK, "get", types.AnyType, "Returns the value at a key, or at a path of keys given as a list, or the default if there is none.",
+		param("key", stringK, listK), param("default")),
+	method(mapK, "keys", types.ListOf(types.StringType), "Returns the keys of the map."),
+	method(mapK, "size", types.IntType, "Returns the number of keys."),
+	method(mapK, "values", types.ListOf(types.AnyType), "Returns the values of the map.").derive(listOfReceiverElems),
+
+	// map_diff
+	method(types.MapDiff, "addedKeys", setKeys, "Returns the keys in the map but not in the other map."),
+	method(types.MapDiff, "affectedKeys", setKeys, "Returns the keys that were added, removed or changed."),
+	method(types.MapDiff, "changedKeys", setKeys, "Returns the keys in both maps whose values differ."),
+	method(types.MapDiff, "removedKeys", setKeys, "Returns the keys in the other map but not in the map."),
+	method(types.MapDiff, "unchangedKeys", setKeys, "Returns the keys in both maps whose values are equal."),
+
+	// path
+	method(pathK, "bind", types.PathType, "Replaces the wildcards of the path with the values in a map.",
+		param("bindings", mapK)),
+
+	// set
+	method(setK, "difference", types.SetOf(types.AnyType), "Returns the elements of the set that are not in another set.",
+		param("other", setK)).derive(sameAsReceiver),
+	method(setK, "hasAll", types.BoolType, "Reports whether the set contains every element of a list or set.",
+		param("values", listK, setK)),
+	method(setK, "hasAny", types.BoolType, "Reports whether the set contains any element of a list or set.",
+		param("values", listK, setK)),
+	method(setK, "hasOnly", types.BoolType, "Reports whether every element of the set is in a list or set.",
+		param("values", listK, setK)),
+	method(setK, "intersection", types.SetOf(types.AnyType), "Returns the elements that are in both sets.",
+		param("other", setK)).derive(sameAsReceiver),
+	method(setK, "size", types.IntType, "Returns the number of elements."),
+	method(setK, "union", types.SetOf(types.AnyType), "Returns the elements that are in either set.",
+		param("other", setK)).derive(sameAsReceiver),
+
+	// string
+	method(stringK, "lower", types.StringType, "Returns the string in lower case."),
+	method(stringK, "matches", types.BoolType, "Reports whether the whole string matches a regular expression.",
+		param("regex", stringK)),
+	method(stringK, "replace", types.StringType, "Replaces every match of a regular expression.",
+		param("regex", stringK), param("sub", stringK)),
+	method(stringK, "size", types.IntType, "Returns the number of characters."),
+	method(stringK, "split", types.ListOf(types.StringType), "Splits the string around matches of a regular expression.",
+		param("regex", stringK)),
+	method(stringK, "toUtf8", types.BytesType, "Returns the UTF-8 encoding of the string."),
+	method(stringK, "trim", types.StringType, "Returns the string without leading and trailing spaces."),
+	method(stringK, "upper", types.StringType, "Returns the string in upper case."),
+
+	// timestamp
+	method(timestampK, "date", types.TimeType, "Returns the timestamp truncated to midnight of its day."),
+	method(timestampK, "day", types.IntType, "Returns the day of the month, from 1."),
+	method(timestampK, "dayOfWeek", types.IntType, "Returns the day of the week, from 1 for Monday to 7 for Sunday."),
+	method(timestampK, "dayOfYear", types.IntType, "Returns the day of the year, from 1."),
+	method(timestampK, "hours", types.IntType, "Returns the hour of the day, from 0."),
+	method(timestampK, "minutes", types.IntType, "Returns the minute of the hour, from 0."),
+	method(timestampK, "month", types.IntType, "Returns the month of the year, from 1."),
+	method(timestampK, "nanos", types.IntType, "Returns the fractional seconds in nanoseconds."),
+	method(timestampK, "seconds", types.IntType, "Returns the second of the minute, from 0."),
+	method(timestampK, "time", types.DurType, "Returns the time since midnight as a duration."),
+	method(timestampK, "toMillis", types.IntType, "Returns the milliseconds since the Unix epoch."),
+	method(timestampK, "year", types.IntType, "Returns the year."),
+}
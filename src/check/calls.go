@@ -0,0 +1,153 @@
+package check
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"firestore-rules/src/parser"
+)
+
+// call is a call of a user function from the body of another function.
+type call struct {
+	callee *parser.FunctionDef
+	at     *parser.FunctionCall
+}
+
+type callChecker struct {
+	reporter
+	info *Info
+	// calls holds the calls made by the body of each function, in source
+	// order.
+	calls map[*parser.FunctionDef][]call
+	// order lists the functions in source order, so that cycles are found
+	// and reported in a predictable order.
+	order []*parser.FunctionDef
+}
+
+// CheckCalls records the function that each call of a user function refers to
+// in info.Calls, and reports calls with the wrong number of arguments and
+// functions that call themselves, directly or through other functions, which
+// Firestore does not allow. It needs the names resolved by Resolve.
+func CheckCalls(rules *parser.Rules, info *Info) Diagnostics {
+	info.Calls = map[*parser.FunctionCall]*parser.FunctionDef{}
+	c := &callChecker{info: info, calls: map[*parser.FunctionDef][]call{}}
+	if rules.Service != nil {
+		c.block(rules.Service.Statements)
+	}
+	c.cycles()
+	c.diags.sort()
+	return c.diags
+}
+
+func (c *callChecker) block(list []parser.Stmt) {
+	for _, stmt := range list {
+		switch stmt := stmt.(type) {
+		case *parser.MatchStmt:
+			c.block(stmt.Components)
+		case *parser.FunctionDef:
+			c.order = append(c.order, stmt)
+			for _, let := range stmt.Lets {
+				c.expr(stmt, let.Value)
+			}
+			c.expr(stmt, stmt.Return)
+		case *parser.AllowStmt:
+			c.expr(nil, stmt.Condition)
+		case *parser.TypeDecl:
+			for _, f := range stmt.Fields {
+				for _, fc := range f.Conditions {
+					c.expr(nil, fc.Cond)
+				}
+			}
+		}
+	}
+}
+
+// expr checks the calls in e, which is part of the body of caller or, if
+// caller is nil, of an allow condition.
+func (c *callChecker) expr(caller *parser.FunctionDef, e parser.Expr) {
+	if e == nil {
+		return
+	}
+	parser.Inspect(e, func(n parser.Node) bool {
+		fc, ok := n.(*parser.FunctionCall)
+		if !ok {
+			return true
+		}
+		id, ok := fc.Fn.(*parser.Id)
+		if !ok {
+			return true
+		}
+		d := c.info.Uses[id]
+		if d == nil || d.Kind != Function {
+			return true
+		}
+		fd := d.Node.(*parser.FunctionDef)
+		c.info.Calls[fc] = fd
+		if len(fc.Args) != len(fd.Params) {
+			c.errorf(fc, "%s arguments in call to %s: have %d, want %d (declared at %s)",
+				tooFewOrMany(len(fc.Args), len(fd.Params)), fd.Name.Value, len(fc.Args), len(fd.Params), fd.Name.Start)
+		}
+		if caller != nil {
+			c.calls[caller] = append(c.calls[caller], call{callee: fd, at: fc})
+		}
+		return true
+	})
+}
+
+// cycles reports each cycle in the call graph once, at the call that closes
+// it.
+func (c *callChecker) cycles() {
+	const (
+		unvisited = iota
+		active
+		done
+	)
+	state := map[*parser.FunctionDef]int{}
+	reported := map[string]bool{}
+	var stack []*parser.FunctionDef
+
+	var visit func(fd *parser.FunctionDef)
+	visit = func(fd *parser.FunctionDef) {
+		state[fd] = active
+		stack = append(stack, fd)
+		for _, call := range c.calls[fd] {
+			switch state[call.callee] {
+			case unvisited:
+				visit(call.callee)
+			case active:
+				c.cycle(stack, call, reported)
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[fd] = done
+	}
+	for _, fd := range c.order {
+		if state[fd] == unvisited {
+			visit(fd)
+		}
+	}
+}
+
+// cycle reports the cycle formed by call and the functions on the stack from
+// its callee onwards, unless the same set of functions was already reported.
+func (c *callChecker) cycle(stack []*parser.FunctionDef, call call, reported map[string]bool) {
+	start := len(stack) - 1
+	for stack[start] != call.callee {
+		start--
+	}
+	names := make([]string, 0, len(stack)-start+1)
+	positions := make([]int, 0, len(stack)-start)
+	for _, fd := range stack[start:] {
+		names = append(names, fd.Name.Value)
+		positions = append(positions, fd.Pos().Pos)
+	}
+	sort.Ints(positions)
+	key := fmt.Sprint(positions)
+	if reported[key] {
+		return
+	}
+	reported[key] = true
+	names = append(names, call.callee.Name.Value)
+	c.errorf(call.at, "recursive call %s is not allowed", strings.Join(names, " -> "))
+}
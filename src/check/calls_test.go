@@ -0,0 +1,93 @@
+package check
+
+import (
+	"testing"
+
+	"firestore-rules/src/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckCalls(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name: "arity",
+			input: `rules_version = '2';
+service cloud.firestore {
+  function owner(uid) { return request.auth.uid == uid; }
+  match /users/{uid} {
+    allow read: if owner(uid, 1) || owner() || owner(uid);
+  }
+}`,
+			expected: []string{
+				"5:20: too many arguments in call to owner: have 2, want 1 (declared at line 3 col 12)",
+				"5:37: not enough arguments in call to owner: have 0, want 1 (declared at line 3 col 12)",
+			},
+		},
+		{
+			name: "sibling",
+			input: `rules_version = '2';
+service cloud.firestore {
+  match /users/{uid} {
+    function owner() { return request.auth.uid == uid; }
+    match /posts/{post} {
+      allow read: if owner();
+    }
+  }
+  match /groups/{gid} {
+    allow read: if owner();
+  }
+}`,
+			expected: []string{
+				"10:20: undefined: owner (the function declared at line 4 col 14 is in a match block that does not enclose this one)",
+			},
+		},
+		{
+			name: "recursion",
+			input: `rules_version = '2';
+service cloud.firestore {
+  function a() { return b(); }
+  function b() { return c() && a(); }
+  function c() { return true; }
+  function d() { let x = d(); return x; }
+  match /x/{y} {
+    allow read: if a() && d();
+  }
+}`,
+			expected: []string{
+				"4:32: recursive call a -> b -> a is not allowed",
+				"6:26: recursive call d -> d is not allowed",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, diags := Check(parse(t, test.input))
+			assert.Equal(t, test.expected, messages(diags))
+		})
+	}
+}
+
+func TestCheckCallsInfo(t *testing.T) {
+	rules := parse(t, `rules_version = '2';
+service cloud.firestore {
+  function f() { return true; }
+  match /x/{y} {
+    function f() { return false; }
+    allow read: if f();
+  }
+}`)
+	info, _ := Check(rules)
+	var calls []*parser.FunctionCall
+	parser.Inspect(rules, func(n parser.Node) bool {
+		if fc, ok := n.(*parser.FunctionCall); ok {
+			calls = append(calls, fc)
+		}
+		return true
+	})
+	assert.Len(t, calls, 1)
+	assert.Equal(t, 5, info.Calls[calls[0]].Pos().Line+1)
+}
@@ -0,0 +1,84 @@
+// Package check finds problems in parsed rules that the grammar alone cannot
+// catch, such as names that refer to nothing.
+package check
+
+import (
+	"fmt"
+	"sort"
+
+	"firestore-rules/src/parser"
+)
+
+// Severity says whether a Diagnostic makes the rules invalid.
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (s Severity) String() string {
+	if s == Warning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic is a problem found in the source between Start and End.
+type Diagnostic struct {
+	Start    parser.InputPosition
+	End      parser.InputPosition
+	Severity Severity
+	Msg      string
+}
+
+func (d Diagnostic) Error() string {
+	if d.Severity == Warning {
+		return fmt.Sprintf("%s: warning: %s", d.Start, d.Msg)
+	}
+	return fmt.Sprintf("%s: %s", d.Start, d.Msg)
+}
+
+// Diagnostics is a list of problems ordered by position.
+type Diagnostics []Diagnostic
+
+func (list Diagnostics) Error() string {
+	switch len(list) {
+	case 0:
+		return "no errors"
+	case 1:
+		return list[0].Error()
+	default:
+		return fmt.Sprintf("%s (and %d more)", list[0], len(list)-1)
+	}
+}
+
+// HasErrors reports whether any diagnostic in the list is an Error rather than
+// a Warning.
+func (list Diagnostics) HasErrors() bool {
+	for _, d := range list {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+func (list Diagnostics) sort() {
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Start.Pos < list[j].Start.Pos
+	})
+}
+
+// reporter collects diagnostics.
+type reporter struct {
+	diags Diagnostics
+}
+
+func (r *reporter) errorf(n parser.Node, format string, args ...interface{}) {
+	r.diags = append(r.diags, Diagnostic{Start: n.Pos(), End: n.End(), Severity: Error, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (r *reporter) warnf(n parser.Node, format string, args ...interface{}) {
+	r.diags = append(r.diags, Diagnostic{Start: n.Pos(), End: n.End(), Severity: Warning, Msg: fmt.Sprintf(format, args...)})
+}
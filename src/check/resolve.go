@@ -0,0 +1,294 @@
+package check
+
+import (
+	"sort"
+
+	"firestore-rules/src/builtins"
+	"firestore-rules/src/parser"
+	"firestore-rules/src/types"
+)
+
+// DeclKind says what sort of thing a name refers to.
+type DeclKind int
+
+const (
+	Builtin  DeclKind = iota // a global provided by Firestore, such as request
+	Wildcard                 // a wildcard captured by a match path
+	Function                 // a user function
+	Param                    // a function parameter
+	Let                      // a let binding in a function body
+)
+
+func (k DeclKind) String() string {
+	switch k {
+	case Builtin:
+		return "built-in"
+	case Wildcard:
+		return "wildcard"
+	case Function:
+		return "function"
+	case Param:
+		return "parameter"
+	case Let:
+		return "let"
+	default:
+		return "unknown"
+	}
+}
+
+// Decl is the declaration of a name.
+type Decl struct {
+	Kind DeclKind
+	Name string
+	// Node declares the name: a *parser.FunctionDef, parser.Param,
+	// *parser.LetDef or parser.Component. It is nil for built-ins.
+	Node parser.Node
+	// Ident is the token that spells the name in the declaration. It is the
+	// zero Token for built-ins.
+	Ident parser.Token
+}
+
+// Info records what the resolver learned about a rules file.
+type Info struct {
+	// Uses maps each identifier that names a declaration to that declaration.
+	// The field names after a '.' are not identifiers in this sense and are
+	// not included.
+	Uses map[*parser.Id]*Decl
+	// Decls lists every user declaration in source order.
+	Decls []*Decl
+	// Types maps each expression to its type. It is filled in by TypeCheck.
+	Types map[parser.Expr]*types.Type
+	// Calls maps each call of a user function to the function. It is filled
+	// in by CheckCalls.
+	Calls map[*parser.FunctionCall]*parser.FunctionDef
+	// TypeRefs maps each use of a declared type in a field declaration to
+	// the declaration. Uses of primitive types such as string are not
+	// included.
+	TypeRefs map[*parser.TypeRef]*parser.TypeDecl
+	// DocTypes maps each match block whose documents have a declared type to
+	// the declaration.
+	DocTypes map[*parser.MatchStmt]*parser.TypeDecl
+	// Placeholders maps each placeholder in a field condition that stands
+	// for the value of a field to the field's declaration. ${doc} and ${now}
+	// are not included.
+	Placeholders map[*parser.Placeholder]*parser.FieldDecl
+}
+
+// universe holds the names that Firestore provides everywhere: the variables,
+// global functions and namespaces of the builtins catalog, and the names of
+// types, which are used with 'is' and some of which are also conversion
+// functions or namespaces.
+var universe = newUniverse()
+
+func newUniverse() *scope {
+	s := newScope(nil)
+	add := func(name string) {
+		s.names[name] = &Decl{Kind: Builtin, Name: name}
+	}
+	for _, v := range builtins.Vars() {
+		add(v.Name)
+	}
+	for _, f := range builtins.Globals() {
+		add(f.Name)
+	}
+	for _, ns := range builtins.Namespaces() {
+		add(ns.Name)
+	}
+	for _, name := range types.TypeNames() {
+		add(name)
+	}
+	return s
+}
+
+type scope struct {
+	parent *scope
+	names  map[string]*Decl
+	// types holds the type declarations of the block. Type names are apart
+	// from other names, so a type and a function may have the same name.
+	types map[string]*parser.TypeDecl
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{parent: parent, names: map[string]*Decl{}, types: map[string]*parser.TypeDecl{}}
+}
+
+func (s *scope) lookup(name string) *Decl {
+	for ; s != nil; s = s.parent {
+		if d, ok := s.names[name]; ok {
+			return d
+		}
+	}
+	return nil
+}
+
+type resolver struct {
+	reporter
+	info *Info
+	// functions holds every function in the file by name, to explain why a
+	// function declared in another match block cannot be called.
+	functions map[string][]*parser.FunctionDef
+	// typeDecls lists the type declarations in the order they were resolved.
+	typeDecls []*parser.TypeDecl
+	// cond is the field condition being resolved, or nil outside field
+	// conditions.
+	cond *fieldCond
+}
+
+// Resolve links every identifier in rules to its declaration. It reports names
+// that are not declared anywhere, names declared twice in the same block, and
+// declarations that hide one in an enclosing block.
+//
+// Functions are visible throughout the block that defines them, including in
+// nested match blocks, so they can be called before they are defined.
+// Wildcards are visible in the match block that captures them. Parameters
+// are visible in the function body, and a let binding from the statement after
+// it to the end of the body.
+//
+// Declared types are visible like functions, and their fields are checked:
+// a field's type is a primitive type, one of the names used with 'is' except
+// set, or a declared type; only list and map take an element type, as in
+// list<string>; only string, bytes, list and map take a size, as in
+// string<100>; and no type may contain itself. The conditions of a field are
+// resolved in the block of the type, and their placeholders must name the
+// field itself, another field of the type, the document or the time. A type
+// that is the element type of a list or map may not have modifiers or
+// allowCreateIf or allowUpdateIf conditions, even in the maps it holds, since
+// they cannot be checked for each element. A readonly field must be optional and have no other modifiers, a
+// serverTimestamp field must be a timestamp and an authorUid field a string.
+// A match block names the type of its documents after 'is', as in
+// match /issues/{id} is Issue; declaring a type in a block does not give its
+// documents that type, and a type that no block names and no field has gets
+// a warning.
+func Resolve(rules *parser.Rules) (*Info, Diagnostics) {
+	r := &resolver{
+		info: &Info{
+			Uses:         map[*parser.Id]*Decl{},
+			TypeRefs:     map[*parser.TypeRef]*parser.TypeDecl{},
+			DocTypes:     map[*parser.MatchStmt]*parser.TypeDecl{},
+			Placeholders: map[*parser.Placeholder]*parser.FieldDecl{},
+		},
+		functions: map[string][]*parser.FunctionDef{},
+	}
+	if rules.Service != nil {
+		parser.Inspect(rules.Service, func(n parser.Node) bool {
+			if fd, ok := n.(*parser.FunctionDef); ok {
+				r.functions[fd.Name.Value] = append(r.functions[fd.Name.Value], fd)
+				return false
+			}
+			return true
+		})
+		r.block(newScope(universe), rules.Service.Statements)
+		r.typeCycles()
+		r.elementTypes()
+		r.unusedTypes()
+	}
+	sort.SliceStable(r.info.Decls, func(i, j int) bool {
+		return r.info.Decls[i].Ident.Start.Pos < r.info.Decls[j].Ident.Start.Pos
+	})
+	r.diags.sort()
+	return r.info, r.diags
+}
+
+// block resolves a list of statements in scope s, which already holds any
+// wildcards.
+func (r *resolver) block(s *scope, list []parser.Stmt) {
+	for _, stmt := range list {
+		switch stmt := stmt.(type) {
+		case *parser.FunctionDef:
+			r.declare(s, &Decl{Kind: Function, Name: stmt.Name.Value, Node: stmt, Ident: stmt.Name})
+		case *parser.TypeDecl:
+			r.declareType(s, stmt)
+		}
+	}
+	for _, stmt := range list {
+		switch stmt := stmt.(type) {
+		case *parser.MatchStmt:
+			inner := newScope(s)
+			for _, c := range stmt.Path {
+				if c.Wildcard {
+					r.declare(inner, &Decl{Kind: Wildcard, Name: c.Literal.Value, Node: c, Ident: c.Literal})
+				}
+			}
+			r.block(inner, stmt.Components)
+			r.docType(inner, stmt)
+		case *parser.FunctionDef:
+			r.function(s, stmt)
+		case *parser.AllowStmt:
+			r.expr(s, stmt.Condition)
+		case *parser.TypeDecl:
+			r.typeDecl(s, stmt)
+		}
+	}
+}
+
+func (r *resolver) function(outer *scope, fd *parser.FunctionDef) {
+	s := newScope(outer)
+	for _, p := range fd.Params {
+		r.declare(s, &Decl{Kind: Param, Name: p.Name.Value, Node: p, Ident: p.Name})
+	}
+	for _, let := range fd.Lets {
+		r.expr(s, let.Value)
+		r.declare(s, &Decl{Kind: Let, Name: let.Name.Value, Node: let, Ident: let.Name})
+	}
+	r.expr(s, fd.Return)
+}
+
+// declare adds d to s, reporting a clash with a declaration in s itself or
+// in an enclosing scope.
+func (r *resolver) declare(s *scope, d *Decl) {
+	r.info.Decls = append(r.info.Decls, d)
+	at := tokenSpan(d.Ident)
+	if prev, ok := s.names[d.Name]; ok {
+		r.errorf(at, "%s redeclared in this block (previous declaration at %s)", d.Name, prev.Ident.Start)
+		return
+	}
+	if prev := s.parent.lookup(d.Name); prev != nil {
+		if prev.Kind == Builtin {
+			r.warnf(at, "%s %s shadows the built-in %s", d.Kind, d.Name, d.Name)
+		} else {
+			r.warnf(at, "%s %s shadows %s declared at %s", d.Kind, d.Name, prev.Kind, prev.Ident.Start)
+		}
+	}
+	s.names[d.Name] = d
+}
+
+// expr resolves the identifiers in e. The name after a '.' is a field or
+// method name rather than an identifier, so it is skipped.
+func (r *resolver) expr(s *scope, e parser.Expr) {
+	if e == nil {
+		return
+	}
+	parser.Inspect(e, func(n parser.Node) bool {
+		switch n := n.(type) {
+		case *parser.BinaryExpr:
+			if n.Op.Kind == parser.Dot {
+				r.expr(s, n.Lhs)
+				return false
+			}
+		case *parser.Placeholder:
+			r.placeholder(n)
+		case *parser.Id:
+			if d := s.lookup(n.Name.Value); d != nil {
+				r.info.Uses[n] = d
+			} else if fds := r.functions[n.Name.Value]; len(fds) > 0 {
+				r.errorf(n, "undefined: %s (the function declared at %s is in a match block that does not enclose this one)",
+					n.Name.Value, fds[0].Name.Start)
+			} else {
+				r.errorf(n, "undefined: %s", n.Name.Value)
+			}
+		}
+		return true
+	})
+}
+
+// span is the extent of a token, for reporting diagnostics about it.
+type span struct {
+	start, end parser.InputPosition
+}
+
+func tokenSpan(t parser.Token) span {
+	return span{t.Start, t.End}
+}
+
+func (s span) Pos() parser.InputPosition { return s.start }
+func (s span) End() parser.InputPosition { return s.end }
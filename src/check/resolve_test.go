@@ -0,0 +1,360 @@
+package check
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"firestore-rules/src/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func parse(t *testing.T, input string) *parser.Rules {
+	rules, err := parser.ParseRules(parser.New(input))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return rules
+}
+
+// messages returns each diagnostic as "line:col: [warning: ]msg".
+func messages(diags Diagnostics) []string {
+	result := make([]string, len(diags))
+	for k, d := range diags {
+		prefix := ""
+		if d.Severity == Warning {
+			prefix = "warning: "
+		}
+		result[k] = fmt.Sprintf("%d:%d: %s%s", d.Start.Line+1, d.Start.Col+1, prefix, d.Msg)
+	}
+	return result
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name: "ok",
+			input: `rules_version = '2';
+service cloud.firestore {
+  function signedIn() { return request.auth != null; }
+  match /users/{uid} {
+    allow read: if signedIn() && owner(uid);
+    function owner(id) {
+      let me = request.auth.uid;
+      return me == id && resource.data.owner == me;
+    }
+    match /posts/{post} {
+      allow write: if owner(uid) && post.size() < 10;
+    }
+  }
+}`,
+		},
+		{
+			name: "undefined",
+			input: `rules_version = '2';
+service cloud.firestore {
+  match /users/{uid} {
+    allow read: if owner() && foo.bar == user;
+  }
+  match /other/{doc} {
+    allow read: if uid == doc;
+  }
+}`,
+			expected: []string{
+				"4:20: undefined: owner",
+				"4:31: undefined: foo",
+				"4:42: undefined: user",
+				"7:20: undefined: uid",
+			},
+		},
+		{
+			name: "let order",
+			input: `rules_version = '2';
+service cloud.firestore {
+  function f() {
+    let a = b;
+    let b = a;
+    return a;
+  }
+}`,
+			expected: []string{"4:13: undefined: b"},
+		},
+		{
+			name: "duplicates",
+			input: `rules_version = '2';
+service cloud.firestore {
+  function f(x, x) {
+    let y = 1;
+    let y = 2;
+    return y;
+  }
+  function f() { return true; }
+  match /a/{id}/b/{id} {}
+}`,
+			expected: []string{
+				"3:17: x redeclared in this block (previous declaration at line 3 col 14)",
+				"5:9: y redeclared in this block (previous declaration at line 4 col 9)",
+				"8:12: f redeclared in this block (previous declaration at line 3 col 12)",
+				"9:20: id redeclared in this block (previous declaration at line 9 col 13)",
+			},
+		},
+		{
+			name: "shadowing",
+			input: `rules_version = '2';
+service cloud.firestore {
+  function owner() { return true; }
+  match /users/{uid} {
+    function owner(uid) {
+      let request = uid;
+      return request;
+    }
+    match /x/{uid} {}
+  }
+}`,
+			expected: []string{
+				"5:14: warning: function owner shadows function declared at line 3 col 12",
+				"5:20: warning: parameter uid shadows wildcard declared at line 4 col 17",
+				"6:11: warning: let request shadows the built-in request",
+				"9:15: warning: wildcard uid shadows wildcard declared at line 4 col 17",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, diags := Resolve(parse(t, test.input))
+			if test.expected == nil {
+				assert.Empty(t, diags)
+			} else {
+				assert.Equal(t, test.expected, messages(diags))
+			}
+		})
+	}
+}
+
+func TestResolveUses(t *testing.T) {
+	rules := parse(t, `rules_version = '2';
+service cloud.firestore {
+  match /users/{uid} {
+    function owner(id) { let me = request.auth.uid; return me == id; }
+    allow read: if owner(uid);
+  }
+}`)
+	info, diags := Resolve(rules)
+	assert.Empty(t, diags)
+
+	uses := map[string]DeclKind{}
+	parser.Inspect(rules, func(n parser.Node) bool {
+		if id, ok := n.(*parser.Id); ok {
+			if d, ok := info.Uses[id]; ok {
+				uses[id.Name.Value] = d.Kind
+			}
+		}
+		return true
+	})
+	assert.Equal(t, map[string]DeclKind{
+		"request": Builtin,
+		"me":      Let,
+		"id":      Param,
+		"owner":   Function,
+		"uid":     Wildcard,
+	}, uses)
+
+	names := make([]string, len(info.Decls))
+	for k, d := range info.Decls {
+		names[k] = d.Name
+	}
+	assert.Equal(t, []string{"uid", "owner", "id", "me"}, names)
+}
+
+func TestResolveFile(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/firestore.rules")
+	assert.Nil(t, err)
+	_, diags := Resolve(parse(t, string(src)))
+	assert.Empty(t, diags)
+}
+
+func TestResolveTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name: "ok",
+			input: `rules_version = '2';
+service cloud.firestore {
+  type Address { city: string<50>; }
+  match /users/{uid} is User {
+    type User {
+      name: string;
+      tags?: list<string, 10>;
+      homes: map<Address>;
+      home: Address;
+    }
+  }
+}`,
+		},
+		{
+			name: "errors",
+			input: `rules_version = '2';
+service cloud.firestore {
+  type A { a: int; a: Missing; }
+  type A { b: int<3>; c: string<0>; d: string<int>; }
+  type string {}
+  match /x/{y} {
+    type B { b: C; }
+    type C { c: list<B>; }
+  }
+}`,
+			expected: []string{
+				"3:8: warning: type A declared but not used (no match block names it after 'is' and no field has it)",
+				"3:20: field a redeclared in type A (previous declaration at line 3 col 12)",
+				"3:23: undefined type: Missing",
+				"4:8: type A redeclared in this block (previous declaration at line 3 col 8)",
+				"4:19: int has no size",
+				"4:33: size 0 must be a positive int",
+				"4:47: string has no element type",
+				"5:8: type string has the name of a built-in type",
+				"8:22: type B contains itself: B -> C -> B",
+			},
+		},
+		{
+			name: "document types",
+			input: `rules_version = '2';
+service cloud.firestore {
+  type User { name: string; }
+  match /users/{uid} is User {
+    type A { a: int; }
+    type B { b: int; }
+    match /posts/{post} is Post {
+      type Post { title: string; }
+    }
+  }
+  match /x/{y} is Nope {}
+  match /z/{w} is A {}
+}`,
+			expected: []string{
+				"5:10: warning: type A declared but not used (no match block names it after 'is' and no field has it)",
+				"6:10: warning: type B declared but not used (no match block names it after 'is' and no field has it)",
+				"11:19: undefined type: Nope",
+				"12:19: undefined type: A",
+			},
+		},
+		{
+			name: "conditions",
+			input: `rules_version = '2';
+service cloud.firestore {
+  function long(s) { return s.size() > 10; }
+  match /issues/{id} is Issue {
+    type Issue {
+      id: string {
+        invariant: ${value} == ${doc} && ${value} == id;
+        allowUpdateIf: ${value} == ${value.prev};
+      }
+      title: string {
+        invariant: long(${value}) && ${nope};
+        invariant: ${value.prev} != '';
+        allowCreateIf: ${now.prev} != null && ${created.prev} == ${now} && missing;
+      }
+    }
+    allow read: if ${value};
+  }
+}`,
+			expected: []string{
+				"11:38: ${nope}: type Issue has no field nope",
+				"12:9: invariant redeclared in field title (previous declaration at line 11 col 9)",
+				"12:20: ${value.prev} is only allowed in allowUpdateIf, since there is no previous value in invariant",
+				"13:24: ${now.prev} has no previous value",
+				"13:47: ${created.prev}: type Issue has no field created",
+				"13:76: undefined: missing",
+				"16:20: ${value} outside the conditions of a field",
+			},
+		},
+		{
+			name: "element types",
+			input: `rules_version = '2';
+service cloud.firestore {
+  type Address { city: string { allowCreateIf: ${value} == 'x'; } }
+  type Home { address: Address; }
+  type Tag { name: string { invariant: ${value}.size() > 0; } }
+  match /users/{uid} is User {
+    type User {
+      homes: list<Home>;
+      addresses: map<Address>;
+      tags: list<Tag>;
+    }
+  }
+}`,
+			expected: []string{
+				"8:19: type Home cannot be the element type of list: field city of type Address has allowCreateIf, which cannot be checked for each element",
+				"9:22: type Address cannot be the element type of map: field city of type Address has allowCreateIf, which cannot be checked for each element",
+			},
+		},
+		{
+			name: "element types with modifiers",
+			input: `rules_version = '2';
+service cloud.firestore {
+  type Stamp { readonly at?: timestamp; }
+  match /logs/{id} is Log {
+    type Log { stamps: list<Stamp>; }
+  }
+}`,
+			expected: []string{
+				"5:29: type Stamp cannot be the element type of list: field at of type Stamp has modifier readonly, which cannot be checked for each element",
+			},
+		},
+		{
+			name: "unused types",
+			input: `rules_version = '2';
+service cloud.firestore {
+  type Address { city: string; }
+  match /a/{b} {
+    type A { home: Address; }
+    type B { b: int; }
+    allow create: if true;
+  }
+}`,
+			expected: []string{
+				"5:10: warning: type A declared but not used (no match block names it after 'is' and no field has it)",
+				"6:10: warning: type B declared but not used (no match block names it after 'is' and no field has it)",
+			},
+		},
+		{
+			name: "modifiers",
+			input: `rules_version = '2';
+service cloud.firestore {
+  type Post {
+    immutable serverTimestamp created: timestamp;
+    readonly votes?: int;
+    immutable authorUid author: string;
+    readonly count: int;
+    readonly immutable flag?: bool;
+    serverTimestamp modified: string;
+    authorUid authorUid editor?: int;
+  }
+  match /posts/{post} is Post {}
+}`,
+			expected: []string{
+				"7:5: readonly field count must be optional, since a create cannot set it",
+				"8:14: field flag is readonly, so it cannot also be immutable",
+				"9:31: serverTimestamp field modified has type string, want timestamp",
+				"10:15: modifier authorUid repeated",
+				"10:34: authorUid field editor has type int, want string",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, diags := Resolve(parse(t, test.input))
+			if test.expected == nil {
+				assert.Empty(t, diags)
+			} else {
+				assert.Equal(t, test.expected, messages(diags))
+			}
+		})
+	}
+}
@@ -0,0 +1,601 @@
+package check
+
+import (
+	"firestore-rules/src/builtins"
+	"firestore-rules/src/format"
+	"firestore-rules/src/parser"
+	"firestore-rules/src/types"
+)
+
+// Check resolves the names in rules, checks the types of every expression and
+// checks the calls of user functions. The returned Info holds the results of
+// all the passes.
+func Check(rules *parser.Rules) (*Info, Diagnostics) {
+	info, diags := Resolve(rules)
+	diags = append(diags, TypeCheck(rules, info)...)
+	diags = append(diags, CheckCalls(rules, info)...)
+	diags.sort()
+	return info, diags
+}
+
+type typer struct {
+	reporter
+	info *Info
+	// results holds the result type of each user function once known.
+	results map[*parser.FunctionDef]*types.Type
+	// busy holds the functions whose result type is being computed, so that
+	// recursion does not loop forever.
+	busy map[*parser.FunctionDef]bool
+	// doc is the type of the documents of the match block being checked, or
+	// nil if they have no declared type.
+	doc *types.Type
+	// docs holds the document type of the block that defines each function.
+	docs map[*parser.FunctionDef]*types.Type
+	// declared holds the type of the data described by each type
+	// declaration.
+	declared map[*parser.TypeDecl]*types.Type
+}
+
+// TypeCheck computes the type of every expression in rules, recording them in
+// info.Types, and reports operations that can only fail. It needs the names
+// resolved by Resolve.
+//
+// Values that cannot be known statically, such as the fields of
+// request.resource.data and the parameters of functions, have type any and
+// are accepted everywhere. In a match block whose documents have a declared
+// type, resource.data and request.resource.data have that type, so their
+// fields have the declared types and other fields are errors.
+func TypeCheck(rules *parser.Rules, info *Info) Diagnostics {
+	info.Types = map[parser.Expr]*types.Type{}
+	t := &typer{
+		info:     info,
+		results:  map[*parser.FunctionDef]*types.Type{},
+		busy:     map[*parser.FunctionDef]bool{},
+		docs:     map[*parser.FunctionDef]*types.Type{},
+		declared: map[*parser.TypeDecl]*types.Type{},
+	}
+	if rules.Service != nil {
+		t.block(rules.Service.Statements)
+	}
+	t.diags.sort()
+	return t.diags
+}
+
+func (t *typer) block(list []parser.Stmt) {
+	for _, stmt := range list {
+		if fd, ok := stmt.(*parser.FunctionDef); ok {
+			t.docs[fd] = t.doc
+		}
+	}
+	for _, stmt := range list {
+		switch stmt := stmt.(type) {
+		case *parser.MatchStmt:
+			outer := t.doc
+			t.doc = nil
+			if td := t.info.DocTypes[stmt]; td != nil {
+				t.doc = types.DocumentOf(t.typeDecl(td))
+			}
+			t.block(stmt.Components)
+			t.doc = outer
+		case *parser.FunctionDef:
+			t.function(stmt)
+		case *parser.AllowStmt:
+			if stmt.Condition != nil {
+				t.want(stmt.Condition, types.Bool, "condition")
+			}
+		case *parser.TypeDecl:
+			for _, f := range stmt.Fields {
+				for _, fc := range f.Conditions {
+					t.want(fc.Cond, types.Bool, fc.Name.Value)
+				}
+			}
+		}
+	}
+}
+
+// function returns the result type of fd, checking its body the first time
+// it is asked for.
+func (t *typer) function(fd *parser.FunctionDef) *types.Type {
+	if result, ok := t.results[fd]; ok {
+		return result
+	}
+	if t.busy[fd] || fd.Return == nil {
+		return types.AnyType
+	}
+	t.busy[fd] = true
+	outer := t.doc
+	t.doc = t.docs[fd]
+	for _, let := range fd.Lets {
+		t.expr(let.Value)
+	}
+	result := t.expr(fd.Return)
+	t.doc = outer
+	delete(t.busy, fd)
+	t.results[fd] = result
+	return result
+}
+
+// want checks that e has the given kind.
+func (t *typer) want(e parser.Expr, kind types.Kind, what string) *types.Type {
+	typ := t.expr(e)
+	if !typ.Unknown() && typ.Kind != kind {
+		t.errorf(e, "%s %s has type %s, want %s", what, format.Expr(e), typ, kind)
+		return types.InvalidType
+	}
+	return typ
+}
+
+// expr returns the type of e and records it in info.Types.
+func (t *typer) expr(e parser.Expr) *types.Type {
+	typ := t.exprType(e)
+	t.info.Types[e] = typ
+	return typ
+}
+
+func (t *typer) exprType(e parser.Expr) *types.Type {
+	switch e := e.(type) {
+	case *parser.Literal:
+		return literalType(e.Value.Kind)
+	case *parser.Id:
+		return t.id(e)
+	case *parser.UnaryExpr:
+		return t.unary(e)
+	case *parser.BinaryExpr:
+		return t.binary(e)
+	case *parser.TernaryExpr:
+		t.want(e.Cond, types.Bool, "condition")
+		return types.Unify(t.value(e.True), t.value(e.False))
+	case *parser.FunctionCall:
+		return t.call(e)
+	case *parser.ArrayLiteral:
+		elem := types.InvalidType
+		for _, x := range e.Elements {
+			elem = types.Unify(elem, t.value(x))
+		}
+		if elem.Kind == types.Invalid {
+			elem = types.AnyType
+		}
+		return types.ListOf(elem)
+	case *parser.MapLiteral:
+		return t.mapLiteral(e)
+	case *parser.PathExpr:
+		for _, s := range e.Segments {
+			if s.Expr != nil {
+				t.value(s.Expr)
+			}
+		}
+		return types.PathType
+	case *parser.Placeholder:
+		return t.placeholder(e)
+	default:
+		return types.AnyType
+	}
+}
+
+func literalType(kind parser.Kind) *types.Type {
+	switch kind {
+	case parser.IntLiteral:
+		return types.IntType
+	case parser.FloatLiteral:
+		return types.FloatType
+	case parser.StringLiteral:
+		return types.StringType
+	case parser.Bytes:
+		return types.BytesType
+	case parser.True, parser.False:
+		return types.BoolType
+	case parser.Null:
+		return types.NullType
+	default:
+		return types.AnyType
+	}
+}
+
+func (t *typer) id(e *parser.Id) *types.Type {
+	d := t.info.Uses[e]
+	if d == nil {
+		return types.InvalidType // reported by Resolve
+	}
+	switch d.Kind {
+	case Builtin:
+		if t.doc != nil {
+			switch d.Name {
+			case "resource":
+				return t.doc
+			case "request":
+				return types.RequestOf(t.doc)
+			}
+		}
+		return builtinType(d.Name)
+	case Wildcard:
+		if d.Node.(parser.Component).Recursive {
+			return types.PathType
+		}
+		return types.StringType
+	case Function:
+		return types.FunctionOf(d.Name)
+	case Let:
+		if typ, ok := t.info.Types[d.Node.(*parser.LetDef).Value]; ok {
+			return typ
+		}
+		return types.AnyType
+	default:
+		return types.AnyType
+	}
+}
+
+// typeDecl returns the type of the data described by td: a map with just
+// the declared fields.
+func (t *typer) typeDecl(td *parser.TypeDecl) *types.Type {
+	if typ, ok := t.declared[td]; ok {
+		return typ
+	}
+	fields := map[string]*types.Type{}
+	typ := types.Record(fields)
+	t.declared[td] = typ
+	for _, f := range td.Fields {
+		fields[f.Name.Value] = t.typeRef(f.Type)
+	}
+	return typ
+}
+
+// typeRef returns the type of the values of a field declared with type tr.
+func (t *typer) typeRef(tr *parser.TypeRef) *types.Type {
+	if td := t.info.TypeRefs[tr]; td != nil {
+		return t.typeDecl(td)
+	}
+	typ := types.Named(tr.Name.Value)
+	switch {
+	case typ == nil:
+		return types.AnyType // reported by Resolve
+	case tr.Elem != nil && typ.Kind == types.List:
+		return types.ListOf(t.typeRef(tr.Elem))
+	case tr.Elem != nil && typ.Kind == types.Map:
+		return types.MapOf(t.typeRef(tr.Elem))
+	}
+	return typ
+}
+
+// placeholder returns the type of the value that ph stands for.
+func (t *typer) placeholder(ph *parser.Placeholder) *types.Type {
+	switch ph.Name.Value {
+	case "doc":
+		return types.StringType
+	case "now":
+		return types.TimeType
+	}
+	if f := t.info.Placeholders[ph]; f != nil {
+		return t.typeRef(f.Type)
+	}
+	return types.InvalidType // reported by Resolve
+}
+
+func builtinType(name string) *types.Type {
+	switch {
+	case builtins.LookupVar(name) != nil:
+		return builtins.LookupVar(name).Type
+	case builtins.LookupNamespace(name) != nil:
+		return types.NamespaceOf(name)
+	case builtins.LookupGlobal(name) != nil:
+		return types.FunctionOf(name)
+	default:
+		return types.TypeNameOf(name)
+	}
+}
+
+// value returns the type of e, reporting an error if e is a name that is not
+// a value, such as a namespace or a function.
+func (t *typer) value(e parser.Expr) *types.Type {
+	typ := t.expr(e)
+	switch typ.Kind {
+	case types.Namespace, types.TypeName, types.Function:
+		t.errorf(e, "%s is not a value", format.Expr(e))
+		return types.InvalidType
+	}
+	return typ
+}
+
+func (t *typer) unary(e *parser.UnaryExpr) *types.Type {
+	if e.Op.Kind == parser.Bang {
+		t.want(e.Operand, types.Bool, "operand")
+		return types.BoolType
+	}
+	typ := t.value(e.Operand)
+	if typ.Unknown() || typ.Numeric() || typ.Kind == types.Duration {
+		return typ
+	}
+	t.errorf(e, "invalid operation: %s (operator %s not defined on %s)", format.Expr(e), e.Op.Value, typ)
+	return types.InvalidType
+}
+
+func (t *typer) binary(e *parser.BinaryExpr) *types.Type {
+	switch e.Op.Kind {
+	case parser.Dot:
+		return t.field(e)
+	case parser.LeftSquareBracket:
+		return t.index(e)
+	case parser.AndAnd, parser.OrOr:
+		t.want(e.Lhs, types.Bool, "operand")
+		t.want(e.Rhs, types.Bool, "operand")
+		return types.BoolType
+	case parser.Is:
+		return t.is(e)
+	}
+
+	lhs, rhs := t.value(e.Lhs), t.value(e.Rhs)
+	if lhs.Kind == types.Invalid || rhs.Kind == types.Invalid {
+		return types.InvalidType
+	}
+	switch e.Op.Kind {
+	case parser.EqEq, parser.NotEq:
+		if !types.Comparable(lhs, rhs) {
+			return t.mismatch(e, lhs, rhs)
+		}
+		return types.BoolType
+	case parser.Less, parser.LessEq, parser.Greater, parser.GreaterEq:
+		if !types.Ordered(lhs, rhs) {
+			return t.mismatch(e, lhs, rhs)
+		}
+		return types.BoolType
+	case parser.In:
+		switch rhs.Kind {
+		case types.Any, types.List, types.Set:
+		case types.Map:
+			if !lhs.Unknown() && lhs.Kind != types.String {
+				t.errorf(e.Lhs, "map key %s has type %s, want string", format.Expr(e.Lhs), lhs)
+			}
+		default:
+			t.errorf(e.Rhs, "invalid operation: %s (%s is not a list, set or map)", format.Expr(e), rhs)
+		}
+		return types.BoolType
+	default:
+		if typ := arithmetic(e.Op.Kind, lhs, rhs); typ != nil {
+			return typ
+		}
+		return t.mismatch(e, lhs, rhs)
+	}
+}
+
+// arithmetic returns the type of lhs op rhs for the operators + - * / %, or
+// nil if the operator is not defined on those types.
+func arithmetic(op parser.Kind, lhs, rhs *types.Type) *types.Type {
+	switch {
+	case lhs.Numeric() && rhs.Numeric():
+		return types.Unify(lhs, rhs)
+	case lhs.Unknown() || rhs.Unknown():
+		known := lhs
+		if known.Unknown() {
+			known = rhs
+		}
+		switch known.Kind {
+		case types.String, types.Bytes, types.List:
+			if op == parser.Plus {
+				return known
+			}
+		}
+		return types.AnyType
+	}
+	switch op {
+	case parser.Plus:
+		switch {
+		case lhs.Kind == types.String && rhs.Kind == types.String,
+			lhs.Kind == types.Bytes && rhs.Kind == types.Bytes:
+			return lhs
+		case lhs.Kind == types.List && rhs.Kind == types.List:
+			return types.Unify(lhs, rhs)
+		case lhs.Kind == types.Duration && rhs.Kind == types.Duration:
+			return types.DurType
+		case lhs.Kind == types.Timestamp && rhs.Kind == types.Duration,
+			lhs.Kind == types.Duration && rhs.Kind == types.Timestamp:
+			return types.TimeType
+		}
+	case parser.Minus:
+		switch {
+		case lhs.Kind == types.Timestamp && rhs.Kind == types.Timestamp,
+			lhs.Kind == types.Duration && rhs.Kind == types.Duration:
+			return types.DurType
+		case lhs.Kind == types.Timestamp && rhs.Kind == types.Duration:
+			return types.TimeType
+		}
+	}
+	return nil
+}
+
+func (t *typer) mismatch(e *parser.BinaryExpr, lhs, rhs *types.Type) *types.Type {
+	if lhs.Kind == rhs.Kind {
+		t.errorf(e, "invalid operation: %s (operator %s not defined on %s)", format.Expr(e), e.Op.Value, lhs)
+	} else {
+		t.errorf(e, "invalid operation: %s (mismatched types %s and %s)", format.Expr(e), lhs, rhs)
+	}
+	return types.InvalidType
+}
+
+func (t *typer) is(e *parser.BinaryExpr) *types.Type {
+	lhs := t.value(e.Lhs)
+	id, ok := e.Rhs.(*parser.Id)
+	if !ok || !types.IsTypeName(id.Name.Value) || t.info.Uses[id] == nil || t.info.Uses[id].Kind != Builtin {
+		t.expr(e.Rhs)
+		t.errorf(e.Rhs, "%s is not a type", format.Expr(e.Rhs))
+		return types.BoolType
+	}
+	t.info.Types[id] = types.TypeNameOf(id.Name.Value)
+	if !types.Is(lhs, id.Name.Value) {
+		t.warnf(e, "%s has type %s, so it is never a %s", format.Expr(e.Lhs), lhs, id.Name.Value)
+	}
+	return types.BoolType
+}
+
+// field returns the type of lhs.name.
+func (t *typer) field(e *parser.BinaryExpr) *types.Type {
+	lhs := t.expr(e.Lhs)
+	name := e.Rhs.(*parser.Id).Name.Value
+	switch lhs.Kind {
+	case types.Any, types.Invalid:
+		return lhs
+	case types.Map:
+		if typ := lhs.Field(name); typ != nil {
+			return typ
+		}
+		t.errorf(e.Rhs, "%s has no field %s", format.Expr(e.Lhs), name)
+	case types.Namespace:
+		t.errorf(e, "%s is a function and must be called", format.Expr(e))
+	default:
+		t.errorf(e.Rhs, "%s has type %s, which has no field %s", format.Expr(e.Lhs), lhs, name)
+	}
+	return types.InvalidType
+}
+
+// index returns the type of lhs[rhs].
+func (t *typer) index(e *parser.BinaryExpr) *types.Type {
+	lhs, rhs := t.value(e.Lhs), t.value(e.Rhs)
+	switch lhs.Kind {
+	case types.Any, types.Invalid:
+		return lhs
+	case types.List:
+		if !rhs.Unknown() && rhs.Kind != types.Int {
+			t.errorf(e.Rhs, "list index %s has type %s, want int", format.Expr(e.Rhs), rhs)
+		}
+		return elem(lhs)
+	case types.Path:
+		if !rhs.Unknown() && rhs.Kind != types.Int {
+			t.errorf(e.Rhs, "path index %s has type %s, want int", format.Expr(e.Rhs), rhs)
+		}
+		return types.StringType
+	case types.Map:
+		if !rhs.Unknown() && rhs.Kind != types.String {
+			t.errorf(e.Rhs, "map key %s has type %s, want string", format.Expr(e.Rhs), rhs)
+			return types.InvalidType
+		}
+		if key, ok := stringLiteral(e.Rhs); ok {
+			if typ := lhs.Field(key); typ != nil {
+				return typ
+			}
+			t.errorf(e.Rhs, "%s has no field %s", format.Expr(e.Lhs), key)
+			return types.InvalidType
+		}
+		return elem(lhs)
+	default:
+		t.errorf(e, "invalid operation: %s (%s cannot be indexed)", format.Expr(e), lhs)
+		return types.InvalidType
+	}
+}
+
+// elem returns the type of the elements of a list or the values of a map.
+func elem(t *types.Type) *types.Type {
+	if t.Elem == nil {
+		return types.AnyType
+	}
+	return t.Elem
+}
+
+// stringLiteral returns the value of e if it is a string literal.
+func stringLiteral(e parser.Expr) (string, bool) {
+	lit, ok := e.(*parser.Literal)
+	if !ok || lit.Value.Kind != parser.StringLiteral {
+		return "", false
+	}
+	s, err := parser.Unquote(lit.Value.Value)
+	return s, err == nil
+}
+
+func (t *typer) call(e *parser.FunctionCall) *types.Type {
+	args := make([]*types.Type, len(e.Args))
+	for k, x := range e.Args {
+		args[k] = t.value(x)
+	}
+	switch fn := e.Fn.(type) {
+	case *parser.Id:
+		t.expr(fn)
+		d := t.info.Uses[fn]
+		switch {
+		case d == nil:
+			return types.InvalidType
+		case d.Kind == Function:
+			return t.function(d.Node.(*parser.FunctionDef))
+		case d.Kind == Builtin && builtins.LookupGlobal(d.Name) != nil:
+			return t.builtin(e, builtins.LookupGlobal(d.Name), nil, args)
+		default:
+			t.errorf(fn, "%s is not a function", fn.Name.Value)
+			return types.InvalidType
+		}
+	case *parser.BinaryExpr:
+		if fn.Op.Kind == parser.Dot {
+			return t.method(e, fn, args)
+		}
+	}
+	t.value(e.Fn)
+	t.errorf(e.Fn, "%s is not a function", format.Expr(e.Fn))
+	return types.InvalidType
+}
+
+// method returns the result of calling recv.name(args), where recv may be a
+// namespace.
+func (t *typer) method(call *parser.FunctionCall, fn *parser.BinaryExpr, args []*types.Type) *types.Type {
+	recv := t.expr(fn.Lhs)
+	name := fn.Rhs.(*parser.Id).Name.Value
+	t.info.Types[fn] = types.FunctionOf(name)
+	switch recv.Kind {
+	case types.Any, types.Invalid:
+		return recv
+	case types.Namespace:
+		if f := builtins.LookupFunc(recv.Name, name); f != nil {
+			return t.builtin(call, f, nil, args)
+		}
+		t.errorf(fn.Rhs, "undefined: %s", format.Expr(fn))
+	default:
+		if f := builtins.LookupMethod(recv.Kind, name); f != nil {
+			return t.builtin(call, f, recv, args)
+		}
+		t.errorf(fn.Rhs, "%s has type %s, which has no method %s", format.Expr(fn.Lhs), recv, name)
+	}
+	return types.InvalidType
+}
+
+// builtin checks the arguments of a call of a built-in function or method
+// and returns its result.
+func (t *typer) builtin(call *parser.FunctionCall, f *builtins.Func, recv *types.Type, args []*types.Type) *types.Type {
+	if len(args) != len(f.Params) {
+		t.errorf(call, "%s arguments in call to %s: have %d, want %d (%s)",
+			tooFewOrMany(len(args), len(f.Params)), f.QualifiedName(), len(args), len(f.Params), f.Signature())
+		return f.Result
+	}
+	for k, p := range f.Params {
+		if !p.Accept(args[k]) {
+			t.errorf(call.Args[k], "cannot use %s (type %s) as argument %s of %s", format.Expr(call.Args[k]), args[k], p.Name, f.Signature())
+		}
+	}
+	return f.ResultType(recv, args)
+}
+
+func tooFewOrMany(have, want int) string {
+	if have < want {
+		return "not enough"
+	}
+	return "too many"
+}
+
+func (t *typer) mapLiteral(e *parser.MapLiteral) *types.Type {
+	fields := map[string]*types.Type{}
+	elem := types.InvalidType
+	literalKeys := true
+	for _, entry := range e.Entries {
+		key := t.value(entry.Key)
+		value := t.value(entry.Value)
+		if !key.Unknown() && key.Kind != types.String {
+			t.errorf(entry.Key, "map key %s has type %s, want string", format.Expr(entry.Key), key)
+		}
+		if s, ok := stringLiteral(entry.Key); ok {
+			fields[s] = value
+		} else {
+			literalKeys = false
+		}
+		elem = types.Unify(elem, value)
+	}
+	if literalKeys {
+		return types.Record(fields)
+	}
+	if elem.Kind == types.Invalid {
+		elem = types.AnyType
+	}
+	return types.MapOf(elem)
+}
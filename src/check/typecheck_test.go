@@ -0,0 +1,196 @@
+package check
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"firestore-rules/src/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+// condition wraps cond in a rules file as the condition of an allow statement
+// in a match block with a {uid} wildcard.
+func condition(cond string) string {
+	return `rules_version = '2';
+service cloud.firestore {
+  match /users/{uid}/{rest=**} {
+    allow read: if ` + cond + `;
+  }
+}`
+}
+
+func TestTypeCheck(t *testing.T) {
+	tests := []struct {
+		cond     string
+		expected []string
+	}{
+		{cond: "request.resource.data.title.size() > 10"},
+		{cond: "request.auth != null && request.auth.uid == uid"},
+		{cond: "request.time < resource.data.created + duration.value(1, 'h')"},
+		{cond: "request.resource.data.keys().hasOnly(['a', 'b'])"},
+		{cond: "uid.size() + 1.5 > 2"},
+		{cond: "rest == /databases/$(uid)/documents"},
+		{cond: "get(/databases/x/documents/users/$(uid)).data.admin"},
+		{cond: "{'a': 1}.a == 1 && {'a': 1}['a'] > 0"},
+		{cond: "'x' in {'x': 1} && 'x' in ['x'] && 'x' in ['x'].toSet()"},
+		{cond: "resource.data.x is string || math.abs(-1) == 1"},
+		{cond: "uid == 'a' ? true : false"},
+		{cond: "'a' + 1 == 'b'", expected: []string{"4:20: invalid operation: 'a' + 1 (mismatched types string and int)"}},
+		{cond: "request.time > 5", expected: []string{"4:20: invalid operation: request.time > 5 (mismatched types timestamp and int)"}},
+		{cond: "uid == 1", expected: []string{"4:20: invalid operation: uid == 1 (mismatched types string and int)"}},
+		{cond: "true < false", expected: []string{"4:20: invalid operation: true < false (operator < not defined on bool)"}},
+		{cond: "uid.size()", expected: []string{"4:20: condition uid.size() has type int, want bool"}},
+		{cond: "uid && true", expected: []string{"4:20: operand uid has type string, want bool"}},
+		{cond: "!1", expected: []string{"4:21: operand 1 has type int, want bool"}},
+		{cond: "-'a' == 1", expected: []string{"4:20: invalid operation: -'a' (operator - not defined on string)"}},
+		{cond: "request.foo", expected: []string{"4:28: request has no field foo"}},
+		{cond: "request.auth.token.custom == 1"},
+		{cond: "uid.foo", expected: []string{"4:24: uid has type string, which has no field foo"}},
+		{cond: "uid.bar()", expected: []string{"4:24: uid has type string, which has no method bar"}},
+		{cond: "math.nope(1)", expected: []string{"4:25: undefined: math.nope"}},
+		{cond: "math.abs", expected: []string{"4:20: math.abs is a function and must be called"}},
+		{cond: "math == 1", expected: []string{"4:20: math is not a value"}},
+		{cond: "uid(1)", expected: []string{"4:20: uid is not a function"}},
+		{cond: "uid is foo", expected: []string{"4:27: undefined: foo", "4:27: foo is not a type"}},
+		{cond: "uid is int", expected: []string{"4:20: warning: uid has type string, so it is never a int"}},
+		{cond: "1 in 2", expected: []string{"4:25: invalid operation: 1 in 2 (int is not a list, set or map)"}},
+		{cond: "1 in {'a': 1}", expected: []string{"4:20: map key 1 has type int, want string"}},
+		{cond: "[1][uid] == 1", expected: []string{"4:24: list index uid has type string, want int"}},
+		{cond: "{'a': 1}['b'] == 1", expected: []string{"4:29: {'a': 1} has no field b"}},
+		{cond: "request.path[3] == 'a' && (/a/b)[0] == 'a'"},
+		{cond: "request.path['a'] == 'b'", expected: []string{"4:33: path index 'a' has type string, want int"}},
+		{cond: "request.path[0] == 1", expected: []string{"4:20: invalid operation: request.path[0] == 1 (mismatched types string and int)"}},
+		{cond: "uid[0] == 'a'", expected: []string{"4:20: invalid operation: uid[0] (string cannot be indexed)"}},
+		{cond: "request.resource.data.diff(resource.data).affectedKeys().hasOnly(['a'])"},
+		{cond: "math.abs(1, 2) == 1", expected: []string{"4:20: too many arguments in call to math.abs: have 2, want 1 (math.abs(value float) float)"}},
+		{cond: "uid.matches()", expected: []string{"4:20: not enough arguments in call to string.matches: have 0, want 1 (string.matches(regex string) bool)"}},
+		{cond: "exists('a')", expected: []string{"4:27: cannot use 'a' (type string) as argument path of exists(path path) bool"}},
+		{cond: "duration.value(1, 2) > duration.value(1.5, 's')", expected: []string{
+			"4:38: cannot use 2 (type int) as argument unit of duration.value(magnitude int, unit string) duration",
+			"4:58: cannot use 1.5 (type float) as argument magnitude of duration.value(magnitude int, unit string) duration",
+		}},
+		{cond: "math.sqrt(4) > 1 && uid.size().bar()", expected: []string{"4:51: uid.size() has type int, which has no method bar"}},
+		{cond: "(1 ? 2 : 3) == 2", expected: []string{"4:21: condition 1 has type int, want bool"}},
+		{cond: "('a' + 1) + 2 == 3", expected: []string{"4:21: invalid operation: 'a' + 1 (mismatched types string and int)"}},
+	}
+	for _, test := range tests {
+		t.Run(test.cond, func(t *testing.T) {
+			_, diags := Check(parse(t, condition(test.cond)))
+			if test.expected == nil {
+				assert.Empty(t, messages(diags))
+			} else {
+				assert.Equal(t, test.expected, messages(diags))
+			}
+		})
+	}
+}
+
+func TestTypeCheckFunctions(t *testing.T) {
+	rules := parse(t, `rules_version = '2';
+service cloud.firestore {
+  match /users/{uid} {
+    function title() {
+      let t = request.resource.data.title;
+      return t is string && t.size() < 100;
+    }
+    function count() { return [1, 2.5].size(); }
+    function loop() { return loop(); }
+    allow read: if title() && count() > 1 && loop();
+    allow write: if count();
+  }
+}`)
+	info, diags := Check(rules)
+	assert.Equal(t, []string{
+		"9:30: recursive call loop -> loop is not allowed",
+		"11:21: condition count() has type int, want bool",
+	}, messages(diags))
+
+	types := map[string]string{}
+	parser.Inspect(rules, func(n parser.Node) bool {
+		// Paths and their components have String methods too, but are not
+		// expressions and cannot be map keys.
+		if e, ok := n.(parser.Expr); ok && reflect.ValueOf(n).Kind() == reflect.Ptr {
+			if typ, ok := info.Types[e]; ok {
+				types[e.String()] = typ.String()
+			}
+		}
+		return true
+	})
+	assert.Equal(t, "list<float>", types["[1, 2.5]"])
+	assert.Equal(t, "int", types["count()"])
+	assert.Equal(t, "bool", types["title()"])
+	assert.Equal(t, "any", types["loop()"])
+	assert.Equal(t, "map{__name__, data, id}", types["request.resource"])
+}
+
+func TestTypeCheckFile(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/firestore.rules")
+	assert.Nil(t, err)
+	_, diags := Check(parse(t, string(src)))
+	assert.Empty(t, messages(diags))
+}
+
+func TestTypeCheckDocType(t *testing.T) {
+	tests := []struct {
+		cond     string
+		expected []string
+	}{
+		{cond: "resource.data.title.size() < 100 && request.resource.data.votes > 0"},
+		{cond: "request.resource.data.author.name.size() > 0 && resource.data.tags[0].size() > 0"},
+		{cond: "resource.data.labels['x'] == 1 && resource.data.created < request.time"},
+		{cond: "'note' in resource.data && resource.data.note == null"},
+		{cond: "titled() && anything()"},
+		{cond: "resource.data.title > 1", expected: []string{"10:20: invalid operation: resource.data.title > 1 (mismatched types string and int)"}},
+		{cond: "resource.data.votes is string", expected: []string{"10:20: warning: resource.data.votes has type int, so it is never a string"}},
+		{cond: "request.resource.data.titel == ''", expected: []string{"10:42: request.resource.data has no field titel"}},
+		{cond: "resource.data.author.email == ''", expected: []string{"10:41: resource.data.author has no field email"}},
+	}
+	for _, test := range tests {
+		t.Run(test.cond, func(t *testing.T) {
+			src := `rules_version = '2';
+service cloud.firestore {
+  type Person { name: string; }
+  function anything() { return resource.data.whatever; }
+  match /issues/{id} is Issue {
+    type Issue {
+      title: string<100>; votes: int; author: Person; tags?: list<string>;
+      labels?: map<int>; created?: timestamp; note?: string;
+    }
+    allow read: if ` + test.cond + `;
+    function titled() { return resource.data.title != ''; }
+    match /comments/{comment} {
+      allow read: if resource.data.anything;
+    }
+  }
+}`
+			_, diags := Check(parse(t, src))
+			if test.expected == nil {
+				assert.Empty(t, messages(diags))
+			} else {
+				assert.Equal(t, test.expected, messages(diags))
+			}
+		})
+	}
+}
+
+func TestTypeCheckFieldConditions(t *testing.T) {
+	rules := parse(t, `rules_version = '2';
+service cloud.firestore {
+  type Issue {
+    id: string { invariant: ${value}.size() == 10 && ${value} == ${doc}; }
+    created: timestamp {
+      allowCreateIf: ${value} == ${now};
+      allowUpdateIf: ${value} == ${value.prev} && ${votes} > 0;
+    }
+    votes: int { invariant: ${value}; }
+    title: string { invariant: ${votes} == ''; }
+  }
+  match /issues/{id} is Issue {}
+}`)
+	_, diags := Check(rules)
+	assert.Equal(t, []string{
+		"9:29: invariant ${value} has type int, want bool",
+		"10:32: invalid operation: ${votes} == '' (mismatched types int and string)",
+	}, messages(diags))
+}
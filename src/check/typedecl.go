@@ -0,0 +1,289 @@
+package check
+
+import (
+	"strconv"
+	"strings"
+
+	"firestore-rules/src/parser"
+	"firestore-rules/src/types"
+)
+
+// sized are the primitive types that may have a size bound.
+var sized = map[string]bool{"string": true, "bytes": true, "list": true, "map": true}
+
+// IsFieldType reports whether name is a primitive type that a field can be
+// declared with.
+func IsFieldType(name string) bool {
+	return name != "set" && types.IsTypeName(name)
+}
+
+func (s *scope) lookupType(name string) *parser.TypeDecl {
+	for ; s != nil; s = s.parent {
+		if td, ok := s.types[name]; ok {
+			return td
+		}
+	}
+	return nil
+}
+
+// declareType adds td to s, reporting a clash with another type of the same
+// block.
+func (r *resolver) declareType(s *scope, td *parser.TypeDecl) {
+	name := td.Name.Value
+	if prev, ok := s.types[name]; ok {
+		r.errorf(tokenSpan(td.Name), "type %s redeclared in this block (previous declaration at %s)", name, prev.Name.Start)
+		return
+	}
+	if IsFieldType(name) {
+		r.errorf(tokenSpan(td.Name), "type %s has the name of a built-in type", name)
+		return
+	}
+	s.types[name] = td
+	r.typeDecls = append(r.typeDecls, td)
+}
+
+// fieldCond is a condition of field f of type td.
+type fieldCond struct {
+	td *parser.TypeDecl
+	f  *parser.FieldDecl
+	fc *parser.FieldCondition
+}
+
+// typeDecl checks the fields of td and resolves their conditions.
+func (r *resolver) typeDecl(s *scope, td *parser.TypeDecl) {
+	seen := map[string]*parser.FieldDecl{}
+	for _, f := range td.Fields {
+		if prev, ok := seen[f.Name.Value]; ok {
+			r.errorf(tokenSpan(f.Name), "field %s redeclared in type %s (previous declaration at %s)",
+				f.Name.Value, td.Name.Value, prev.Name.Start)
+		}
+		seen[f.Name.Value] = f
+		r.typeRef(s, f.Type)
+		r.modifiers(f)
+	}
+	for _, f := range td.Fields {
+		conds := map[string]*parser.FieldCondition{}
+		for _, fc := range f.Conditions {
+			if prev, ok := conds[fc.Name.Value]; ok {
+				r.errorf(tokenSpan(fc.Name), "%s redeclared in field %s (previous declaration at %s)",
+					fc.Name.Value, f.Name.Value, prev.Name.Start)
+			}
+			conds[fc.Name.Value] = fc
+			r.cond = &fieldCond{td: td, f: f, fc: fc}
+			r.expr(s, fc.Cond)
+			r.cond = nil
+		}
+	}
+}
+
+// modifiers checks that the modifiers of f are not repeated, agree with each
+// other and suit the type of f.
+func (r *resolver) modifiers(f *parser.FieldDecl) {
+	seen := map[string]bool{}
+	for _, m := range f.Modifiers {
+		if seen[m.Value] {
+			r.errorf(tokenSpan(m), "modifier %s repeated", m.Value)
+			continue
+		}
+		seen[m.Value] = true
+		switch m.Value {
+		case parser.Readonly:
+			if !f.IsOptional() {
+				r.errorf(tokenSpan(m), "readonly field %s must be optional, since a create cannot set it", f.Name.Value)
+			}
+			for _, other := range f.Modifiers {
+				if other.Value != parser.Readonly {
+					r.errorf(tokenSpan(other), "field %s is readonly, so it cannot also be %s", f.Name.Value, other.Value)
+				}
+			}
+		case parser.ServerTimestamp:
+			r.modifierType(f, m, "timestamp")
+		case parser.AuthorUid:
+			r.modifierType(f, m, "string")
+		}
+	}
+}
+
+// modifierType reports a field with modifier m whose type is not want.
+func (r *resolver) modifierType(f *parser.FieldDecl, m parser.Token, want string) {
+	if f.Type.Name.Value != want {
+		r.errorf(f.Type, "%s field %s has type %s, want %s", m.Value, f.Name.Value, f.Type, want)
+	}
+}
+
+// placeholder checks that ph is in a field condition and names something
+// that the condition can refer to.
+func (r *resolver) placeholder(ph *parser.Placeholder) {
+	if r.cond == nil {
+		r.errorf(ph, "%s outside the conditions of a field", ph)
+		return
+	}
+	name := ph.Name.Value
+	switch name {
+	case "doc", "now":
+		if ph.IsPrev() {
+			r.errorf(ph, "%s has no previous value", ph)
+		}
+		return
+	case "value":
+		r.info.Placeholders[ph] = r.cond.f
+	default:
+		f := r.cond.td.Field(name)
+		if f == nil {
+			r.errorf(ph, "%s: type %s has no field %s", ph, r.cond.td.Name.Value, name)
+			return
+		}
+		r.info.Placeholders[ph] = f
+	}
+	if ph.IsPrev() && r.cond.fc.Name.Value != parser.AllowUpdateIf {
+		r.errorf(ph, "%s is only allowed in %s, since there is no previous value in %s",
+			ph, parser.AllowUpdateIf, r.cond.fc.Name.Value)
+	}
+}
+
+func (r *resolver) typeRef(s *scope, tr *parser.TypeRef) {
+	name := tr.Name.Value
+	if !IsFieldType(name) {
+		td := s.lookupType(name)
+		if td == nil {
+			r.errorf(tr, "undefined type: %s", name)
+			return
+		}
+		r.info.TypeRefs[tr] = td
+	}
+	if tr.Elem != nil {
+		if name != "list" && name != "map" {
+			r.errorf(tr.Elem, "%s has no element type", name)
+		} else {
+			r.typeRef(s, tr.Elem)
+		}
+	}
+	if tr.HasSize() {
+		if !sized[name] {
+			r.errorf(tokenSpan(tr.Size), "%s has no size", name)
+		} else if n, err := strconv.ParseInt(tr.Size.Value, 10, 64); err != nil || n <= 0 {
+			r.errorf(tokenSpan(tr.Size), "size %s must be a positive int", tr.Size.Value)
+		}
+	}
+}
+
+// docType records the type of the documents of ms, which it names after
+// 'is'. The name is looked up in s, the scope of its body. A block that names
+// no type has documents of no declared type, whatever types it declares.
+func (r *resolver) docType(s *scope, ms *parser.MatchStmt) {
+	if !ms.HasDocType() {
+		return
+	}
+	if td := s.lookupType(ms.DocType.Value); td != nil {
+		r.info.DocTypes[ms] = td
+	} else {
+		r.errorf(tokenSpan(ms.DocType), "undefined type: %s", ms.DocType.Value)
+	}
+}
+
+// typeCycles reports each type that contains itself, which would need
+// validation functions that call themselves.
+func (r *resolver) typeCycles() {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[*parser.TypeDecl]int{}
+	var visit func(td *parser.TypeDecl, path []string)
+	visit = func(td *parser.TypeDecl, path []string) {
+		path = append(path, td.Name.Value)
+		state[td] = visiting
+		for _, f := range td.Fields {
+			for tr := f.Type; tr != nil; tr = tr.Elem {
+				next := r.info.TypeRefs[tr]
+				switch {
+				case next == nil || state[next] == done:
+				case state[next] == visiting:
+					r.errorf(tr, "type %s contains itself: %s", next.Name.Value,
+						strings.Join(append(path[indexOf(path, next.Name.Value):], next.Name.Value), " -> "))
+				default:
+					visit(next, path)
+				}
+			}
+		}
+		state[td] = done
+	}
+	for _, td := range r.typeDecls {
+		if state[td] == 0 {
+			visit(td, nil)
+		}
+	}
+}
+
+// elementTypes reports each declared type that is the element type of a list
+// or map although it has rules that only the create or update of a document
+// checks, since rules cannot loop over the elements to check them.
+func (r *resolver) elementTypes() {
+	for _, td := range r.typeDecls {
+		for _, f := range td.Fields {
+			for tr := f.Type.Elem; tr != nil; tr = tr.Elem {
+				elem := r.info.TypeRefs[tr]
+				if elem == nil {
+					continue
+				}
+				if owner, g, rule := r.writeRule(elem, map[*parser.TypeDecl]bool{}); g != nil {
+					r.errorf(tr, "type %s cannot be the element type of %s: field %s of type %s has %s, which cannot be checked for each element",
+						elem.Name.Value, f.Type.Name.Value, g.Name.Value, owner.Name.Value, rule)
+				}
+			}
+		}
+	}
+}
+
+// writeRule returns a field with a rule that only a create or an update
+// checks, a modifier or an allowCreateIf or allowUpdateIf condition, the type
+// that declares it and the rule. The field is one of td or
+// of a map that td holds.
+func (r *resolver) writeRule(td *parser.TypeDecl, seen map[*parser.TypeDecl]bool) (*parser.TypeDecl, *parser.FieldDecl, string) {
+	if seen[td] {
+		return nil, nil, ""
+	}
+	seen[td] = true
+	for _, f := range td.Fields {
+		if len(f.Modifiers) > 0 {
+			return td, f, "modifier " + f.Modifiers[0].Value
+		}
+		for _, fc := range f.Conditions {
+			if fc.Name.Value != parser.Invariant {
+				return td, f, fc.Name.Value
+			}
+		}
+		if nested := r.info.TypeRefs[f.Type]; nested != nil {
+			if owner, g, rule := r.writeRule(nested, seen); g != nil {
+				return owner, g, rule
+			}
+		}
+	}
+	return nil, nil, ""
+}
+
+// unusedTypes warns about each type that no match block names after 'is' and
+// no field has, since nothing is ever validated against it.
+func (r *resolver) unusedTypes() {
+	used := map[*parser.TypeDecl]bool{}
+	for _, td := range r.info.DocTypes {
+		used[td] = true
+	}
+	for _, td := range r.info.TypeRefs {
+		used[td] = true
+	}
+	for _, td := range r.typeDecls {
+		if !used[td] {
+			r.warnf(tokenSpan(td.Name), "type %s declared but not used (no match block names it after 'is' and no field has it)", td.Name.Value)
+		}
+	}
+}
+
+func indexOf(list []string, s string) int {
+	for k, v := range list {
+		if v == s {
+			return k
+		}
+	}
+	return 0
+}
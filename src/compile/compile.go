@@ -0,0 +1,457 @@
+// Package compile translates rules written with type declarations into rules
+// that Firestore accepts.
+package compile
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"firestore-rules/src/check"
+	"firestore-rules/src/format"
+	"firestore-rules/src/parser"
+)
+
+// Rules compiles rules in place. Each type declaration is replaced by a
+// function that checks that a map has the declared fields, and a call of the
+// function on request.resource.data is added to each allow statement that
+// grants create or update in a match block that names the type of its
+// documents after 'is'. The 'is' is removed, since Firestore does not accept
+// it.
+//
+// The function for type Issue is isValidIssue(data). It checks that data has
+// only the declared keys and all the required ones, that each field has the
+// declared type and that it is no larger than its size bound. A field of a
+// declared type is checked by calling that type's function. The elements of
+// lists and maps are not checked, since rules cannot loop over them.
+//
+// The invariants of the fields are checked by the validation function, and
+// the checks required by the modifiers and the allowCreateIf and
+// allowUpdateIf conditions of the fields of a document's type, and of the
+// fields of the maps it holds whose type is declared, are added to the
+// statements that grant create and update.
+// Their placeholders are expanded: ${value} and ${name} to the fields of the
+// new data, ${value.prev} and ${name.prev} to those of resource.data, ${doc}
+// to request.resource.id and ${now} to request.time.
+//
+// An allow statement that grants write, and so delete as well as create and
+// update, is split so that deletes are not validated, and create and update
+// are granted by separate statements if their conditions differ.
+//
+// The rules are checked first, as by check.Check, and the diagnostics are
+// returned. If there are errors rules is left unchanged.
+func Rules(rules *parser.Rules) check.Diagnostics {
+	info, diags := check.Check(rules)
+	if diags.HasErrors() || rules.Service == nil {
+		return diags
+	}
+	c := &compiler{info: info}
+	c.names(rules.Service.Statements, nil)
+	if c.diags.HasErrors() {
+		return append(diags, c.diags...)
+	}
+	rules.Service.Statements = c.block(rules.Service.Statements)
+	return diags
+}
+
+// HasTypes reports whether rules declare any types, and so need to be
+// compiled.
+func HasTypes(rules *parser.Rules) bool {
+	found := false
+	if rules.Service != nil {
+		parser.Inspect(rules.Service, func(n parser.Node) bool {
+			if _, ok := n.(*parser.TypeDecl); ok {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// FunctionName returns the name of the validation function for td.
+func FunctionName(td *parser.TypeDecl) string {
+	return "isValid" + td.Name.Value
+}
+
+type compiler struct {
+	info  *check.Info
+	diags check.Diagnostics
+}
+
+// names reports functions whose names clash with the validation function of
+// a type declared in the same block. outer holds the names of the functions
+// of the enclosing blocks.
+func (c *compiler) names(list []parser.Stmt, outer map[string]bool) {
+	functions := map[string]bool{}
+	for name := range outer {
+		functions[name] = true
+	}
+	for _, stmt := range list {
+		if fd, ok := stmt.(*parser.FunctionDef); ok {
+			functions[fd.Name.Value] = true
+		}
+	}
+	for _, stmt := range list {
+		switch stmt := stmt.(type) {
+		case *parser.TypeDecl:
+			if name := FunctionName(stmt); functions[name] {
+				c.diags = append(c.diags, check.Diagnostic{
+					Start:    stmt.Name.Start,
+					End:      stmt.Name.End,
+					Severity: check.Error,
+					Msg:      fmt.Sprintf("function %s, which validates type %s, is already declared", name, stmt.Name.Value),
+				})
+			}
+		case *parser.MatchStmt:
+			c.names(stmt.Components, functions)
+		}
+	}
+}
+
+// block compiles a list of statements.
+func (c *compiler) block(list []parser.Stmt) []parser.Stmt {
+	result := make([]parser.Stmt, 0, len(list))
+	for _, stmt := range list {
+		switch stmt := stmt.(type) {
+		case *parser.TypeDecl:
+			result = append(result, c.validator(stmt))
+		case *parser.MatchStmt:
+			td := c.info.DocTypes[stmt]
+			stmt.Is, stmt.DocType = parser.Token{}, parser.Token{}
+			components := c.block(stmt.Components)
+			stmt.Components = make([]parser.Stmt, 0, len(components))
+			for _, s := range components {
+				if as, ok := s.(*parser.AllowStmt); ok && td != nil {
+					stmt.Components = append(stmt.Components, c.validate(as, td)...)
+				} else {
+					stmt.Components = append(stmt.Components, s)
+				}
+			}
+			result = append(result, stmt)
+		default:
+			result = append(result, stmt)
+		}
+	}
+	return result
+}
+
+// validator returns the validation function of td.
+func (c *compiler) validator(td *parser.TypeDecl) *parser.FunctionDef {
+	var all, required []string
+	for _, f := range td.Fields {
+		all = append(all, quote(f.Name.Value))
+		if !f.IsOptional() {
+			required = append(required, quote(f.Name.Value))
+		}
+	}
+	checks := []string{fmt.Sprintf("data.keys().hasOnly([%s])", strings.Join(all, ", "))}
+	if len(required) > 0 {
+		checks = append(checks, fmt.Sprintf("data.keys().hasAll([%s])", strings.Join(required, ", ")))
+	}
+	for _, f := range td.Fields {
+		fieldChecks := c.checks(field("data", f.Name.Value), f.Type)
+		for _, fc := range f.Conditions {
+			if fc.Name.Value == parser.Invariant {
+				fieldChecks = append(fieldChecks, "("+c.expand(fc, "data", "")+")")
+			}
+		}
+		check := strings.Join(fieldChecks, " && ")
+		if f.IsOptional() {
+			check = fmt.Sprintf("(!(%s in data) || %s)", quote(f.Name.Value), check)
+		}
+		checks = append(checks, check)
+	}
+	src := fmt.Sprintf("function %s(data) { return %s; }", FunctionName(td), strings.Join(checks, " && "))
+	fd, err := parser.ParseFunctionDef(parser.New(src))
+	if err != nil {
+		panic(fmt.Sprintf("compile: generated function does not parse: %v\n%s", err, src))
+	}
+	relocate(fd, td.Keyword.Start)
+	return fd
+}
+
+// checks returns the conditions that a value, written as the expression v,
+// has type tr.
+func (c *compiler) checks(v string, tr *parser.TypeRef) []string {
+	if td := c.info.TypeRefs[tr]; td != nil {
+		return []string{v + " is map", fmt.Sprintf("%s(%s)", FunctionName(td), v)}
+	}
+	result := []string{v + " is " + tr.Name.Value}
+	if tr.HasSize() {
+		result = append(result, fmt.Sprintf("%s.size() <= %s", v, tr.Size.Value))
+	}
+	return result
+}
+
+// conditions returns the conditions that a document of type td must meet to
+// be written by a request with the given method, create or update: that it
+// is valid, that its fields obey their modifiers, and the allowCreateIf or
+// allowUpdateIf conditions of its fields and of the fields of the maps it
+// holds whose type is declared. The condition of an optional field only
+// applies if the field is present.
+func (c *compiler) conditions(td *parser.TypeDecl, method parser.Kind) []string {
+	return append([]string{FunctionName(td) + "(request.resource.data)"}, c.fieldConditions(td, nil, method)...)
+}
+
+// fieldConditions returns the conditions on the fields of a map of type td
+// for a request with the given method. The map is the document itself if
+// parent is empty, and otherwise the value of the last field of parent, the
+// path of fields that leads to it from the document.
+func (c *compiler) fieldConditions(td *parser.TypeDecl, parent []*parser.FieldDecl, method parser.Kind) []string {
+	name := parser.AllowCreateIf
+	if method == parser.Update {
+		name = parser.AllowUpdateIf
+	}
+	data, prev := access("request.resource.data", parent), access("resource.data", parent)
+	var result []string
+	for _, f := range td.Fields {
+		path := append(parent[:len(parent):len(parent)], f)
+		result = append(result, modifierChecks(path, method)...)
+		for _, fc := range f.Conditions {
+			if fc.Name.Value != name {
+				continue
+			}
+			result = append(result, "("+ifPresent(path, c.expand(fc, data, prev))+")")
+		}
+		if nested := c.info.TypeRefs[f.Type]; nested != nil {
+			result = append(result, c.fieldConditions(nested, path, method)...)
+		}
+	}
+	return result
+}
+
+// access returns the expression for the value at path in the map v.
+func access(v string, path []*parser.FieldDecl) string {
+	for _, f := range path {
+		v = field(v, f.Name.Value)
+	}
+	return v
+}
+
+// ifPresent returns cond, a condition on the field of request.resource.data
+// at path, made to hold if an optional field on the path is absent.
+func ifPresent(path []*parser.FieldDecl, cond string) string {
+	var guards []string
+	for k, f := range path {
+		if f.IsOptional() {
+			guards = append(guards, fmt.Sprintf("!(%s in %s)", quote(f.Name.Value), access("request.resource.data", path[:k])))
+		}
+	}
+	return strings.Join(append(guards, cond), " || ")
+}
+
+// modifierChecks returns the conditions that the modifiers of the field at
+// path impose on a create or an update. A readonly field is absent from a new
+// document and does not change, and an immutable one does not change. A
+// serverTimestamp field holds request.time and an authorUid field
+// request.auth.uid, except that an update keeps the value of an immutable
+// one, so that it records the time or the author of the create.
+func modifierChecks(path []*parser.FieldDecl, method parser.Kind) []string {
+	f, parent := path[len(path)-1], path[:len(path)-1]
+	value := access("request.resource.data", path)
+	var result []string
+	switch {
+	case method == parser.Create && f.Has(parser.Readonly):
+		result = append(result, ifPresent(parent, fmt.Sprintf("!(%s in %s)", quote(f.Name.Value), access("request.resource.data", parent))))
+	case method == parser.Update && (f.Has(parser.Readonly) || f.Has(parser.Immutable)):
+		if key, ok := optionalKey(path); ok {
+			// An absent field must stay absent.
+			result = append(result, fmt.Sprintf("request.resource.data.get(%[1]s, null) == resource.data.get(%[1]s, null)", key))
+		} else {
+			result = append(result, value+" == "+access("resource.data", path))
+		}
+	}
+	if method == parser.Create || !f.Has(parser.Immutable) {
+		if f.Has(parser.ServerTimestamp) {
+			result = append(result, "("+ifPresent(path, value+" == request.time")+")")
+		}
+		if f.Has(parser.AuthorUid) {
+			result = append(result, "("+ifPresent(path, value+" == request.auth.uid")+")")
+		}
+	}
+	return result
+}
+
+// optionalKey returns the key that map.get takes to look up the field at
+// path, a name or a list of names, if a field on the path is optional and so
+// may be absent.
+func optionalKey(path []*parser.FieldDecl) (string, bool) {
+	optional := false
+	names := make([]string, len(path))
+	for k, f := range path {
+		optional = optional || f.IsOptional()
+		names[k] = quote(f.Name.Value)
+	}
+	if len(path) == 1 {
+		return names[0], optional
+	}
+	return "[" + strings.Join(names, ", ") + "]", optional
+}
+
+// expand returns the text of the condition fc with each placeholder replaced
+// by the expression it stands for. The fields of the new value are those of
+// the map data, and the fields of the previous value those of prev. The
+// conditions of a type are expanded once for each field that has the type, so
+// the placeholders are put back afterwards.
+func (c *compiler) expand(fc *parser.FieldCondition, data, prev string) string {
+	placeholders := map[parser.Node]*parser.Placeholder{}
+	cond := parser.Apply(fc.Cond, func(cur *parser.Cursor) bool {
+		ph, ok := cur.Node().(*parser.Placeholder)
+		if !ok {
+			return true
+		}
+		var src string
+		switch ph.Name.Value {
+		case "doc":
+			src = "request.resource.id"
+		case "now":
+			src = "request.time"
+		default:
+			base := data
+			if ph.IsPrev() {
+				base = prev
+			}
+			src = field(base, c.info.Placeholders[ph].Name.Value)
+		}
+		e, err := parser.ParseExpr(parser.New(src))
+		if err != nil {
+			panic(fmt.Sprintf("compile: expansion of %s does not parse: %v", ph, err))
+		}
+		placeholders[e] = ph
+		cur.Replace(e)
+		return false
+	}, nil)
+	s := format.Expr(cond.(parser.Expr))
+	fc.Cond = parser.Apply(cond, func(cur *parser.Cursor) bool {
+		if ph, ok := placeholders[cur.Node()]; ok {
+			cur.Replace(ph)
+			return false
+		}
+		return true
+	}, nil).(parser.Expr)
+	return s
+}
+
+// validate returns as with the conditions of td added to its condition if it
+// grants create or update. If it grants write it is split into a statement
+// for delete and one for create and update, and create and update are split
+// if their conditions differ.
+func (c *compiler) validate(as *parser.AllowStmt, td *parser.TypeDecl) []parser.Stmt {
+	var plain []parser.Token
+	var create, update parser.Token
+	for _, action := range as.Actions {
+		switch action.Kind {
+		case parser.Create:
+			create = action
+		case parser.Update:
+			update = action
+		case parser.Write:
+			plain = append(plain, actionToken(parser.Delete, action))
+			create, update = actionToken(parser.Create, action), actionToken(parser.Update, action)
+		default:
+			plain = append(plain, action)
+		}
+	}
+	var result []parser.Stmt
+	if len(plain) > 0 {
+		result = append(result, &parser.AllowStmt{Keyword: as.Keyword, Actions: plain, Condition: as.Condition, SemiColon: as.SemiColon})
+	}
+	createConds, updateConds := c.conditions(td, parser.Create), c.conditions(td, parser.Update)
+	switch {
+	case create.Kind == parser.Create && update.Kind == parser.Update && equal(createConds, updateConds):
+		result = append(result, checked(as, []parser.Token{create, update}, createConds))
+	default:
+		if create.Kind == parser.Create {
+			result = append(result, checked(as, []parser.Token{create}, createConds))
+		}
+		if update.Kind == parser.Update {
+			result = append(result, checked(as, []parser.Token{update}, updateConds))
+		}
+	}
+	return result
+}
+
+// checked returns a copy of as that grants actions if its condition and
+// conds all hold.
+func checked(as *parser.AllowStmt, actions []parser.Token, conds []string) *parser.AllowStmt {
+	condition := as.Condition
+	at := as.Condition.End()
+	for _, src := range conds {
+		e, err := parser.ParseExpr(parser.New(src))
+		if err != nil {
+			panic(fmt.Sprintf("compile: generated condition does not parse: %v\n%s", err, src))
+		}
+		relocate(e, at)
+		condition = &parser.BinaryExpr{
+			Op:  parser.Token{Kind: parser.AndAnd, Value: "&&", Start: at, End: at},
+			Lhs: condition,
+			Rhs: e,
+		}
+	}
+	return &parser.AllowStmt{Keyword: as.Keyword, Actions: actions, Condition: condition, SemiColon: as.SemiColon}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+func actionToken(kind parser.Kind, at parser.Token) parser.Token {
+	name := strings.ToLower(kind.String())
+	return parser.Token{Kind: kind, Value: name, Start: at.Start, End: at.End}
+}
+
+// field returns the expression for the named field of the map v.
+func field(v, name string) string {
+	if parser.New(name).Peek().Kind == parser.Identifier {
+		return v + "." + name
+	}
+	return v + "[" + quote(name) + "]"
+}
+
+// quote returns a field name as a string literal. Field names are words, so
+// they need no escapes.
+func quote(name string) string {
+	return "'" + name + "'"
+}
+
+var tokenType = reflect.TypeOf(parser.Token{})
+
+// relocate moves every token of the generated node n to at, so that it sits
+// where the source it was generated from was, and formatting keeps comments
+// in place.
+func relocate(n parser.Node, at parser.InputPosition) {
+	var visit func(v reflect.Value)
+	visit = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if !v.IsNil() {
+				visit(v.Elem())
+			}
+		case reflect.Slice:
+			for k := 0; k < v.Len(); k++ {
+				visit(v.Index(k))
+			}
+		case reflect.Struct:
+			if v.Type() == tokenType {
+				if v.CanSet() {
+					v.FieldByName("Start").Set(reflect.ValueOf(at))
+					v.FieldByName("End").Set(reflect.ValueOf(at))
+				}
+				return
+			}
+			for k := 0; k < v.NumField(); k++ {
+				visit(v.Field(k))
+			}
+		}
+	}
+	visit(reflect.ValueOf(n))
+}
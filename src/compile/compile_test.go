@@ -0,0 +1,790 @@
+package compile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"firestore-rules/src/check"
+	"firestore-rules/src/eval"
+	"firestore-rules/src/format"
+	"firestore-rules/src/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func parse(t *testing.T, input string) *parser.Rules {
+	rules, err := parser.ParseRules(parser.New(input))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return rules
+}
+
+// compile compiles input and returns the formatted result, checking that it
+// parses again and has no errors.
+func compile(t *testing.T, input string) string {
+	rules := parse(t, input)
+	diags := Rules(rules)
+	assert.False(t, diags.HasErrors(), "%v", diags)
+	out := format.Rules(rules)
+	_, diags = check.Check(parse(t, out))
+	assert.False(t, diags.HasErrors(), "%v", diags)
+	return out
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name: "fields",
+			input: `rules_version = '2';
+service cloud.firestore {
+  match /issues/{id} is Issue {
+    type Issue {
+      title: string<100>;
+      votes: int;
+      tags?: list<string, 20>;
+      description?: string;
+      creator: string;
+    }
+    allow read: if true;
+    allow create: if request.auth != null;
+    allow update: if request.auth.uid == resource.data.creator || false;
+  }
+}
+`,
+			expected: `rules_version = '2';
+
+service cloud.firestore {
+  match /issues/{id} {
+    function isValidIssue(data) {
+      return data.keys().hasOnly([
+        'title',
+        'votes',
+        'tags',
+        'description',
+        'creator',
+      ])
+          && data.keys().hasAll(['title', 'votes', 'creator'])
+          && data.title is string
+          && data.title.size() <= 100
+          && data.votes is int
+          && (!('tags' in data) || data.tags is list && data.tags.size() <= 20)
+          && (!('description' in data) || data.description is string)
+          && data.creator is string;
+    }
+
+    allow read: if true;
+    allow create: if request.auth != null
+        && isValidIssue(request.resource.data);
+    allow update: if (request.auth.uid == resource.data.creator || false)
+        && isValidIssue(request.resource.data);
+  }
+}
+`,
+		},
+		{
+			name: "nested types and write",
+			input: `rules_version = '2';
+service cloud.firestore {
+  type Address {
+    city: string;
+  }
+  match /users/{uid} is User {
+    type User {
+      address?: Address;
+      delete: bool;
+    }
+    allow read, write: if request.auth.uid == uid;
+    match /posts/{post} {
+      allow create: if true;
+    }
+  }
+}
+`,
+			expected: `rules_version = '2';
+
+service cloud.firestore {
+  function isValidAddress(data) {
+    return data.keys().hasOnly(['city'])
+        && data.keys().hasAll(['city'])
+        && data.city is string;
+  }
+
+  match /users/{uid} {
+    function isValidUser(data) {
+      return data.keys().hasOnly(['address', 'delete'])
+          && data.keys().hasAll(['delete'])
+          && (!('address' in data)
+              || data.address is map && isValidAddress(data.address))
+          && data['delete'] is bool;
+    }
+
+    allow read, delete: if request.auth.uid == uid;
+    allow create, update: if request.auth.uid == uid
+        && isValidUser(request.resource.data);
+    match /posts/{post} {
+      allow create: if true;
+    }
+  }
+}
+`,
+		},
+		{
+			name: "document type",
+			input: `rules_version = '2';
+service cloud.firestore {
+  type Post { title: string; }
+  match /posts/{id} is Post {
+    type Tag { name: string; }
+    allow create: if true;
+  }
+}
+`,
+			expected: `rules_version = '2';
+
+service cloud.firestore {
+  function isValidPost(data) {
+    return data.keys().hasOnly(['title'])
+        && data.keys().hasAll(['title'])
+        && data.title is string;
+  }
+  match /posts/{id} {
+    function isValidTag(data) {
+      return data.keys().hasOnly(['name'])
+          && data.keys().hasAll(['name'])
+          && data.name is string;
+    }
+    allow create: if true && isValidPost(request.resource.data);
+  }
+}
+`,
+		},
+		{
+			name: "field conditions",
+			input: `rules_version = '2';
+service cloud.firestore {
+  match /issues/{id} is Issue {
+    type Issue {
+      id: string {
+        invariant: ${value} == ${doc};
+        allowUpdateIf: ${value} == ${value.prev};
+      }
+      created?: timestamp { allowCreateIf: ${value} == ${now}; }
+      flag: bool { invariant: ${value}; }
+    }
+    allow write: if true;
+  }
+}
+`,
+			expected: `rules_version = '2';
+
+service cloud.firestore {
+  match /issues/{id} {
+    function isValidIssue(data) {
+      return data.keys().hasOnly(['id', 'created', 'flag'])
+          && data.keys().hasAll(['id', 'flag'])
+          && data.id is string
+          && data.id == request.resource.id
+          && (!('created' in data) || data.created is timestamp)
+          && data.flag is bool
+          && data.flag;
+    }
+
+    allow delete: if true;
+    allow create: if true
+        && isValidIssue(request.resource.data)
+        && (!('created' in request.resource.data)
+            || request.resource.data.created == request.time);
+    allow update: if true
+        && isValidIssue(request.resource.data)
+        && request.resource.data.id == resource.data.id;
+  }
+}
+`,
+		},
+		{
+			name: "modifiers",
+			input: `rules_version = '2';
+service cloud.firestore {
+  match /projects/{id} is Project {
+    type Project {
+      immutable serverTimestamp created: timestamp;
+      serverTimestamp modified: timestamp;
+      immutable authorUid owner: string;
+      readonly votes?: int;
+      immutable note?: string;
+    }
+    allow create, update: if request.auth != null;
+  }
+}
+`,
+			expected: `rules_version = '2';
+
+service cloud.firestore {
+  match /projects/{id} {
+    function isValidProject(data) {
+      return data.keys().hasOnly([
+        'created',
+        'modified',
+        'owner',
+        'votes',
+        'note',
+      ])
+          && data.keys().hasAll(['created', 'modified', 'owner'])
+          && data.created is timestamp
+          && data.modified is timestamp
+          && data.owner is string
+          && (!('votes' in data) || data.votes is int)
+          && (!('note' in data) || data.note is string);
+    }
+
+    allow create: if request.auth != null
+        && isValidProject(request.resource.data)
+        && request.resource.data.created == request.time
+        && request.resource.data.modified == request.time
+        && request.resource.data.owner == request.auth.uid
+        && !('votes' in request.resource.data);
+    allow update: if request.auth != null
+        && isValidProject(request.resource.data)
+        && request.resource.data.created == resource.data.created
+        && request.resource.data.modified == request.time
+        && request.resource.data.owner == resource.data.owner
+        && request.resource.data.get('votes', null) == resource.data.get('votes', null)
+        && request.resource.data.get('note', null) == resource.data.get('note', null);
+  }
+}
+`,
+		},
+		{
+			name: "nested field conditions",
+			input: `rules_version = '2';
+service cloud.firestore {
+  type Address {
+    city: string {
+      allowCreateIf: ${value} == 'x';
+      allowUpdateIf: ${value} == ${value.prev};
+    }
+  }
+  match /users/{uid} is User {
+    type User {
+      home: Address;
+      work?: Address;
+    }
+    allow create, update: if true;
+  }
+}
+`,
+			expected: `rules_version = '2';
+
+service cloud.firestore {
+  function isValidAddress(data) {
+    return data.keys().hasOnly(['city'])
+        && data.keys().hasAll(['city'])
+        && data.city is string;
+  }
+
+  match /users/{uid} {
+    function isValidUser(data) {
+      return data.keys().hasOnly(['home', 'work'])
+          && data.keys().hasAll(['home'])
+          && data.home is map
+          && isValidAddress(data.home)
+          && (!('work' in data)
+              || data.work is map && isValidAddress(data.work));
+    }
+
+    allow create: if true
+        && isValidUser(request.resource.data)
+        && request.resource.data.home.city == 'x'
+        && (!('work' in request.resource.data)
+            || request.resource.data.work.city == 'x');
+    allow update: if true
+        && isValidUser(request.resource.data)
+        && request.resource.data.home.city == resource.data.home.city
+        && (!('work' in request.resource.data)
+            || request.resource.data.work.city == resource.data.work.city);
+  }
+}
+`,
+		},
+		{
+			name: "nested modifiers",
+			input: `rules_version = '2';
+service cloud.firestore {
+  type Address {
+    readonly zip?: string;
+    immutable city: string;
+    serverTimestamp checked: timestamp;
+  }
+  match /users/{uid} is User {
+    type User {
+      home: Address;
+      addr?: Address;
+    }
+    allow create, update: if true;
+  }
+}
+`,
+			expected: `rules_version = '2';
+
+service cloud.firestore {
+  function isValidAddress(data) {
+    return data.keys().hasOnly(['zip', 'city', 'checked'])
+        && data.keys().hasAll(['city', 'checked'])
+        && (!('zip' in data) || data.zip is string)
+        && data.city is string
+        && data.checked is timestamp;
+  }
+
+  match /users/{uid} {
+    function isValidUser(data) {
+      return data.keys().hasOnly(['home', 'addr'])
+          && data.keys().hasAll(['home'])
+          && data.home is map
+          && isValidAddress(data.home)
+          && (!('addr' in data)
+              || data.addr is map && isValidAddress(data.addr));
+    }
+
+    allow create: if true
+        && isValidUser(request.resource.data)
+        && !('zip' in request.resource.data.home)
+        && request.resource.data.home.checked == request.time
+        && (!('addr' in request.resource.data)
+            || !('zip' in request.resource.data.addr))
+        && (!('addr' in request.resource.data)
+            || request.resource.data.addr.checked == request.time);
+    allow update: if true
+        && isValidUser(request.resource.data)
+        && request.resource.data.get(['home', 'zip'], null) == resource.data.get([
+          'home',
+          'zip',
+        ], null)
+        && request.resource.data.home.city == resource.data.home.city
+        && request.resource.data.home.checked == request.time
+        && request.resource.data.get(['addr', 'zip'], null) == resource.data.get([
+          'addr',
+          'zip',
+        ], null)
+        && request.resource.data.get(['addr', 'city'], null) == resource.data.get([
+          'addr',
+          'city',
+        ], null)
+        && (!('addr' in request.resource.data)
+            || request.resource.data.addr.checked == request.time);
+  }
+}
+`,
+		},
+		{
+			name: "types without is",
+			input: `rules_version = '2';
+service cloud.firestore {
+  match /a/{b} {
+    type A { a: int; }
+    type B { b: A; }
+    allow create: if true;
+  }
+}
+`,
+			expected: `rules_version = '2';
+
+service cloud.firestore {
+  match /a/{b} {
+    function isValidA(data) {
+      return data.keys().hasOnly(['a'])
+          && data.keys().hasAll(['a'])
+          && data.a is int;
+    }
+    function isValidB(data) {
+      return data.keys().hasOnly(['b'])
+          && data.keys().hasAll(['b'])
+          && data.b is map
+          && isValidA(data.b);
+    }
+    allow create: if true;
+  }
+}
+`,
+		},
+		{
+			name: "empty type",
+			input: `rules_version = '2';
+service cloud.firestore {
+  match /a/{b} is Empty {
+    type Empty {}
+    allow create: if true;
+  }
+}
+`,
+			expected: `rules_version = '2';
+
+service cloud.firestore {
+  match /a/{b} {
+    function isValidEmpty(data) {
+      return data.keys().hasOnly([]);
+    }
+    allow create: if true && isValidEmpty(request.resource.data);
+  }
+}
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, compile(t, test.input))
+		})
+	}
+}
+
+func TestRulesErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"undefined type", "match /a/{b} is T { type T { a: Foo; } }", "undefined type: Foo"},
+		{"function clash", "function isValidT(data) { return true; } type T { a: int; } match /a/{b} is T {}", "function isValidT, which validates type T, is already declared"},
+		{"placeholder outside a field", "match /a/{b} { allow read: if ${now} != null; }", "${now} outside the conditions of a field"},
+		{"type error", "match /a/{b} is T { type T { n: int; } allow update: if resource.data.n > 'a'; }", "invalid operation: resource.data.n > 'a' (mismatched types int and string)"},
+		{"outer function clash", "function isValidT() { return true; } match /a/{b} is T { type T { a: int; } }", "function isValidT, which validates type T, is already declared"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := fmt.Sprintf("rules_version = '2';\nservice cloud.firestore { %s }", test.input)
+			rules := parse(t, src)
+			diags := Rules(rules)
+			if assert.True(t, diags.HasErrors()) {
+				assert.Equal(t, test.expected, diags[0].Msg)
+			}
+			// The rules are left as they were.
+			assert.Equal(t, format.Rules(parse(t, src)), format.Rules(rules))
+		})
+	}
+}
+
+func TestHasTypes(t *testing.T) {
+	assert.True(t, HasTypes(parse(t, "rules_version = '2'; service cloud.firestore { match /a/{b} { type T {} } }")))
+	assert.False(t, HasTypes(parse(t, "rules_version = '2'; service cloud.firestore { match /a/{b} { allow read: if true; } }")))
+}
+
+func TestValidation(t *testing.T) {
+	rules := parse(t, `rules_version = '2';
+service cloud.firestore {
+  type Address { city: string<10>; }
+  match /databases/{database}/documents {
+    match /users/{uid} is User {
+      type User {
+        name: string<5>;
+        age?: int;
+        tags: list<string, 2>;
+        address?: Address;
+      }
+      allow write: if true;
+    }
+  }
+}
+`)
+	assert.Empty(t, Rules(rules))
+	tests := []struct {
+		data     eval.Map
+		expected bool
+	}{
+		{eval.Map{"name": "Al", "tags": eval.List{}}, true},
+		{eval.Map{"name": "Al", "tags": eval.List{"a", "b"}, "age": int64(3), "address": eval.Map{"city": "Paris"}}, true},
+		{eval.Map{"name": "Alexander", "tags": eval.List{}}, false},
+		{eval.Map{"tags": eval.List{}}, false},
+		{eval.Map{"name": "Al", "tags": eval.List{}, "extra": true}, false},
+		{eval.Map{"name": "Al", "tags": eval.List{"a", "b", "c"}}, false},
+		{eval.Map{"name": "Al", "tags": eval.List{}, "age": "old"}, false},
+		{eval.Map{"name": "Al", "tags": eval.List{}, "address": eval.Map{"city": "Llanfairpwllgwyngyll"}}, false},
+		{eval.Map{"name": "Al", "tags": eval.List{}, "address": "Paris"}, false},
+	}
+	for _, test := range tests {
+		for _, method := range []eval.Method{eval.MethodCreate, eval.MethodUpdate} {
+			req := eval.Request{Method: method, Path: "/users/alice", Data: test.data, Existing: eval.Map{}}
+			assert.Equal(t, test.expected, eval.Evaluate(rules, req).Allowed, "%s %s", method, eval.Format(test.data))
+		}
+	}
+	assert.True(t, eval.Evaluate(rules, eval.Request{Method: eval.MethodDelete, Path: "/users/alice"}).Allowed)
+}
+
+func TestFieldConditions(t *testing.T) {
+	rules := parse(t, `rules_version = '2';
+service cloud.firestore {
+  match /databases/{database}/documents {
+    match /posts/{id} is Post {
+      type Post {
+        author: string {
+          allowCreateIf: ${value} == request.auth.uid;
+          allowUpdateIf: ${value} == ${value.prev};
+        }
+        title: string { invariant: ${value}.size() > 2; }
+        created: timestamp {
+          allowCreateIf: ${value} == ${now};
+          allowUpdateIf: ${value} == ${created.prev};
+        }
+      }
+      allow create, update: if request.auth != null;
+    }
+  }
+}
+`)
+	assert.Empty(t, Rules(rules))
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	post := func(author, title string, created time.Time) eval.Map {
+		return eval.Map{"author": author, "title": title, "created": created}
+	}
+	existing := post("alice", "Hello", now.Add(-time.Hour))
+	tests := []struct {
+		name     string
+		method   eval.Method
+		data     eval.Map
+		expected bool
+	}{
+		{"create", eval.MethodCreate, post("alice", "Hello", now), true},
+		{"create for another author", eval.MethodCreate, post("bob", "Hello", now), false},
+		{"create in the past", eval.MethodCreate, post("alice", "Hello", now.Add(-time.Minute)), false},
+		{"create with a short title", eval.MethodCreate, post("alice", "Hi", now), false},
+		{"update", eval.MethodUpdate, post("alice", "Goodbye", now.Add(-time.Hour)), true},
+		{"update the author", eval.MethodUpdate, post("bob", "Hello", now.Add(-time.Hour)), false},
+		{"update the creation time", eval.MethodUpdate, post("alice", "Hello", now), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := eval.Request{
+				Method:   test.method,
+				Path:     "/posts/p1",
+				Auth:     eval.Map{"uid": "alice"},
+				Time:     now,
+				Data:     test.data,
+				Existing: existing,
+			}
+			assert.Equal(t, test.expected, eval.Evaluate(rules, req).Allowed)
+		})
+	}
+}
+
+func TestNestedFieldConditions(t *testing.T) {
+	rules := parse(t, `rules_version = '2';
+service cloud.firestore {
+  type Address {
+    city: string {
+      allowCreateIf: ${value} == 'x';
+      allowUpdateIf: ${value} == ${value.prev};
+    }
+  }
+  match /databases/{database}/documents {
+    match /users/{uid} is User {
+      type User {
+        home: Address;
+        work?: Address;
+      }
+      allow create, update: if true;
+    }
+  }
+}
+`)
+	assert.Empty(t, Rules(rules))
+	user := func(home string, work ...string) eval.Map {
+		m := eval.Map{"home": eval.Map{"city": home}}
+		if len(work) > 0 {
+			m["work"] = eval.Map{"city": work[0]}
+		}
+		return m
+	}
+	existing := user("x", "x")
+	tests := []struct {
+		name     string
+		method   eval.Method
+		data     eval.Map
+		expected bool
+	}{
+		{"create", eval.MethodCreate, user("x"), true},
+		{"create with work", eval.MethodCreate, user("x", "x"), true},
+		{"create in another city", eval.MethodCreate, user("y"), false},
+		{"create with work in another city", eval.MethodCreate, user("x", "y"), false},
+		{"update", eval.MethodUpdate, user("x", "x"), true},
+		{"update without work", eval.MethodUpdate, user("x"), true},
+		{"move home", eval.MethodUpdate, user("y", "x"), false},
+		{"move work", eval.MethodUpdate, user("x", "y"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := eval.Request{
+				Method:   test.method,
+				Path:     "/users/u1",
+				Time:     time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+				Data:     test.data,
+				Existing: existing,
+			}
+			assert.Equal(t, test.expected, eval.Evaluate(rules, req).Allowed)
+		})
+	}
+}
+
+func TestNestedModifiers(t *testing.T) {
+	rules := parse(t, `rules_version = '2';
+service cloud.firestore {
+  type Address {
+    readonly zip?: string;
+    immutable city: string;
+  }
+  match /databases/{database}/documents {
+    match /users/{uid} is User {
+      type User {
+        name: string;
+        addr?: Address;
+      }
+      allow create, update: if true;
+    }
+  }
+}
+`)
+	assert.Empty(t, Rules(rules))
+	user := func(addr eval.Value) eval.Map {
+		m := eval.Map{"name": "Al"}
+		if addr != nil {
+			m["addr"] = addr
+		}
+		return m
+	}
+	existing := user(eval.Map{"city": "Paris", "zip": "75001"})
+	tests := []struct {
+		name     string
+		method   eval.Method
+		data     eval.Map
+		expected bool
+	}{
+		{"create", eval.MethodCreate, user(eval.Map{"city": "Paris"}), true},
+		{"create without an address", eval.MethodCreate, user(nil), true},
+		{"create with a zip", eval.MethodCreate, user(eval.Map{"city": "Paris", "zip": "75001"}), false},
+		{"update", eval.MethodUpdate, user(eval.Map{"city": "Paris", "zip": "75001"}), true},
+		{"update the zip", eval.MethodUpdate, user(eval.Map{"city": "Paris", "zip": "75002"}), false},
+		{"remove the zip", eval.MethodUpdate, user(eval.Map{"city": "Paris"}), false},
+		{"update the city", eval.MethodUpdate, user(eval.Map{"city": "Lyon", "zip": "75001"}), false},
+		{"remove the address", eval.MethodUpdate, user(nil), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := eval.Request{
+				Method:   test.method,
+				Path:     "/users/u1",
+				Time:     time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+				Data:     test.data,
+				Existing: existing,
+			}
+			assert.Equal(t, test.expected, eval.Evaluate(rules, req).Allowed)
+		})
+	}
+}
+
+func TestExample(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/issues.rules")
+	assert.Nil(t, err)
+	rules := parse(t, string(src))
+	assert.Empty(t, Rules(rules))
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	issue := eval.Map{"id": "abcdefghij", "author": "alice", "created": now, "modified": now, "title": "A long enough title"}
+	with := func(key string, value eval.Value) eval.Map {
+		result := eval.Map{}
+		for k, v := range issue {
+			result[k] = v
+		}
+		result[key] = value
+		return result
+	}
+	tests := []struct {
+		name     string
+		data     eval.Map
+		expected bool
+	}{
+		{"create", issue, true},
+		{"create for another author", with("author", "bob"), false},
+		{"create with another id", with("id", "0123456789"), false},
+		{"create with a short title", with("title", "Short"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := eval.Request{
+				Method: eval.MethodCreate,
+				Path:   "/issues/abcdefghij",
+				Auth:   eval.Map{"uid": "alice"},
+				Time:   now,
+				Data:   test.data,
+			}
+			assert.Equal(t, test.expected, eval.Evaluate(rules, req).Allowed)
+		})
+	}
+}
+
+func TestModifiers(t *testing.T) {
+	rules := parse(t, `rules_version = '2';
+service cloud.firestore {
+  match /databases/{database}/documents {
+    match /projects/{id} is Project {
+      type Project {
+        immutable serverTimestamp created: timestamp;
+        serverTimestamp modified: timestamp;
+        immutable authorUid owner: string;
+        readonly votes?: int;
+      }
+      allow create, update: if true;
+    }
+  }
+}
+`)
+	assert.Empty(t, Rules(rules))
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	earlier := now.Add(-time.Hour)
+	existing := eval.Map{"created": earlier, "modified": earlier, "owner": "alice", "votes": int64(3)}
+	with := func(m eval.Map, key string, value eval.Value) eval.Map {
+		result := eval.Map{}
+		for k, v := range m {
+			result[k] = v
+		}
+		if value == nil {
+			delete(result, key)
+		} else {
+			result[key] = value
+		}
+		return result
+	}
+	created := eval.Map{"created": now, "modified": now, "owner": "alice"}
+	updated := with(existing, "modified", now)
+	tests := []struct {
+		name     string
+		method   eval.Method
+		data     eval.Map
+		expected bool
+	}{
+		{"create", eval.MethodCreate, created, true},
+		{"create at another time", eval.MethodCreate, with(created, "created", earlier), false},
+		{"create for another user", eval.MethodCreate, with(created, "owner", "bob"), false},
+		{"create with votes", eval.MethodCreate, with(created, "votes", int64(1)), false},
+		{"update", eval.MethodUpdate, updated, true},
+		{"update without the time", eval.MethodUpdate, existing, false},
+		{"update the creation time", eval.MethodUpdate, with(updated, "created", now), false},
+		{"update the owner", eval.MethodUpdate, with(updated, "owner", "bob"), false},
+		{"update the votes", eval.MethodUpdate, with(updated, "votes", int64(4)), false},
+		{"remove the votes", eval.MethodUpdate, with(updated, "votes", nil), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := eval.Request{
+				Method:   test.method,
+				Path:     "/projects/p1",
+				Auth:     eval.Map{"uid": "alice"},
+				Time:     now,
+				Data:     test.data,
+				Existing: existing,
+			}
+			assert.Equal(t, test.expected, eval.Evaluate(rules, req).Allowed)
+		})
+	}
+}
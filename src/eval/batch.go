@@ -0,0 +1,107 @@
+package eval
+
+import (
+	"time"
+
+	"firestore-rules/src/parser"
+)
+
+// Batch describes a batched write or transaction: operations made together
+// by one client, which commit only if the rules allow all of them.
+type Batch struct {
+	// Database, Auth, Time and Store are as in Request, and are shared by
+	// every operation.
+	Database string
+	Auth     Map
+	Time     time.Time
+	Store    DocumentStore
+	// Operations are the writes of the batch, in order. A transaction may
+	// also read documents with get operations.
+	Operations []Operation
+}
+
+// Operation is one access to a document made by a Batch.
+type Operation struct {
+	Method Method
+	// Path is the path of the document, as in Request.
+	Path string
+	// Data is the document as it would be after a create or update.
+	Data Map
+}
+
+// BatchDecision is the outcome of checking a Batch.
+type BatchDecision struct {
+	// Committed reports whether every operation is allowed, so that the
+	// batch commits.
+	Committed bool
+	// Decisions holds the decision on each operation, in order.
+	Decisions []Decision
+}
+
+func (d BatchDecision) String() string {
+	if d.Committed {
+		return "commit"
+	}
+	return "reject"
+}
+
+// EvaluateBatch decides whether rules allow each operation of b, and so
+// whether the batch commits. Each operation is decided as Evaluate decides a
+// Request, with these differences, which are those of Firestore:
+//
+//   - resource is the document as stored before the batch, read from
+//     b.Store.
+//   - getAfter() and existsAfter() see the state after the whole batch, with
+//     every operation applied in order.
+//   - request.time is the same for every operation.
+//   - the documents read by all the operations together are limited to
+//     MaxBatchDocumentAccess, as well as those read by each to
+//     MaxDocumentAccess.
+func EvaluateBatch(rules *parser.Rules, b Batch) BatchDecision {
+	return evaluateBatch(rules, b, false)
+}
+
+// EvaluateBatchTrace is like EvaluateBatch, but each decision holds a Trace.
+func EvaluateBatchTrace(rules *parser.Rules, b Batch) BatchDecision {
+	return evaluateBatch(rules, b, true)
+}
+
+func evaluateBatch(rules *parser.Rules, b Batch, trace bool) BatchDecision {
+	if b.Time.IsZero() {
+		b.Time = time.Now()
+	}
+	writes := map[Path]Map{}
+	for _, op := range b.Operations {
+		req := b.request(op)
+		for path, data := range pendingWrites(req, documentPath(req)) {
+			writes[path] = data
+		}
+	}
+	shared := newDocuments(b.Store, writes, MaxBatchDocumentAccess)
+	result := BatchDecision{Committed: true}
+	for _, op := range b.Operations {
+		req := b.request(op)
+		if b.Store != nil {
+			req.Existing, _ = b.Store.Get(documentPath(req))
+		}
+		docs := newDocuments(b.Store, writes, MaxDocumentAccess)
+		docs.batch = shared
+		d := evaluate(rules, req, docs, trace)
+		result.Decisions = append(result.Decisions, d)
+		result.Committed = result.Committed && d.Allowed
+	}
+	return result
+}
+
+// request returns the Request for op made as part of b.
+func (b Batch) request(op Operation) Request {
+	return Request{
+		Method:   op.Method,
+		Path:     op.Path,
+		Database: b.Database,
+		Auth:     b.Auth,
+		Data:     op.Data,
+		Time:     b.Time,
+		Store:    b.Store,
+	}
+}
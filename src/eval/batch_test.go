@@ -0,0 +1,123 @@
+package eval
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateBatch(t *testing.T) {
+	rules := parseRules(t, `rules_version = '2';
+service cloud.firestore {
+  match /databases/{database}/documents {
+    function doc(collection, id) {
+      return /databases/$(database)/documents/$(collection)/$(id);
+    }
+    match /rooms/{room} {
+      allow create: if existsAfter(doc('members', request.auth.uid + '_' + room));
+      allow delete: if !existsAfter(doc('members', request.auth.uid + '_' + room));
+      allow update: if resource.data.count + 1 == request.resource.data.count;
+    }
+    match /members/{id} {
+      allow create: if getAfter(doc('rooms', request.resource.data.room)).data.owner == request.auth.uid;
+      allow delete: if true;
+    }
+    match /log/{id} {
+      allow create: if request.resource.data.time == request.time;
+    }
+    match /reads/{n} {
+      function reads(k) {
+        return k == 0 || !exists(doc('reads', string(int(n) * 100 + k))) && reads(k - 1);
+      }
+      allow create: if reads(10);
+    }
+  }
+}
+`)
+	alice := Map{"uid": "alice"}
+	store := mapStore{
+		"/databases/(default)/documents/rooms/r2":         {"count": int64(1)},
+		"/databases/(default)/documents/members/alice_r2": {},
+	}
+	now := time.Date(2020, 9, 13, 12, 0, 0, 0, time.UTC)
+	reads := func(n int) []Operation {
+		var ops []Operation
+		for k := 1; k <= n; k++ {
+			ops = append(ops, Operation{MethodCreate, fmt.Sprintf("/reads/%d", k), Map{}})
+		}
+		return ops
+	}
+	tests := []struct {
+		name      string
+		ops       []Operation
+		decisions string
+		committed bool
+	}{
+		{"each write sees the other", []Operation{
+			{MethodCreate, "/rooms/r1", Map{"owner": "alice"}},
+			{MethodCreate, "/members/alice_r1", Map{"room": "r1"}},
+		}, "[allow allow]", true},
+		{"alone it is denied", []Operation{
+			{MethodCreate, "/rooms/r1", Map{"owner": "alice"}},
+		}, "[deny]", false},
+		{"one denial rejects the batch", []Operation{
+			{MethodCreate, "/rooms/r1", Map{"owner": "bob"}},
+			{MethodCreate, "/members/alice_r1", Map{"room": "r1"}},
+		}, "[allow deny]", false},
+		{"later writes win", []Operation{
+			{MethodCreate, "/rooms/r1", Map{"owner": "alice"}},
+			{MethodCreate, "/members/alice_r1", Map{"room": "r1"}},
+			{MethodDelete, "/members/alice_r1", nil},
+		}, "[deny allow allow]", false},
+		{"resource is the stored document", []Operation{
+			{MethodUpdate, "/rooms/r2", Map{"count": int64(2)}},
+		}, "[allow]", true},
+		{"delete", []Operation{
+			{MethodDelete, "/members/alice_r2", nil},
+			{MethodDelete, "/rooms/r2", nil},
+		}, "[allow allow]", true},
+		{"shared time", []Operation{
+			{MethodCreate, "/log/a", Map{"time": now}},
+			{MethodCreate, "/log/b", Map{"time": now}},
+		}, "[allow allow]", true},
+		{"each operation reads ten", reads(2), "[allow allow]", true},
+		{"the batch reads twenty-one", reads(3), "[allow allow deny]", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := EvaluateBatch(rules, Batch{Auth: alice, Time: now, Store: store, Operations: test.ops})
+			decisions := []string{}
+			for _, d := range d.Decisions {
+				decisions = append(decisions, d.String())
+			}
+			assert.Equal(t, test.decisions, fmt.Sprint(decisions))
+			assert.Equal(t, test.committed, d.Committed)
+		})
+	}
+}
+
+func TestEvaluateBatchTrace(t *testing.T) {
+	rules := parseRules(t, `rules_version = '2';
+service cloud.firestore {
+  match /databases/{database}/documents {
+    match /a/{id} {
+      allow create: if id == 'x';
+    }
+  }
+}
+`)
+	d := EvaluateBatchTrace(rules, Batch{Operations: []Operation{
+		{MethodCreate, "/a/x", Map{}},
+		{MethodCreate, "/a/y", Map{}},
+	}})
+	assert.False(t, d.Committed)
+	assert.Equal(t, "reject", d.String())
+	if assert.Len(t, d.Decisions, 2) {
+		assert.True(t, d.Decisions[0].Trace.Allowed)
+		assert.False(t, d.Decisions[1].Trace.Allowed)
+		assert.Equal(t, Path("/databases/(default)/documents/a/y"), d.Decisions[1].Trace.Path)
+	}
+	assert.Nil(t, EvaluateBatch(rules, Batch{Operations: []Operation{{MethodCreate, "/a/x", Map{}}}}).Decisions[0].Trace)
+}
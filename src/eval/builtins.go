@@ -0,0 +1,721 @@
+package eval
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"firestore-rules/src/builtins"
+	"firestore-rules/src/parser"
+	"firestore-rules/src/types"
+)
+
+// impl is the implementation of a built-in function or method. recv is nil
+// for functions. The arguments have already been checked against the
+// parameters in the catalog, so an implementation may assume their kinds,
+// except that a float parameter may receive an int.
+type impl func(env *Env, recv Value, args []Value) Value
+
+// functions holds the implementations of the global functions and the
+// functions in namespaces, by qualified name, and methods those of the
+// methods, by receiver kind and name.
+var (
+	functions map[string]impl
+	methods   map[types.Kind]map[string]impl
+)
+
+func init() {
+	functions = map[string]impl{
+		"debug": func(env *Env, _ Value, args []Value) Value {
+			env.debug(args[0])
+			return args[0]
+		},
+		"exists":      documentAccess("exists", false, true),
+		"existsAfter": documentAccess("existsAfter", true, true),
+		"get":         documentAccess("get", false, false),
+		"getAfter":    documentAccess("getAfter", true, false),
+		"float":       toFloat,
+		"int":         toInt,
+		"path": func(_ *Env, _ Value, args []Value) Value {
+			return Path(args[0].(string))
+		},
+		"string": toString,
+
+		"duration.abs": func(_ *Env, _ Value, args []Value) Value {
+			if d := args[0].(time.Duration); d < 0 {
+				return -d
+			}
+			return args[0]
+		},
+		"duration.time": func(_ *Env, _ Value, args []Value) Value {
+			return time.Duration(args[0].(int64))*time.Hour +
+				time.Duration(args[1].(int64))*time.Minute +
+				time.Duration(args[2].(int64))*time.Second +
+				time.Duration(args[3].(int64))
+		},
+		"duration.value": durationValue,
+
+		"hashing.crc32": hash(func(b []byte) []byte {
+			return bigEndian(crc32.ChecksumIEEE(b))
+		}),
+		"hashing.crc32c": hash(func(b []byte) []byte {
+			return bigEndian(crc32.Checksum(b, crc32.MakeTable(crc32.Castagnoli)))
+		}),
+		"hashing.md5": hash(func(b []byte) []byte {
+			sum := md5.Sum(b)
+			return sum[:]
+		}),
+		"hashing.sha256": hash(func(b []byte) []byte {
+			sum := sha256.Sum256(b)
+			return sum[:]
+		}),
+
+		"latlng.value": func(_ *Env, _ Value, args []Value) Value {
+			lat, lng := number(args[0]), number(args[1])
+			if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+				return errorf("latlng(%s, %s) out of range", Format(args[0]), Format(args[1]))
+			}
+			return LatLng{lat, lng}
+		},
+
+		"math.abs": func(_ *Env, _ Value, args []Value) Value {
+			if n, ok := args[0].(int64); ok {
+				if n == math.MinInt64 {
+					return errorf("integer overflow")
+				}
+				if n < 0 {
+					return -n
+				}
+				return n
+			}
+			return math.Abs(args[0].(float64))
+		},
+		"math.ceil":  rounding(math.Ceil),
+		"math.floor": rounding(math.Floor),
+		"math.round": rounding(math.Round),
+		"math.isInfinite": func(_ *Env, _ Value, args []Value) Value {
+			return math.IsInf(number(args[0]), 0)
+		},
+		"math.isNaN": func(_ *Env, _ Value, args []Value) Value {
+			return math.IsNaN(number(args[0]))
+		},
+		"math.pow": func(_ *Env, _ Value, args []Value) Value {
+			return math.Pow(number(args[0]), number(args[1]))
+		},
+		"math.sqrt": func(_ *Env, _ Value, args []Value) Value {
+			return math.Sqrt(number(args[0]))
+		},
+
+		"timestamp.date": func(_ *Env, _ Value, args []Value) Value {
+			year, month, day := args[0].(int64), args[1].(int64), args[2].(int64)
+			t := time.Date(int(year), time.Month(month), int(day), 0, 0, 0, 0, time.UTC)
+			if t.Year() != int(year) || int64(t.Month()) != month || int64(t.Day()) != day {
+				return errorf("invalid date %d-%d-%d", year, month, day)
+			}
+			return t
+		},
+		"timestamp.value": func(_ *Env, _ Value, args []Value) Value {
+			ms := args[0].(int64)
+			return time.Unix(ms/1000, ms%1000*int64(time.Millisecond)).UTC()
+		},
+	}
+	methods = map[types.Kind]map[string]impl{
+		types.Bytes: {
+			"size": func(_ *Env, recv Value, _ []Value) Value {
+				return int64(len(recv.(Bytes)))
+			},
+			"toBase64": func(_ *Env, recv Value, _ []Value) Value {
+				return base64.StdEncoding.EncodeToString(recv.(Bytes))
+			},
+			"toHexString": func(_ *Env, recv Value, _ []Value) Value {
+				return strings.ToUpper(hex.EncodeToString(recv.(Bytes)))
+			},
+		},
+		types.Duration: {
+			"nanos": func(_ *Env, recv Value, _ []Value) Value {
+				return int64(recv.(time.Duration) % time.Second)
+			},
+			"seconds": func(_ *Env, recv Value, _ []Value) Value {
+				return int64(recv.(time.Duration) / time.Second)
+			},
+		},
+		types.LatLng: {
+			"distance": func(_ *Env, recv Value, args []Value) Value {
+				return distance(recv.(LatLng), args[0].(LatLng))
+			},
+			"latitude": func(_ *Env, recv Value, _ []Value) Value {
+				return recv.(LatLng).Lat
+			},
+			"longitude": func(_ *Env, recv Value, _ []Value) Value {
+				return recv.(LatLng).Lng
+			},
+		},
+		types.List: {
+			"concat": func(_ *Env, recv Value, args []Value) Value {
+				return append(append(List{}, recv.(List)...), args[0].(List)...)
+			},
+			"hasAll": func(_ *Env, recv Value, args []Value) Value {
+				return hasAll(NewSet(recv.(List)), elems(args[0]))
+			},
+			"hasAny": func(_ *Env, recv Value, args []Value) Value {
+				return hasAny(NewSet(recv.(List)), elems(args[0]))
+			},
+			"hasOnly": func(_ *Env, recv Value, args []Value) Value {
+				return hasAll(NewSet(elems(args[0])), recv.(List))
+			},
+			"join": func(_ *Env, recv Value, args []Value) Value {
+				list := recv.(List)
+				s := make([]string, len(list))
+				for k, v := range list {
+					str, ok := v.(string)
+					if !ok {
+						return errorf("join of list containing %s", TypeName(v))
+					}
+					s[k] = str
+				}
+				return strings.Join(s, args[0].(string))
+			},
+			"removeAll": func(_ *Env, recv Value, args []Value) Value {
+				remove := NewSet(args[0].(List))
+				result := List{}
+				for _, v := range recv.(List) {
+					if !remove.Contains(v) {
+						result = append(result, v)
+					}
+				}
+				return result
+			},
+			"size": func(_ *Env, recv Value, _ []Value) Value {
+				return int64(len(recv.(List)))
+			},
+			"toSet": func(_ *Env, recv Value, _ []Value) Value {
+				return NewSet(recv.(List))
+			},
+		},
+		types.Map: {
+			"diff": func(_ *Env, recv Value, args []Value) Value {
+				return MapDiff{recv.(Map), args[0].(Map)}
+			},
+			"get":  mapGet,
+			"keys": mapKeys,
+			"size": func(_ *Env, recv Value, _ []Value) Value {
+				return int64(len(recv.(Map)))
+			},
+			"values": func(_ *Env, recv Value, _ []Value) Value {
+				m := recv.(Map)
+				values := List{}
+				for _, key := range sortedKeys(m) {
+					values = append(values, m[key])
+				}
+				return values
+			},
+		},
+		types.MapDiff: {
+			"addedKeys":     diffKeys(func(inLhs, inRhs, equal bool) bool { return inLhs && !inRhs }),
+			"affectedKeys":  diffKeys(func(inLhs, inRhs, equal bool) bool { return !equal }),
+			"changedKeys":   diffKeys(func(inLhs, inRhs, equal bool) bool { return inLhs && inRhs && !equal }),
+			"removedKeys":   diffKeys(func(inLhs, inRhs, equal bool) bool { return !inLhs && inRhs }),
+			"unchangedKeys": diffKeys(func(inLhs, inRhs, equal bool) bool { return equal }),
+		},
+		types.Path: {
+			"bind": pathBind,
+		},
+		types.Set: {
+			"difference": func(_ *Env, recv Value, args []Value) Value {
+				other := args[0].(*Set)
+				result := NewSet(nil)
+				for _, v := range recv.(*Set).Elems() {
+					if !other.Contains(v) {
+						result.Add(v)
+					}
+				}
+				return result
+			},
+			"hasAll": func(_ *Env, recv Value, args []Value) Value {
+				return hasAll(recv.(*Set), elems(args[0]))
+			},
+			"hasAny": func(_ *Env, recv Value, args []Value) Value {
+				return hasAny(recv.(*Set), elems(args[0]))
+			},
+			"hasOnly": func(_ *Env, recv Value, args []Value) Value {
+				return hasAll(NewSet(elems(args[0])), recv.(*Set).Elems())
+			},
+			"intersection": func(_ *Env, recv Value, args []Value) Value {
+				other := args[0].(*Set)
+				result := NewSet(nil)
+				for _, v := range recv.(*Set).Elems() {
+					if other.Contains(v) {
+						result.Add(v)
+					}
+				}
+				return result
+			},
+			"size": func(_ *Env, recv Value, _ []Value) Value {
+				return int64(recv.(*Set).Len())
+			},
+			"union": func(_ *Env, recv Value, args []Value) Value {
+				result := NewSet(recv.(*Set).Elems())
+				for _, v := range args[0].(*Set).Elems() {
+					result.Add(v)
+				}
+				return result
+			},
+		},
+		types.String: {
+			"lower": func(_ *Env, recv Value, _ []Value) Value {
+				return strings.ToLower(recv.(string))
+			},
+			"matches": func(_ *Env, recv Value, args []Value) Value {
+				re, err := compile("^(?:" + args[0].(string) + ")$")
+				if err != nil {
+					return err
+				}
+				return re.MatchString(recv.(string))
+			},
+			"replace": func(_ *Env, recv Value, args []Value) Value {
+				re, err := compile(args[0].(string))
+				if err != nil {
+					return err
+				}
+				return re.ReplaceAllString(recv.(string), args[1].(string))
+			},
+			"size": func(_ *Env, recv Value, _ []Value) Value {
+				return int64(utf8.RuneCountInString(recv.(string)))
+			},
+			"split": func(_ *Env, recv Value, args []Value) Value {
+				re, err := compile(args[0].(string))
+				if err != nil {
+					return err
+				}
+				list := List{}
+				for _, s := range re.Split(recv.(string), -1) {
+					list = append(list, s)
+				}
+				return list
+			},
+			"toUtf8": func(_ *Env, recv Value, _ []Value) Value {
+				return Bytes(recv.(string))
+			},
+			"trim": func(_ *Env, recv Value, _ []Value) Value {
+				return strings.TrimSpace(recv.(string))
+			},
+			"upper": func(_ *Env, recv Value, _ []Value) Value {
+				return strings.ToUpper(recv.(string))
+			},
+		},
+		types.Timestamp: {},
+	}
+
+	// The timestamp methods work in UTC.
+	timestampMethods := map[string]func(t time.Time) Value{
+		"date": func(t time.Time) Value {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		},
+		"day":       func(t time.Time) Value { return int64(t.Day()) },
+		"dayOfWeek": func(t time.Time) Value { return int64((t.Weekday()+6)%7 + 1) },
+		"dayOfYear": func(t time.Time) Value { return int64(t.YearDay()) },
+		"hours":     func(t time.Time) Value { return int64(t.Hour()) },
+		"minutes":   func(t time.Time) Value { return int64(t.Minute()) },
+		"month":     func(t time.Time) Value { return int64(t.Month()) },
+		"nanos":     func(t time.Time) Value { return int64(t.Nanosecond()) },
+		"seconds":   func(t time.Time) Value { return int64(t.Second()) },
+		"time": func(t time.Time) Value {
+			return t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))
+		},
+		"toMillis": func(t time.Time) Value { return t.UnixNano() / int64(time.Millisecond) },
+		"year":     func(t time.Time) Value { return int64(t.Year()) },
+	}
+	for name, f := range timestampMethods {
+		f := f
+		methods[types.Timestamp][name] = func(_ *Env, recv Value, _ []Value) Value {
+			return f(recv.(time.Time).UTC())
+		}
+	}
+}
+
+// lookupImpl returns the implementation of f, or nil if there is none.
+func lookupImpl(f *builtins.Func) impl {
+	if f.IsMethod() {
+		return methods[f.Receiver][f.Name]
+	}
+	return functions[f.QualifiedName()]
+}
+
+// call evaluates a call of a user function, a global function, a function in
+// a namespace or a method.
+func call(e *parser.FunctionCall, env *Env) Value {
+	switch fn := e.Fn.(type) {
+	case *parser.Id:
+		name := fn.Name.Value
+		if c, ok := env.function(name); ok {
+			return callUser(e, c, env)
+		}
+		if f := builtins.LookupGlobal(name); f != nil {
+			return callBuiltin(e, f, env, nil)
+		}
+		return errorf("function %s is not defined", name)
+	case *parser.BinaryExpr:
+		if fn.Op.Kind != parser.Dot {
+			break
+		}
+		name := fn.Rhs.(*parser.Id).Name.Value
+		if id, ok := fn.Lhs.(*parser.Id); ok && builtins.LookupNamespace(id.Name.Value) != nil {
+			if _, shadowed := env.Lookup(id.Name.Value); !shadowed {
+				f := builtins.LookupFunc(id.Name.Value, name)
+				if f == nil {
+					return errorf("function %s.%s is not defined", id.Name.Value, name)
+				}
+				return callBuiltin(e, f, env, nil)
+			}
+		}
+		recv := Eval(fn.Lhs, env)
+		if IsError(recv) {
+			return recv
+		}
+		f := builtins.LookupMethod(kindOf(recv), name)
+		if f == nil {
+			return errorf("%s has no method %s", TypeName(recv), name)
+		}
+		return callBuiltin(e, f, env, recv)
+	}
+	return errorf("%s is not a function", e.Fn)
+}
+
+// callUser calls the user function c. Its body is evaluated in a new
+// environment inside the one the function was defined in.
+func callUser(e *parser.FunctionCall, c closure, env *Env) Value {
+	fd := c.fd
+	if len(e.Args) != len(fd.Params) {
+		return errorf("%s takes %d arguments, not %d", fd.Name.Value, len(fd.Params), len(e.Args))
+	}
+	if env.depth >= maxCallDepth {
+		return errorf("call of %s exceeds the maximum call depth of %d", fd.Name.Value, maxCallDepth)
+	}
+	body := NewEnv(c.env)
+	body.depth = env.depth + 1
+	for k, arg := range e.Args {
+		v := Eval(arg, env)
+		if IsError(v) {
+			return v
+		}
+		body.Set(fd.Params[k].Name.Value, v)
+	}
+	for _, let := range fd.Lets {
+		v := Eval(let.Value, body)
+		if IsError(v) {
+			return v
+		}
+		body.Set(let.Name.Value, v)
+	}
+	return Eval(fd.Return, body)
+}
+
+// callBuiltin calls the built-in f, checking its arguments against the
+// catalog first.
+func callBuiltin(e *parser.FunctionCall, f *builtins.Func, env *Env, recv Value) Value {
+	if len(e.Args) != len(f.Params) {
+		return errorf("%s takes %d arguments, not %d", f.QualifiedName(), len(f.Params), len(e.Args))
+	}
+	args := make([]Value, len(e.Args))
+	for k, arg := range e.Args {
+		v := Eval(arg, env)
+		if IsError(v) {
+			return v
+		}
+		if !accepts(f.Params[k], v) {
+			return errorf("cannot use %s as argument %s of %s", TypeName(v), f.Params[k].Name, f.Signature())
+		}
+		args[k] = v
+	}
+	do := lookupImpl(f)
+	if do == nil {
+		return errorf("%s is not implemented", f.QualifiedName())
+	}
+	return do(env, recv, args)
+}
+
+func accepts(p builtins.Param, v Value) bool {
+	if len(p.Accepts) == 0 {
+		return true
+	}
+	kind := kindOf(v)
+	for _, k := range p.Accepts {
+		if k == kind || k == types.Float && kind == types.Int {
+			return true
+		}
+	}
+	return false
+}
+
+// kindOf returns the kind of the static type of v.
+func kindOf(v Value) types.Kind {
+	switch v.(type) {
+	case NullValue:
+		return types.Null
+	case bool:
+		return types.Bool
+	case int64:
+		return types.Int
+	case float64:
+		return types.Float
+	case string:
+		return types.String
+	case Bytes:
+		return types.Bytes
+	case Path:
+		return types.Path
+	case time.Time:
+		return types.Timestamp
+	case time.Duration:
+		return types.Duration
+	case LatLng:
+		return types.LatLng
+	case List:
+		return types.List
+	case *Set:
+		return types.Set
+	case Map:
+		return types.Map
+	case MapDiff:
+		return types.MapDiff
+	}
+	return types.Invalid
+}
+
+func number(v Value) float64 {
+	if n, ok := v.(int64); ok {
+		return float64(n)
+	}
+	return v.(float64)
+}
+
+func toFloat(_ *Env, _ Value, args []Value) Value {
+	switch v := args[0].(type) {
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return errorf("cannot convert %s to float", quote(v))
+		}
+		return f
+	default:
+		return number(v)
+	}
+}
+
+func toInt(_ *Env, _ Value, args []Value) Value {
+	switch v := args[0].(type) {
+	case int64:
+		return v
+	case float64:
+		if math.IsNaN(v) || v >= math.MaxInt64 || v < math.MinInt64 {
+			return errorf("cannot convert %s to int", Format(v))
+		}
+		return int64(v)
+	default:
+		n, err := strconv.ParseInt(v.(string), 10, 64)
+		if err != nil {
+			return errorf("cannot convert %s to int", quote(v.(string)))
+		}
+		return n
+	}
+}
+
+func toString(_ *Env, _ Value, args []Value) Value {
+	switch v := args[0].(type) {
+	case string:
+		return v
+	case Path:
+		return string(v)
+	default:
+		return Format(v)
+	}
+}
+
+func durationValue(_ *Env, _ Value, args []Value) Value {
+	units := map[string]time.Duration{
+		"w":  7 * 24 * time.Hour,
+		"d":  24 * time.Hour,
+		"h":  time.Hour,
+		"m":  time.Minute,
+		"s":  time.Second,
+		"ms": time.Millisecond,
+		"ns": time.Nanosecond,
+	}
+	unit, ok := units[args[1].(string)]
+	if !ok {
+		return errorf("unknown duration unit %s", quote(args[1].(string)))
+	}
+	return time.Duration(args[0].(int64)) * unit
+}
+
+func hash(sum func([]byte) []byte) impl {
+	return func(_ *Env, _ Value, args []Value) Value {
+		switch v := args[0].(type) {
+		case string:
+			return Bytes(sum([]byte(v)))
+		default:
+			return Bytes(sum(v.(Bytes)))
+		}
+	}
+}
+
+func bigEndian(n uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, n)
+	return b
+}
+
+func rounding(round func(float64) float64) impl {
+	return func(env *Env, recv Value, args []Value) Value {
+		if n, ok := args[0].(int64); ok {
+			return n
+		}
+		return toInt(env, recv, []Value{round(args[0].(float64))})
+	}
+}
+
+// earthRadius is the mean radius of the Earth in meters.
+const earthRadius = 6371008.8
+
+// distance returns the great-circle distance between a and b in meters.
+func distance(a, b LatLng) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := rad(b.Lat - a.Lat)
+	dLng := rad(b.Lng - a.Lng)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(a.Lat))*math.Cos(rad(b.Lat))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// elems returns the elements of a list or set.
+func elems(v Value) List {
+	if s, ok := v.(*Set); ok {
+		return s.Elems()
+	}
+	return v.(List)
+}
+
+func hasAll(s *Set, values List) bool {
+	for _, v := range values {
+		if !s.Contains(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasAny(s *Set, values List) bool {
+	for _, v := range values {
+		if s.Contains(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func mapGet(_ *Env, recv Value, args []Value) Value {
+	var keys List
+	switch key := args[0].(type) {
+	case string:
+		keys = List{key}
+	default:
+		keys = key.(List)
+	}
+	var v Value = recv
+	for _, key := range keys {
+		m, ok := v.(Map)
+		if !ok {
+			return args[1]
+		}
+		s, ok := key.(string)
+		if !ok {
+			return errorf("map key is %s, not string", TypeName(key))
+		}
+		if v, ok = m[s]; !ok {
+			return args[1]
+		}
+	}
+	return v
+}
+
+func mapKeys(_ *Env, recv Value, _ []Value) Value {
+	keys := List{}
+	for _, key := range sortedKeys(recv.(Map)) {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// diffKeys returns the implementation of a map_diff method that selects keys
+// by whether they are in the two maps and, if in both, whether their values
+// are equal.
+func diffKeys(keep func(inLhs, inRhs, equal bool) bool) impl {
+	return func(_ *Env, recv Value, _ []Value) Value {
+		d := recv.(MapDiff)
+		keys := map[string]bool{}
+		for k := range d.Lhs {
+			keys[k] = true
+		}
+		for k := range d.Rhs {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		result := NewSet(nil)
+		for _, k := range sorted {
+			lhs, inLhs := d.Lhs[k]
+			rhs, inRhs := d.Rhs[k]
+			if keep(inLhs, inRhs, inLhs && inRhs && Equal(lhs, rhs)) {
+				result.Add(k)
+			}
+		}
+		return result
+	}
+}
+
+// pathBind replaces each segment of the form {name} with the value of name in
+// the bindings.
+func pathBind(_ *Env, recv Value, args []Value) Value {
+	bindings := args[0].(Map)
+	segments := recv.(Path).Segments()
+	for k, s := range segments {
+		if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+			continue
+		}
+		name := s[1 : len(s)-1]
+		v, ok := bindings[name]
+		if !ok {
+			return errorf("no binding for %s", name)
+		}
+		switch v := v.(type) {
+		case string:
+			segments[k] = v
+		case int64:
+			segments[k] = strconv.FormatInt(v, 10)
+		default:
+			return errorf("binding for %s is %s, not string", name, TypeName(v))
+		}
+	}
+	return Path("/" + strings.Join(segments, "/"))
+}
+
+func compile(expr string) (*regexp.Regexp, *Error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, errorf("bad regular expression %s: %v", quote(expr), err)
+	}
+	return re, nil
+}
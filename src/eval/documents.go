@@ -0,0 +1,100 @@
+package eval
+
+import "strings"
+
+// DocumentStore gives rules access to stored documents through get(),
+// exists(), getAfter() and existsAfter().
+type DocumentStore interface {
+	// Get returns the data of the document at path, a full path such as
+	// /databases/(default)/documents/users/alice, and whether the document
+	// exists.
+	Get(path Path) (Map, bool)
+}
+
+// MaxDocumentAccess is the number of distinct documents the rules may read
+// with get(), exists(), getAfter() and existsAfter() while deciding on a
+// single request, or on each operation of a batch. Reading more is an error.
+const MaxDocumentAccess = 10
+
+// MaxBatchDocumentAccess is the number of distinct documents the rules may
+// read while deciding on all the operations of a batch together.
+const MaxBatchDocumentAccess = 20
+
+// documents is the view of the database used while evaluating rules: the
+// stored documents, the writes that the request being decided would make,
+// and the documents read so far.
+type documents struct {
+	store DocumentStore
+	// writes holds the data each pending write would leave at its path; a
+	// nil Map means the document would be deleted.
+	writes map[Path]Map
+	limit  int
+	read   map[Path]bool
+	// batch, if set, counts the documents read by every operation of the
+	// batch that the request is part of.
+	batch *documents
+}
+
+func newDocuments(store DocumentStore, writes map[Path]Map, limit int) *documents {
+	return &documents{store: store, writes: writes, limit: limit, read: map[Path]bool{}}
+}
+
+// get returns the document at path as a resource, or null if there is none.
+// If after is set the pending writes are applied first.
+func (d *documents) get(path Path, after bool) Value {
+	path = Path("/" + strings.Join(path.Segments(), "/"))
+	if err := d.count(path); err != nil {
+		return err
+	}
+	if after {
+		if data, ok := d.writes[path]; ok {
+			return resourceValue(data, path)
+		}
+	}
+	if d.store == nil {
+		return Null
+	}
+	data, ok := d.store.Get(path)
+	if !ok {
+		return Null
+	}
+	return resourceValue(data, path)
+}
+
+// count records that the document at path is read, returning an error if
+// that reads one document too many.
+func (d *documents) count(path Path) *Error {
+	if d.batch != nil {
+		if err := d.batch.count(path); err != nil {
+			return err
+		}
+	}
+	if !d.read[path] {
+		if len(d.read) >= d.limit {
+			return errorf("more than %d documents read", d.limit)
+		}
+		d.read[path] = true
+	}
+	return nil
+}
+
+// SetStore makes store the database read by get() and the other document
+// functions evaluated in env and its children.
+func (env *Env) SetStore(store DocumentStore) {
+	env.docs = newDocuments(store, nil, MaxDocumentAccess)
+}
+
+// documentAccess returns the implementation of get(), exists(), getAfter()
+// or existsAfter().
+func documentAccess(name string, after, exists bool) impl {
+	return func(env *Env, _ Value, args []Value) Value {
+		if env.docs == nil {
+			return errorf("%s() needs a database, and none is available", name)
+		}
+		v := env.docs.get(args[0].(Path), after)
+		if IsError(v) || !exists {
+			return v
+		}
+		return v != Null
+	}
+}
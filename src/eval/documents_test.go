@@ -0,0 +1,105 @@
+package eval
+
+import (
+	"fmt"
+	"testing"
+
+	"firestore-rules/src/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+// mapStore is a DocumentStore holding documents by full path.
+type mapStore map[Path]Map
+
+func (s mapStore) Get(path Path) (Map, bool) {
+	data, ok := s[path]
+	return data, ok
+}
+
+func TestDocumentAccess(t *testing.T) {
+	rules := parseRules(t, `rules_version = '2';
+service cloud.firestore {
+  match /databases/{database}/documents {
+    function isAdmin() {
+      return exists(/databases/$(database)/documents/admins/$(request.auth.uid));
+    }
+    match /projects/{id} {
+      allow get: if get(/databases/$(database)/documents/projects/$(id)).data.public == true || isAdmin();
+      allow create: if getAfter(/databases/$(database)/documents/projects/$(id)).data.owner == request.auth.uid;
+      allow delete: if !existsAfter(/databases/$(database)/documents/projects/$(id)) && isAdmin();
+      allow update: if get(/databases/$(database)/documents/projects/$(id)).id == id
+        && getAfter(/databases/$(database)/documents/projects/$(id)).data == request.resource.data;
+    }
+    match /chain/{n} {
+      function reads(k) {
+        return k == 0 || !exists(/databases/$(database)/documents/chain/$(k)) && reads(k - 1);
+      }
+      allow get: if reads(int(n));
+    }
+  }
+}
+`)
+	db := "/databases/(default)/documents"
+	store := mapStore{
+		Path(db + "/projects/open"):   {"public": true},
+		Path(db + "/projects/closed"): {"public": false},
+		Path(db + "/admins/root"):     {},
+	}
+	root := Map{"uid": "root"}
+	alice := Map{"uid": "alice"}
+	tests := []struct {
+		name     string
+		req      Request
+		expected bool
+	}{
+		{"get public", Request{Method: MethodGet, Path: "/projects/open"}, true},
+		{"get private", Request{Method: MethodGet, Path: "/projects/closed", Auth: alice}, false},
+		{"get private as admin", Request{Method: MethodGet, Path: "/projects/closed", Auth: root}, true},
+		{"get missing", Request{Method: MethodGet, Path: "/projects/none", Auth: alice}, false},
+		{"getAfter sees the write", Request{Method: MethodCreate, Path: "/projects/new", Auth: alice, Data: Map{"owner": "alice"}}, true},
+		{"getAfter sees the data written", Request{Method: MethodCreate, Path: "/projects/new", Auth: alice, Data: Map{"owner": "bob"}}, false},
+		{"existsAfter sees the delete", Request{Method: MethodDelete, Path: "/projects/open", Auth: root}, true},
+		{"update", Request{Method: MethodUpdate, Path: "/projects/open", Auth: alice, Existing: Map{"public": true}, Data: Map{}}, true},
+		{"ten reads", Request{Method: MethodGet, Path: "/chain/10"}, true},
+		{"eleven reads", Request{Method: MethodGet, Path: "/chain/11"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.req.Store = store
+			assert.Equal(t, test.expected, Evaluate(rules, test.req).Allowed)
+		})
+	}
+
+	// Without a store the database is empty.
+	assert.False(t, Evaluate(rules, Request{Method: MethodGet, Path: "/projects/open"}).Allowed)
+}
+
+func TestSetStore(t *testing.T) {
+	env := NewEnv(nil)
+	env.SetStore(mapStore{"/databases/db/documents/a/b": {"x": int64(1)}})
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"get(/databases/db/documents/a/b)", "{'__name__': path('/databases/db/documents/a/b'), 'data': {'x': 1}, 'id': 'b'}"},
+		{"get(/databases/db/documents/a/c)", "null"},
+		{"exists(/databases/db/documents/a/b)", "true"},
+		{"existsAfter(/databases/db/documents/a/c)", "false"},
+		{"get('a')", "error('cannot use string as argument path of get(path path) map{__name__, data, id}')"},
+	}
+	for _, test := range tests {
+		e, err := parser.ParseExpr(parser.New(test.input))
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected, Format(Eval(e, NewEnv(env))), test.input)
+	}
+}
+
+func TestDocumentLimit(t *testing.T) {
+	d := newDocuments(nil, nil, 2)
+	for k := 0; k < 2; k++ {
+		assert.Equal(t, Null, d.get(Path(fmt.Sprintf("/a/%d", k)), false))
+	}
+	// Reading a document again does not count.
+	assert.Equal(t, Null, d.get("/a/0/", true))
+	assert.Equal(t, "more than 2 documents read", d.get("/a/2", false).(*Error).Msg)
+}
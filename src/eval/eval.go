@@ -0,0 +1,578 @@
+// Package eval computes the values of rules expressions with the semantics of
+// Firestore: operations on the wrong types produce error values rather than
+// failing, errors propagate, and '&&' and '||' ignore an error on one side
+// when the other side decides the result.
+package eval
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"firestore-rules/src/parser"
+	"firestore-rules/src/types"
+)
+
+// maxCallDepth is the deepest nesting of user function calls Firestore
+// allows.
+const maxCallDepth = 20
+
+// Env holds the names visible to an expression: variables and user
+// functions. Names not found in an Env are looked up in its parent.
+type Env struct {
+	parent    *Env
+	vars      map[string]Value
+	functions map[string]closure
+	depth     int
+	tracer    *tracer
+	docs      *documents
+
+	// Debug, if set, is called with the argument of every call of debug().
+	// It is inherited by child environments.
+	Debug func(Value)
+}
+
+// closure is a user function with the environment it was defined in.
+type closure struct {
+	fd  *parser.FunctionDef
+	env *Env
+}
+
+// NewEnv returns an empty environment inside parent, which may be nil.
+func NewEnv(parent *Env) *Env {
+	env := &Env{parent: parent, vars: map[string]Value{}, functions: map[string]closure{}}
+	if parent != nil {
+		env.depth = parent.depth
+		env.tracer = parent.tracer
+		env.docs = parent.docs
+	}
+	return env
+}
+
+// Set binds name to v in env.
+func (env *Env) Set(name string, v Value) {
+	env.vars[name] = v
+}
+
+// Define makes the user function fd callable from env and its children.
+func (env *Env) Define(fd *parser.FunctionDef) {
+	env.functions[fd.Name.Value] = closure{fd, env}
+}
+
+// Lookup returns the value of the variable name.
+func (env *Env) Lookup(name string) (Value, bool) {
+	for e := env; e != nil; e = e.parent {
+		if v, ok := e.vars[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (env *Env) function(name string) (closure, bool) {
+	for e := env; e != nil; e = e.parent {
+		if c, ok := e.functions[name]; ok {
+			return c, true
+		}
+	}
+	return closure{}, false
+}
+
+func (env *Env) debug(v Value) {
+	for e := env; e != nil; e = e.parent {
+		if e.Debug != nil {
+			e.Debug(v)
+			return
+		}
+	}
+}
+
+// Eval returns the value of e in env. It never panics on bad input: problems
+// such as a missing field or a type mismatch produce an *Error value.
+func Eval(e parser.Expr, env *Env) Value {
+	var node *TraceNode
+	if env.tracer != nil {
+		node = env.tracer.push(TraceExpr, e)
+		defer env.tracer.pop()
+	}
+	v := eval(e, env)
+	if err, ok := v.(*Error); ok && err.Node == nil {
+		err.Node = e
+	}
+	if node != nil {
+		node.Value = v
+	}
+	return v
+}
+
+func eval(e parser.Expr, env *Env) Value {
+	switch e := e.(type) {
+	case *parser.Literal:
+		return literal(e.Value)
+	case *parser.Id:
+		if v, ok := env.Lookup(e.Name.Value); ok {
+			return v
+		}
+		return errorf("%s is not defined", e.Name.Value)
+	case *parser.UnaryExpr:
+		return unary(e.Op.Kind, Eval(e.Operand, env))
+	case *parser.BinaryExpr:
+		return binaryExpr(e, env)
+	case *parser.TernaryExpr:
+		switch cond := Eval(e.Cond, env).(type) {
+		case *Error:
+			return cond
+		case bool:
+			if cond {
+				return Eval(e.True, env)
+			}
+			return Eval(e.False, env)
+		default:
+			return errorf("condition is %s, not bool", TypeName(cond))
+		}
+	case *parser.FunctionCall:
+		return call(e, env)
+	case *parser.ArrayLiteral:
+		list := make(List, len(e.Elements))
+		for k, x := range e.Elements {
+			list[k] = Eval(x, env)
+			if IsError(list[k]) {
+				return list[k]
+			}
+		}
+		return list
+	case *parser.MapLiteral:
+		m := make(Map, len(e.Entries))
+		for _, entry := range e.Entries {
+			key := Eval(entry.Key, env)
+			if IsError(key) {
+				return key
+			}
+			s, ok := key.(string)
+			if !ok {
+				return errorf("map key is %s, not string", TypeName(key))
+			}
+			value := Eval(entry.Value, env)
+			if IsError(value) {
+				return value
+			}
+			m[s] = value
+		}
+		return m
+	case *parser.PathExpr:
+		return pathExpr(e, env)
+	case *parser.Placeholder:
+		return errorf("%s is only allowed in the conditions of a field; compile the rules first", e)
+	default:
+		return errorf("cannot evaluate %T", e)
+	}
+}
+
+func literal(t parser.Token) Value {
+	switch t.Kind {
+	case parser.True:
+		return true
+	case parser.False:
+		return false
+	case parser.Null:
+		return Null
+	case parser.IntLiteral:
+		n, err := strconv.ParseInt(t.Value, 10, 64)
+		if err != nil {
+			return errorf("bad int literal %s", t.Value)
+		}
+		return n
+	case parser.FloatLiteral:
+		f, err := strconv.ParseFloat(t.Value, 64)
+		if err != nil {
+			return errorf("bad float literal %s", t.Value)
+		}
+		return f
+	case parser.StringLiteral:
+		s, err := parser.Unquote(t.Value)
+		if err != nil {
+			return errorf("bad string literal %s", t.Value)
+		}
+		return s
+	case parser.Bytes:
+		s, err := parser.Unquote(t.Value)
+		if err != nil {
+			return errorf("bad bytes literal %s", t.Value)
+		}
+		return Bytes(s)
+	default:
+		return errorf("unexpected literal %s", t.Value)
+	}
+}
+
+func unary(op parser.Kind, v Value) Value {
+	if IsError(v) {
+		return v
+	}
+	switch op {
+	case parser.Bang:
+		if b, ok := v.(bool); ok {
+			return !b
+		}
+	case parser.Minus:
+		switch v := v.(type) {
+		case int64:
+			if v == math.MinInt64 {
+				return errorf("integer overflow")
+			}
+			return -v
+		case float64:
+			return -v
+		case time.Duration:
+			return -v
+		}
+	}
+	return errorf("operator %s not defined on %s", opString(op), TypeName(v))
+}
+
+func binaryExpr(e *parser.BinaryExpr, env *Env) Value {
+	switch e.Op.Kind {
+	case parser.AndAnd, parser.OrOr:
+		return logical(e, env)
+	case parser.Dot:
+		lhs := Eval(e.Lhs, env)
+		if IsError(lhs) {
+			return lhs
+		}
+		return field(lhs, e.Rhs.(*parser.Id).Name.Value)
+	case parser.Is:
+		lhs := Eval(e.Lhs, env)
+		if IsError(lhs) {
+			return lhs
+		}
+		id, ok := e.Rhs.(*parser.Id)
+		if !ok || !types.IsTypeName(id.Name.Value) {
+			return errorf("%s is not a type", e.Rhs)
+		}
+		return is(lhs, id.Name.Value)
+	}
+	lhs := Eval(e.Lhs, env)
+	if IsError(lhs) {
+		return lhs
+	}
+	rhs := Eval(e.Rhs, env)
+	if IsError(rhs) {
+		return rhs
+	}
+	return Binary(e.Op.Kind, lhs, rhs)
+}
+
+// Binary applies a binary operator other than '&&', '||', '.' and 'is' to two
+// values that are not errors.
+func Binary(op parser.Kind, lhs, rhs Value) Value {
+	switch op {
+	case parser.EqEq:
+		return Equal(lhs, rhs)
+	case parser.NotEq:
+		return !Equal(lhs, rhs)
+	case parser.Less, parser.LessEq, parser.Greater, parser.GreaterEq:
+		c, err := compare(lhs, rhs)
+		if err != nil {
+			return err
+		}
+		switch op {
+		case parser.Less:
+			return c < 0
+		case parser.LessEq:
+			return c <= 0
+		case parser.Greater:
+			return c > 0
+		default:
+			return c >= 0
+		}
+	case parser.In:
+		return in(lhs, rhs)
+	case parser.LeftSquareBracket:
+		return index(lhs, rhs)
+	case parser.Plus, parser.Minus, parser.Star, parser.Slash, parser.Percent:
+		return arithmetic(op, lhs, rhs)
+	}
+	return errorf("unknown operator %s", opString(op))
+}
+
+// logical evaluates '&&' and '||'. An error or non-bool on one side is
+// ignored if the other side alone decides the result: false for '&&' and true
+// for '||'.
+func logical(e *parser.BinaryExpr, env *Env) Value {
+	decisive := e.Op.Kind == parser.OrOr
+	lhs := Eval(e.Lhs, env)
+	if b, ok := lhs.(bool); ok && b == decisive {
+		return decisive
+	}
+	rhs := Eval(e.Rhs, env)
+	if b, ok := rhs.(bool); ok && b == decisive {
+		return decisive
+	}
+	for _, v := range []Value{lhs, rhs} {
+		if IsError(v) {
+			return v
+		}
+		if _, ok := v.(bool); !ok {
+			return errorf("operator %s not defined on %s", e.Op.Value, TypeName(v))
+		}
+	}
+	return !decisive
+}
+
+func field(v Value, name string) Value {
+	m, ok := v.(Map)
+	if !ok {
+		return errorf("%s has no field %s", TypeName(v), name)
+	}
+	if f, ok := m[name]; ok {
+		return f
+	}
+	return errorf("property %s is undefined", name)
+}
+
+func index(v, i Value) Value {
+	switch v := v.(type) {
+	case List:
+		n, ok := i.(int64)
+		if !ok {
+			return errorf("list index is %s, not int", TypeName(i))
+		}
+		if n < 0 || n >= int64(len(v)) {
+			return errorf("list index %d out of range", n)
+		}
+		return v[n]
+	case Map:
+		key, ok := i.(string)
+		if !ok {
+			return errorf("map key is %s, not string", TypeName(i))
+		}
+		if f, ok := v[key]; ok {
+			return f
+		}
+		return errorf("property %s is undefined", key)
+	case Path:
+		n, ok := i.(int64)
+		segments := v.Segments()
+		if !ok {
+			return errorf("path index is %s, not int", TypeName(i))
+		}
+		if n < 0 || n >= int64(len(segments)) {
+			return errorf("path index %d out of range", n)
+		}
+		return segments[n]
+	}
+	return errorf("%s cannot be indexed", TypeName(v))
+}
+
+func in(v, container Value) Value {
+	switch c := container.(type) {
+	case List:
+		for _, e := range c {
+			if Equal(e, v) {
+				return true
+			}
+		}
+		return false
+	case *Set:
+		return c.Contains(v)
+	case Map:
+		key, ok := v.(string)
+		if !ok {
+			return errorf("map key is %s, not string", TypeName(v))
+		}
+		_, found := c[key]
+		return found
+	}
+	return errorf("operator in not defined on %s", TypeName(container))
+}
+
+func is(v Value, name string) Value {
+	switch name {
+	case "number":
+		switch v.(type) {
+		case int64, float64:
+			return true
+		}
+		return false
+	default:
+		return TypeName(v) == name
+	}
+}
+
+func arithmetic(op parser.Kind, lhs, rhs Value) Value {
+	switch a := lhs.(type) {
+	case int64:
+		switch b := rhs.(type) {
+		case int64:
+			return intArithmetic(op, a, b)
+		case float64:
+			return floatArithmetic(op, float64(a), b)
+		}
+	case float64:
+		switch b := rhs.(type) {
+		case int64:
+			return floatArithmetic(op, a, float64(b))
+		case float64:
+			return floatArithmetic(op, a, b)
+		}
+	case string:
+		if b, ok := rhs.(string); ok && op == parser.Plus {
+			return a + b
+		}
+	case Bytes:
+		if b, ok := rhs.(Bytes); ok && op == parser.Plus {
+			return append(append(Bytes{}, a...), b...)
+		}
+	case List:
+		if b, ok := rhs.(List); ok && op == parser.Plus {
+			return append(append(List{}, a...), b...)
+		}
+	case time.Time:
+		switch b := rhs.(type) {
+		case time.Duration:
+			switch op {
+			case parser.Plus:
+				return a.Add(b)
+			case parser.Minus:
+				return a.Add(-b)
+			}
+		case time.Time:
+			if op == parser.Minus {
+				return a.Sub(b)
+			}
+		}
+	case time.Duration:
+		switch b := rhs.(type) {
+		case time.Duration:
+			switch op {
+			case parser.Plus:
+				return a + b
+			case parser.Minus:
+				return a - b
+			}
+		case time.Time:
+			if op == parser.Plus {
+				return b.Add(a)
+			}
+		}
+	}
+	return errorf("operator %s not defined on %s and %s", opString(op), TypeName(lhs), TypeName(rhs))
+}
+
+func intArithmetic(op parser.Kind, a, b int64) Value {
+	switch op {
+	case parser.Plus:
+		c := a + b
+		if (c > a) != (b > 0) {
+			return errorf("integer overflow")
+		}
+		return c
+	case parser.Minus:
+		c := a - b
+		if (c < a) != (b > 0) {
+			return errorf("integer overflow")
+		}
+		return c
+	case parser.Star:
+		if a != 0 && b != 0 {
+			c := a * b
+			if c/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+				return errorf("integer overflow")
+			}
+			return c
+		}
+		return int64(0)
+	case parser.Slash:
+		if b == 0 {
+			return errorf("division by zero")
+		}
+		if a == math.MinInt64 && b == -1 {
+			return errorf("integer overflow")
+		}
+		return a / b
+	default:
+		if b == 0 {
+			return errorf("modulus by zero")
+		}
+		if b == -1 {
+			return int64(0)
+		}
+		return a % b
+	}
+}
+
+func floatArithmetic(op parser.Kind, a, b float64) Value {
+	switch op {
+	case parser.Plus:
+		return a + b
+	case parser.Minus:
+		return a - b
+	case parser.Star:
+		return a * b
+	case parser.Slash:
+		return a / b
+	default:
+		return errorf("operator %% not defined on float")
+	}
+}
+
+func pathExpr(e *parser.PathExpr, env *Env) Value {
+	s := ""
+	for _, segment := range e.Segments {
+		if segment.Expr == nil {
+			s += "/" + segment.String()
+			continue
+		}
+		v := Eval(segment.Expr, env)
+		switch v := v.(type) {
+		case *Error:
+			return v
+		case string:
+			s += "/" + v
+		case int64:
+			s += "/" + strconv.FormatInt(v, 10)
+		case Path:
+			s += "/" + string(v)[1:]
+		default:
+			return errorf("path segment is %s, not string", TypeName(v))
+		}
+	}
+	return Path(s)
+}
+
+func opString(op parser.Kind) string {
+	switch op {
+	case parser.Bang:
+		return "!"
+	case parser.Minus:
+		return "-"
+	case parser.Plus:
+		return "+"
+	case parser.Star:
+		return "*"
+	case parser.Slash:
+		return "/"
+	case parser.Percent:
+		return "%"
+	case parser.EqEq:
+		return "=="
+	case parser.NotEq:
+		return "!="
+	case parser.Less:
+		return "<"
+	case parser.LessEq:
+		return "<="
+	case parser.Greater:
+		return ">"
+	case parser.GreaterEq:
+		return ">="
+	case parser.In:
+		return "in"
+	case parser.Is:
+		return "is"
+	case parser.LeftSquareBracket:
+		return "[]"
+	default:
+		return op.String()
+	}
+}
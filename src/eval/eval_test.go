@@ -0,0 +1,145 @@
+package eval
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"firestore-rules/src/builtins"
+	"firestore-rules/src/parser"
+	"firestore-rules/src/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the actual results")
+
+// testEnv returns the environment the golden expressions are evaluated in.
+func testEnv() *Env {
+	env := NewEnv(nil)
+	env.Set("data", Map{"title": "hello", "tags": List{"a", "b"}})
+	return env
+}
+
+// TestGolden evaluates each expression in testdata/*.golden and compares the
+// result with the one written after "=>" on the same line. Lines starting
+// with '#' are comments.
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.golden")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, files)
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			src, err := ioutil.ReadFile(file)
+			assert.Nil(t, err)
+			lines := strings.Split(strings.TrimRight(string(src), "\n"), "\n")
+			for k, line := range lines {
+				if line == "" || strings.HasPrefix(line, "#") {
+					continue
+				}
+				input, expected := line, ""
+				if i := strings.Index(line, " => "); i >= 0 {
+					input, expected = line[:i], line[i+len(" => "):]
+				}
+				e, err := parser.ParseExpr(parser.New(input))
+				if !assert.Nil(t, err, input) {
+					continue
+				}
+				actual := Format(Eval(e, testEnv()))
+				if *update {
+					lines[k] = input + " => " + actual
+					continue
+				}
+				assert.Equal(t, expected, actual, "%s:%d: %s", file, k+1, input)
+			}
+			if *update {
+				assert.Nil(t, ioutil.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0644))
+			}
+		})
+	}
+}
+
+func TestErrorNode(t *testing.T) {
+	e, err := parser.ParseExpr(parser.New("1 + [1, 2][5]"))
+	assert.Nil(t, err)
+	v := Eval(e, testEnv())
+	assert.IsType(t, &Error{}, v)
+	assert.Equal(t, "[1, 2][5]", v.(*Error).Node.(parser.Expr).String())
+	assert.Equal(t, "line 1 col 5: list index 5 out of range", v.(*Error).Error())
+}
+
+func TestUserFunctions(t *testing.T) {
+	src := `rules_version = '2';
+service cloud.firestore {
+  function double(x) {
+    return x * 2;
+  }
+  function quadruple(x) {
+    let y = double(x);
+    return double(y);
+  }
+  function outer() {
+    return suffix;
+  }
+  function countdown(n) {
+    return n == 0 ? 'done' : countdown(n - 1);
+  }
+}
+`
+	rules, err := parser.ParseRules(parser.New(src))
+	assert.Nil(t, err)
+	global := NewEnv(nil)
+	global.Set("suffix", "global")
+	for _, stmt := range rules.Service.Statements {
+		global.Define(stmt.(*parser.FunctionDef))
+	}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"double(21)", "42"},
+		{"quadruple(3)", "12"},
+		{"double('a')", "error('operator * not defined on string and int')"},
+		{"double(1, 2)", "error('double takes 1 arguments, not 2')"},
+		// Functions see the names of the block they are defined in, not
+		// those of the caller.
+		{"outer()", "'global'"},
+		{"countdown(3)", "'done'"},
+		{"countdown(30)", "error('call of countdown exceeds the maximum call depth of 20')"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			e, err := parser.ParseExpr(parser.New(test.input))
+			assert.Nil(t, err)
+			caller := NewEnv(global)
+			caller.Set("suffix", "caller")
+			assert.Equal(t, test.expected, Format(Eval(e, caller)))
+		})
+	}
+}
+
+func TestDebug(t *testing.T) {
+	var logged []Value
+	env := NewEnv(nil)
+	env.Debug = func(v Value) { logged = append(logged, v) }
+	e, err := parser.ParseExpr(parser.New("debug(1) + debug(2)"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), Eval(e, NewEnv(env)))
+	assert.Equal(t, []Value{int64(1), int64(2)}, logged)
+}
+
+// TestCatalogImplemented checks that every entry of the builtins catalog can
+// be evaluated.
+func TestCatalogImplemented(t *testing.T) {
+	all := builtins.Globals()
+	for _, ns := range builtins.Namespaces() {
+		all = append(all, builtins.Funcs(ns.Name)...)
+	}
+	for kind := types.Invalid; kind <= types.Function; kind++ {
+		all = append(all, builtins.Methods(kind)...)
+	}
+	for _, f := range all {
+		assert.NotNil(t, lookupImpl(f), f.QualifiedName())
+	}
+}
@@ -0,0 +1,143 @@
+package eval
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// FromNative converts data decoded from JSON or YAML into a Value. Numbers
+// written without a fraction or exponent become ints when decoded as
+// json.Number, and maps with a single key naming a type become values of that
+// type:
+//
+//	{"$timestamp": "2020-09-13T12:26:40Z"}  an RFC 3339 time
+//	{"$duration": "1h30m"}                  a Go duration
+//	{"$bytes": "YWJj"}                      base 64
+//	{"$path": "/databases/(default)/documents/users/alice"}
+//	{"$latlng": [37.5, -122]}
+func FromNative(v interface{}) (Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return Null, nil
+	case bool:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return nil, fmt.Errorf("%d is too big for an int", v)
+		}
+		return int64(v), nil
+	case float64:
+		return v, nil
+	case json.Number:
+		if !strings.ContainsAny(string(v), ".eE") {
+			if n, err := v.Int64(); err == nil {
+				return n, nil
+			}
+		}
+		return v.Float64()
+	case string:
+		return v, nil
+	case time.Time:
+		return v.UTC(), nil
+	case []interface{}:
+		list := make(List, len(v))
+		for k, e := range v {
+			var err error
+			if list[k], err = FromNative(e); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case map[string]interface{}:
+		if len(v) == 1 {
+			for key, e := range v {
+				if strings.HasPrefix(key, "$") {
+					return special(key, e)
+				}
+			}
+		}
+		m := make(Map, len(v))
+		for key, e := range v {
+			var err error
+			if m[key], err = FromNative(e); err != nil {
+				return nil, fmt.Errorf("%s: %v", key, err)
+			}
+		}
+		return m, nil
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, e := range v {
+			s, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("map key %v is not a string", key)
+			}
+			m[s] = e
+		}
+		return FromNative(m)
+	}
+	return nil, fmt.Errorf("cannot convert %T to a value", v)
+}
+
+// special converts the value of a single-key map such as {"$timestamp": ...}.
+func special(key string, v interface{}) (Value, error) {
+	switch key {
+	case "$timestamp", "$duration", "$bytes", "$path", "$latlng":
+	default:
+		return nil, fmt.Errorf("unknown type %s", key)
+	}
+	if key == "$latlng" {
+		pair, ok := v.([]interface{})
+		if !ok || len(pair) != 2 {
+			return nil, fmt.Errorf("%s needs [latitude, longitude]", key)
+		}
+		var coords [2]float64
+		for k, e := range pair {
+			n, err := FromNative(e)
+			if err != nil {
+				return nil, err
+			}
+			switch n := n.(type) {
+			case int64:
+				coords[k] = float64(n)
+			case float64:
+				coords[k] = n
+			default:
+				return nil, fmt.Errorf("%s needs numbers, not %s", key, TypeName(n))
+			}
+		}
+		return LatLng{coords[0], coords[1]}, nil
+	}
+	if t, ok := v.(time.Time); ok && key == "$timestamp" {
+		return t.UTC(), nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s needs a string", key)
+	}
+	switch key {
+	case "$timestamp":
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, err
+		}
+		return t.UTC(), nil
+	case "$duration":
+		return time.ParseDuration(s)
+	case "$bytes":
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return Bytes(b), nil
+	default:
+		return Path(s), nil
+	}
+}
@@ -0,0 +1,296 @@
+package eval
+
+import (
+	"strings"
+	"time"
+
+	"firestore-rules/src/parser"
+	"firestore-rules/src/pathmatch"
+)
+
+// Method is the kind of access a request makes to a document, as seen in
+// request.method.
+type Method string
+
+// The methods a request can have.
+const (
+	MethodGet    Method = "get"
+	MethodList   Method = "list"
+	MethodCreate Method = "create"
+	MethodUpdate Method = "update"
+	MethodDelete Method = "delete"
+)
+
+// Methods lists every Method.
+var Methods = []Method{MethodGet, MethodList, MethodCreate, MethodUpdate, MethodDelete}
+
+// Valid reports whether m is one of the Methods.
+func (m Method) Valid() bool {
+	for _, method := range Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultDatabase is the database a Request is made to if it names none.
+const DefaultDatabase = "(default)"
+
+// Request describes an access to a document, to be checked against a set of
+// rules.
+type Request struct {
+	Method Method
+	// Path is the path of the document, such as /users/alice. A path that does
+	// not start with /databases/ is taken to be relative to the documents of
+	// Database.
+	Path string
+	// Database is the database the document is in. If it is empty the
+	// request is made to DefaultDatabase.
+	Database string
+	// Auth is request.auth, holding uid and token. If it is nil the request is
+	// unauthenticated and request.auth is null.
+	Auth Map
+	// Data is request.resource.data: the document as it would be if a create
+	// or update succeeded. It is ignored for other methods.
+	Data Map
+	// Existing is resource.data: the document as it is stored. If it is nil
+	// there is no such document and resource is null.
+	Existing Map
+	// Query is request.query for list requests.
+	Query Map
+	// Time is request.time. If it is zero the current time is used.
+	Time time.Time
+	// Store holds the documents read by get() and exists(). If it is nil
+	// the database is empty.
+	Store DocumentStore
+}
+
+// Decision is the outcome of checking a Request.
+type Decision struct {
+	Allowed bool
+	// Allow is the statement that granted access, or nil if the request was
+	// denied.
+	Allow *parser.AllowStmt
+	// Trace explains the decision. It is only set by EvaluateTrace.
+	Trace *Trace
+}
+
+func (d Decision) String() string {
+	if d.Allowed {
+		return "allow"
+	}
+	return "deny"
+}
+
+// Evaluate decides whether rules allow req. It finds every match block whose
+// path matches the document, binding its wildcards, and evaluates the allow
+// statements in those blocks that apply to the method of the request. The
+// request is allowed if any of them is true; conditions that produce an error
+// count as false.
+func Evaluate(rules *parser.Rules, req Request) Decision {
+	return evaluate(rules, req, nil, false)
+}
+
+// EvaluateTrace is like Evaluate, but also records a Trace of the match
+// statements, allow statements and expressions it evaluated.
+func EvaluateTrace(rules *parser.Rules, req Request) Decision {
+	return evaluate(rules, req, nil, true)
+}
+
+// evaluate decides whether rules allow req. The rules read documents through
+// docs, or through a view of req.Store if docs is nil. If trace is set the
+// decision holds a Trace.
+func evaluate(rules *parser.Rules, req Request, docs *documents, trace bool) Decision {
+	path := documentPath(req)
+	var t *tracer
+	if trace {
+		t = &tracer{trace: &Trace{Method: req.Method, Path: path}}
+	}
+	d := decide(rules, req, path, docs, t)
+	if t != nil {
+		t.trace.Allowed = d.Allowed
+		d.Trace = t.trace
+	}
+	return d
+}
+
+// decide does the work of evaluate for the document at path.
+func decide(rules *parser.Rules, req Request, path Path, docs *documents, t *tracer) Decision {
+	if rules == nil || rules.Service == nil {
+		return Decision{}
+	}
+	if docs == nil {
+		docs = newDocuments(req.Store, pendingWrites(req, path), MaxDocumentAccess)
+	}
+	s := &simulator{
+		method:  req.Method,
+		version: pathmatch.Version(rules),
+		tracer:  t,
+	}
+	env := NewEnv(nil)
+	env.tracer = t
+	env.docs = docs
+	env.Set("request", requestValue(req, path))
+	env.Set("resource", resourceValue(req.Existing, path))
+	if allow := s.block(rules.Service.Statements, path.Segments(), env); allow != nil {
+		return Decision{Allowed: true, Allow: allow}
+	}
+	return Decision{}
+}
+
+// simulator holds the state of one call of Evaluate.
+type simulator struct {
+	method  Method
+	version string
+	// tracer records what is evaluated, if a trace was asked for.
+	tracer *tracer
+}
+
+// block evaluates the statements of a service or match block whose path has
+// matched everything but the segments in rest. The functions of the block are
+// defined in a new environment inside env. The result is the allow statement
+// that granted access, if any.
+func (s *simulator) block(stmts []parser.Stmt, rest []string, env *Env) *parser.AllowStmt {
+	scope := NewEnv(env)
+	for _, stmt := range stmts {
+		if fd, ok := stmt.(*parser.FunctionDef); ok {
+			scope.Define(fd)
+		}
+	}
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *parser.AllowStmt:
+			if len(rest) == 0 && s.applies(stmt) && s.allow(stmt, scope) {
+				return stmt
+			}
+		case *parser.MatchStmt:
+			for _, p := range pathmatch.MatchPrefix(stmt.Path, rest, s.version) {
+				inner := NewEnv(scope)
+				bindings := Map{}
+				for _, b := range p.Bindings {
+					if b.Recursive {
+						bindings[b.Name] = Path(b.Value)
+					} else {
+						bindings[b.Name] = b.Value
+					}
+					inner.Set(b.Name, bindings[b.Name])
+				}
+				if s.tracer != nil {
+					s.tracer.push(TraceMatch, stmt).Bindings = bindings
+				}
+				allow := s.block(stmt.Components, p.Rest, inner)
+				if s.tracer != nil {
+					s.tracer.pop()
+				}
+				if allow != nil {
+					return allow
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// allow evaluates the condition of as.
+func (s *simulator) allow(as *parser.AllowStmt, env *Env) bool {
+	if s.tracer == nil {
+		return Eval(as.Condition, env) == true
+	}
+	node := s.tracer.push(TraceAllow, as)
+	defer s.tracer.pop()
+	node.Value = Eval(as.Condition, env)
+	return node.Value == true
+}
+
+// applies reports whether as grants the method of the request.
+func (s *simulator) applies(as *parser.AllowStmt) bool {
+	for _, action := range as.Actions {
+		switch action.Kind {
+		case parser.Read:
+			if s.method == MethodGet || s.method == MethodList {
+				return true
+			}
+		case parser.Write:
+			if s.method == MethodCreate || s.method == MethodUpdate || s.method == MethodDelete {
+				return true
+			}
+		default:
+			if string(s.method) == action.Value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// documentPath returns the full path of the document req refers to.
+func documentPath(req Request) Path {
+	return DocumentPath(req.Database, req.Path)
+}
+
+// DocumentPath returns the full path of the document at path in database. A
+// path that starts with /databases/ is already full and is returned as it is;
+// others are taken to be relative to the documents of the database, or of
+// DefaultDatabase if database is empty.
+func DocumentPath(database, path string) Path {
+	p := "/" + strings.Trim(path, "/")
+	if strings.HasPrefix(p, "/databases/") {
+		return Path(p)
+	}
+	if database == "" {
+		database = DefaultDatabase
+	}
+	return Path("/databases/" + database + "/documents" + strings.TrimSuffix(p, "/"))
+}
+
+// pendingWrites returns the write req would make, as seen by getAfter() and
+// existsAfter().
+func pendingWrites(req Request, path Path) map[Path]Map {
+	switch req.Method {
+	case MethodCreate, MethodUpdate:
+		return map[Path]Map{path: req.Data}
+	case MethodDelete:
+		return map[Path]Map{path: nil}
+	}
+	return nil
+}
+
+// requestValue returns the value of the request variable.
+func requestValue(req Request, path Path) Map {
+	t := req.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	request := Map{
+		"auth":     Null,
+		"method":   string(req.Method),
+		"path":     path,
+		"resource": Null,
+		"time":     t.UTC(),
+	}
+	if req.Auth != nil {
+		request["auth"] = req.Auth
+	}
+	if req.Method == MethodCreate || req.Method == MethodUpdate {
+		request["resource"] = resourceValue(req.Data, path)
+	}
+	if req.Query != nil {
+		request["query"] = req.Query
+	}
+	return request
+}
+
+// resourceValue returns the resource holding data stored at path, or null if
+// data is nil.
+func resourceValue(data Map, path Path) Value {
+	if data == nil {
+		return Null
+	}
+	segments := path.Segments()
+	return Map{
+		"data":     data,
+		"id":       segments[len(segments)-1],
+		"__name__": path,
+	}
+}
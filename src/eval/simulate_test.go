@@ -0,0 +1,146 @@
+package eval
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"firestore-rules/src/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func parseRules(t *testing.T, src string) *parser.Rules {
+	rules, err := parser.ParseRules(parser.New(src))
+	assert.Nil(t, err)
+	return rules
+}
+
+func TestEvaluate(t *testing.T) {
+	rules := parseRules(t, `rules_version = '2';
+service cloud.firestore {
+  match /databases/{database}/documents {
+    function signedIn() {
+      return request.auth != null;
+    }
+    match /users/{uid} {
+      function owner() {
+        return signedIn() && request.auth.uid == uid;
+      }
+      allow read: if owner();
+      allow create: if owner() && request.resource.data.name is string;
+      allow update: if owner() && resource.data.name == request.resource.data.name;
+      allow delete: if false;
+      match /posts/{post} {
+        allow get: if post == 'public' || owner();
+        allow list: if request.query.limit <= 10;
+      }
+    }
+    match /public/{rest=**} {
+      allow read: if rest == /a/b || rest == path('/');
+    }
+    match /{collection}/{id} {
+      allow write: if collection == 'scratch' && database == '(default)';
+    }
+    match /broken/{id} {
+      allow read: if 1 / 0 == 0;
+    }
+  }
+}
+`)
+	alice := Map{"uid": "alice", "token": Map{}}
+	tests := []struct {
+		name     string
+		req      Request
+		expected bool
+	}{
+		{"owner reads", Request{Method: MethodGet, Path: "/users/alice", Auth: alice}, true},
+		{"owner lists", Request{Method: MethodList, Path: "/users/alice", Auth: alice}, true},
+		{"other reads", Request{Method: MethodGet, Path: "/users/bob", Auth: alice}, false},
+		{"anonymous reads", Request{Method: MethodGet, Path: "/users/alice"}, false},
+		{"full path", Request{Method: MethodGet, Path: "/databases/(default)/documents/users/alice", Auth: alice}, true},
+		{"create", Request{Method: MethodCreate, Path: "/users/alice", Auth: alice, Data: Map{"name": "Alice"}}, true},
+		{"create with bad data", Request{Method: MethodCreate, Path: "/users/alice", Auth: alice, Data: Map{"name": 1}}, false},
+		{"update", Request{Method: MethodUpdate, Path: "/users/alice", Auth: alice,
+			Existing: Map{"name": "Alice"}, Data: Map{"name": "Alice", "x": 1}}, true},
+		{"update changing name", Request{Method: MethodUpdate, Path: "/users/alice", Auth: alice,
+			Existing: Map{"name": "Alice"}, Data: Map{"name": "Bob"}}, false},
+		{"update of missing document", Request{Method: MethodUpdate, Path: "/users/alice", Auth: alice,
+			Data: Map{"name": "Bob"}}, false},
+		{"delete", Request{Method: MethodDelete, Path: "/users/alice", Auth: alice}, false},
+		{"nested wildcard", Request{Method: MethodGet, Path: "/users/bob/posts/public"}, true},
+		{"nested function sees outer wildcard", Request{Method: MethodGet, Path: "/users/alice/posts/x", Auth: alice}, true},
+		{"nested private", Request{Method: MethodGet, Path: "/users/bob/posts/x", Auth: alice}, false},
+		{"query", Request{Method: MethodList, Path: "/users/bob/posts/x", Query: Map{"limit": int64(5)}}, true},
+		{"query too big", Request{Method: MethodList, Path: "/users/bob/posts/x", Query: Map{"limit": int64(50)}}, false},
+		{"recursive wildcard", Request{Method: MethodGet, Path: "/public/a/b"}, true},
+		{"recursive wildcard other path", Request{Method: MethodGet, Path: "/public/a/c"}, false},
+		{"prefix is not a match", Request{Method: MethodGet, Path: "/users"}, false},
+		{"longer path is not a match", Request{Method: MethodGet, Path: "/users/alice/posts", Auth: alice}, false},
+		{"generic match", Request{Method: MethodDelete, Path: "/scratch/x"}, true},
+		{"other database", Request{Method: MethodDelete, Path: "/scratch/x", Database: "other"}, false},
+		{"error denies", Request{Method: MethodGet, Path: "/broken/x"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := Evaluate(rules, test.req)
+			assert.Equal(t, test.expected, d.Allowed)
+			assert.Equal(t, test.expected, d.Allow != nil)
+		})
+	}
+}
+
+func TestEvaluateRecursiveWildcardVersion(t *testing.T) {
+	src := `
+service cloud.firestore {
+  match /databases/{database}/documents {
+    match /docs/{rest=**} {
+      allow get: if true;
+    }
+  }
+}
+`
+	// In rules_version 2 a recursive wildcard may match no segments; in
+	// version 1 it needs at least one.
+	v1 := parseRules(t, "rules_version = '1';"+src)
+	v2 := parseRules(t, "rules_version = '2';"+src)
+	assert.False(t, Evaluate(v1, Request{Method: MethodGet, Path: "/docs"}).Allowed)
+	assert.True(t, Evaluate(v2, Request{Method: MethodGet, Path: "/docs"}).Allowed)
+	assert.True(t, Evaluate(v1, Request{Method: MethodGet, Path: "/docs/a/b"}).Allowed)
+}
+
+func TestEvaluateTestdata(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/firestore.rules")
+	assert.Nil(t, err)
+	rules := parseRules(t, string(src))
+	now := time.Date(2020, 9, 13, 12, 0, 0, 0, time.UTC)
+	issue := Map{
+		"id":          "i1",
+		"title":       "A title long enough",
+		"description": "It is broken.",
+		"created":     now,
+		"modified":    now,
+		"creator":     "alice",
+		"kind":        "bug",
+		"reason":      "triage",
+		"state":       "open",
+		"votes":       int64(0),
+	}
+	alice := Map{"uid": "alice"}
+	create := Request{Method: MethodCreate, Path: "/issues/i1", Auth: alice, Data: issue, Time: now}
+	assert.True(t, Evaluate(rules, create).Allowed)
+
+	create.Auth = Map{"uid": "bob"}
+	assert.False(t, Evaluate(rules, create).Allowed)
+
+	project := Request{Method: MethodDelete, Path: "/users/alice/projects/p1", Auth: alice}
+	assert.True(t, Evaluate(rules, project).Allowed)
+	project.Auth = Map{"uid": "bob"}
+	assert.False(t, Evaluate(rules, project).Allowed)
+}
+
+func TestMethod(t *testing.T) {
+	assert.True(t, MethodCreate.Valid())
+	assert.False(t, Method("read").Valid())
+	assert.Equal(t, "allow", Decision{Allowed: true}.String())
+	assert.Equal(t, "deny", Decision{}.String())
+}
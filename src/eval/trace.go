@@ -0,0 +1,210 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"firestore-rules/src/format"
+	"firestore-rules/src/parser"
+)
+
+// TraceKind says what a TraceNode records.
+type TraceKind string
+
+// The kinds of TraceNode.
+const (
+	// TraceMatch is a match statement whose path matched the document. Its
+	// Bindings hold the values of the wildcards.
+	TraceMatch TraceKind = "match"
+	// TraceAllow is an allow statement that applied to the request. Its Value
+	// is the value of the condition.
+	TraceAllow TraceKind = "allow"
+	// TraceExpr is an expression that was evaluated, including the bodies of
+	// the functions it called.
+	TraceExpr TraceKind = "expr"
+)
+
+// Trace records how a Decision was reached: the match statements that
+// matched, the allow statements that were evaluated and the value of every
+// expression evaluated on the way.
+type Trace struct {
+	Method  Method
+	Path    Path
+	Allowed bool
+	Nodes   []*TraceNode
+}
+
+// TraceNode is a step of a Trace, keyed to the part of the source it
+// evaluated.
+type TraceNode struct {
+	Kind     TraceKind
+	Node     parser.Node
+	Value    Value
+	Bindings Map
+	Children []*TraceNode
+}
+
+// tracer builds a Trace as expressions are evaluated.
+type tracer struct {
+	trace *Trace
+	stack []*TraceNode
+}
+
+func (t *tracer) push(kind TraceKind, n parser.Node) *TraceNode {
+	node := &TraceNode{Kind: kind, Node: n}
+	if len(t.stack) == 0 {
+		t.trace.Nodes = append(t.trace.Nodes, node)
+	} else {
+		top := t.stack[len(t.stack)-1]
+		top.Children = append(top.Children, node)
+	}
+	t.stack = append(t.stack, node)
+	return node
+}
+
+func (t *tracer) pop() {
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+// explains reports whether n says something about why a request was denied:
+// whether it is false or an error.
+func (n *TraceNode) explains() bool {
+	return n.Value == false || IsError(n.Value)
+}
+
+// Text renders t as annotated source: each step is shown as the line of src
+// it starts on, with the part of the line it covers underlined and its value
+// or wildcard bindings after it. The subexpressions of an expression are only
+// shown if it was false or produced an error, so that the output shows why a
+// condition failed without listing everything that succeeded; literals are
+// never shown.
+func (t *Trace) Text(src string) string {
+	lines := strings.Split(src, "\n")
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s %s\n", Decision{Allowed: t.Allowed}, t.Method, t.Path)
+	if len(t.Nodes) == 0 {
+		sb.WriteString("no match statement matches the path\n")
+	}
+	var write func(n *TraceNode, indent string)
+	write = func(n *TraceNode, indent string) {
+		pos, end := n.Node.Pos(), n.Node.End()
+		line := ""
+		if pos.Line < len(lines) {
+			line = lines[pos.Line]
+		}
+		text := strings.TrimLeft(line, " \t")
+		trimmed := len(line) - len(text)
+		prefix := fmt.Sprintf("%s%d:%d: ", indent, pos.Line+1, pos.Col+1)
+		fmt.Fprintf(&sb, "%s%s\n", prefix, text)
+		pad := strings.Repeat(" ", len(prefix))
+		switch n.Kind {
+		case TraceAllow:
+			// The condition is the only child and shows the value.
+		case TraceMatch:
+			for _, name := range sortedKeys(n.Bindings) {
+				fmt.Fprintf(&sb, "%s%s = %s\n", pad, name, Format(n.Bindings[name]))
+			}
+		default:
+			start := pos.Col - trimmed
+			stop := len(text)
+			if end.Line == pos.Line && end.Col-trimmed < stop {
+				stop = end.Col - trimmed
+			}
+			if start < 0 || start >= stop {
+				start, stop = 0, len(text)
+			}
+			fmt.Fprintf(&sb, "%s%s%s %s\n", pad, strings.Repeat(" ", start), strings.Repeat("^", stop-start), Format(n.Value))
+		}
+		if n.Kind == TraceExpr && !n.explains() {
+			return
+		}
+		for _, child := range n.Children {
+			if _, ok := child.Node.(*parser.Literal); !ok {
+				write(child, indent+"  ")
+			}
+		}
+	}
+	for _, n := range t.Nodes {
+		write(n, "")
+	}
+	return sb.String()
+}
+
+// jsonPosition is a position in the JSON form of a trace, with 1-based line
+// and column.
+type jsonPosition struct {
+	Line int `json:"line"`
+	Col  int `json:"col"`
+}
+
+type jsonNode struct {
+	Kind     TraceKind         `json:"kind"`
+	Start    jsonPosition      `json:"start"`
+	End      jsonPosition      `json:"end"`
+	Text     string            `json:"text"`
+	Value    string            `json:"value,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Bindings map[string]string `json:"bindings,omitempty"`
+	Children []*jsonNode       `json:"children,omitempty"`
+}
+
+// MarshalJSON encodes t as an object holding the decision and a tree of
+// steps. Each step has its kind, its span in the source, the source text of
+// its node, and its value, error or bindings, formatted as in Format.
+func (t *Trace) MarshalJSON() ([]byte, error) {
+	var convert func(n *TraceNode) *jsonNode
+	convert = func(n *TraceNode) *jsonNode {
+		pos, end := n.Node.Pos(), n.Node.End()
+		j := &jsonNode{
+			Kind:  n.Kind,
+			Start: jsonPosition{pos.Line + 1, pos.Col + 1},
+			End:   jsonPosition{end.Line + 1, end.Col + 1},
+			Text:  nodeText(n.Node),
+		}
+		switch v := n.Value.(type) {
+		case nil:
+		case *Error:
+			j.Error = v.Msg
+		default:
+			j.Value = Format(v)
+		}
+		if n.Kind == TraceMatch {
+			j.Bindings = map[string]string{}
+			for name, v := range n.Bindings {
+				j.Bindings[name] = Format(v)
+			}
+		}
+		for _, child := range n.Children {
+			j.Children = append(j.Children, convert(child))
+		}
+		return j
+	}
+	nodes := []*jsonNode{}
+	for _, n := range t.Nodes {
+		nodes = append(nodes, convert(n))
+	}
+	return json.Marshal(struct {
+		Decision string      `json:"decision"`
+		Method   Method      `json:"method"`
+		Path     Path        `json:"path"`
+		Steps    []*jsonNode `json:"steps"`
+	}{Decision{Allowed: t.Allowed}.String(), t.Method, t.Path, nodes})
+}
+
+// nodeText returns a one-line description of n.
+func nodeText(n parser.Node) string {
+	switch n := n.(type) {
+	case *parser.MatchStmt:
+		return "match " + n.Path.String()
+	case *parser.AllowStmt:
+		actions := make([]string, len(n.Actions))
+		for k, a := range n.Actions {
+			actions[k] = a.Value
+		}
+		return "allow " + strings.Join(actions, ", ")
+	case parser.Expr:
+		return format.Expr(n)
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package eval
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const traceRules = `rules_version = '2';
+service cloud.firestore {
+  match /databases/{database}/documents {
+    match /users/{uid} {
+      function owner() {
+        return request.auth.uid == uid;
+      }
+      allow read: if owner() || 1 / 0 == 1;
+      allow write: if true;
+    }
+  }
+}
+`
+
+func TestTraceText(t *testing.T) {
+	rules := parseRules(t, traceRules)
+	d := EvaluateTrace(rules, Request{Method: MethodGet, Path: "/users/bob", Auth: Map{"uid": "alice"}})
+	assert.False(t, d.Allowed)
+	expected := `deny get /databases/(default)/documents/users/bob
+3:3: match /databases/{database}/documents {
+     database = '(default)'
+  4:5: match /users/{uid} {
+       uid = 'bob'
+    8:7: allow read: if owner() || 1 / 0 == 1;
+      8:22: allow read: if owner() || 1 / 0 == 1;
+                           ^^^^^^^^^^^^^^^^^^^^^ error('division by zero')
+        8:22: allow read: if owner() || 1 / 0 == 1;
+                             ^^^^^^^ false
+          6:16: return request.auth.uid == uid;
+                       ^^^^^^^^^^^^^^^^^^^^^^^ false
+            6:16: return request.auth.uid == uid;
+                         ^^^^^^^^^^^^^^^^ 'alice'
+            6:36: return request.auth.uid == uid;
+                                             ^^^ 'bob'
+        8:33: allow read: if owner() || 1 / 0 == 1;
+                                        ^^^^^^^^^^ error('division by zero')
+          8:33: allow read: if owner() || 1 / 0 == 1;
+                                          ^^^^^ error('division by zero')
+`
+	assert.Equal(t, expected, d.Trace.Text(traceRules))
+
+	d = EvaluateTrace(rules, Request{Method: MethodGet, Path: "/users/alice", Auth: Map{"uid": "alice"}})
+	assert.True(t, d.Allowed)
+	assert.Equal(t, `allow get /databases/(default)/documents/users/alice
+3:3: match /databases/{database}/documents {
+     database = '(default)'
+  4:5: match /users/{uid} {
+       uid = 'alice'
+    8:7: allow read: if owner() || 1 / 0 == 1;
+      8:22: allow read: if owner() || 1 / 0 == 1;
+                           ^^^^^^^^^^^^^^^^^^^^^ true
+`, d.Trace.Text(traceRules))
+
+	// A match statement that matches a prefix of the path is shown even if
+	// none of the statements inside it match the rest.
+	d = EvaluateTrace(rules, Request{Method: MethodGet, Path: "/other/x"})
+	assert.Equal(t, `deny get /databases/(default)/documents/other/x
+3:3: match /databases/{database}/documents {
+     database = '(default)'
+`, d.Trace.Text(traceRules))
+
+	d = EvaluateTrace(rules, Request{Method: MethodGet, Path: "/databases/x"})
+	assert.Equal(t, "deny get /databases/x\nno match statement matches the path\n", d.Trace.Text(traceRules))
+}
+
+func TestTraceJSON(t *testing.T) {
+	rules := parseRules(t, traceRules)
+	d := EvaluateTrace(rules, Request{Method: MethodDelete, Path: "/users/bob"})
+	b, err := json.Marshal(d.Trace)
+	assert.Nil(t, err)
+	expected := `{"decision":"allow","method":"delete","path":"/databases/(default)/documents/users/bob","steps":[
+{"kind":"match","start":{"line":3,"col":3},"end":{"line":11,"col":4},"text":"match /databases/{database}/documents","bindings":{"database":"'(default)'"},"children":[
+{"kind":"match","start":{"line":4,"col":5},"end":{"line":10,"col":6},"text":"match /users/{uid}","bindings":{"uid":"'bob'"},"children":[
+{"kind":"allow","start":{"line":9,"col":7},"end":{"line":9,"col":28},"text":"allow write","value":"true","children":[
+{"kind":"expr","start":{"line":9,"col":23},"end":{"line":9,"col":27},"text":"true","value":"true"}]}]}]}]}`
+	assert.JSONEq(t, expected, string(b))
+
+	d = EvaluateTrace(rules, Request{Method: MethodGet, Path: "/users/bob"})
+	b, err = json.Marshal(d.Trace)
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), `"text":"request.auth.uid","error":"null has no field uid"`)
+}
+
+func TestEvaluateHasNoTrace(t *testing.T) {
+	d := Evaluate(parseRules(t, traceRules), Request{Method: MethodDelete, Path: "/users/bob"})
+	assert.True(t, d.Allowed)
+	assert.Nil(t, d.Trace)
+}
@@ -0,0 +1,408 @@
+package eval
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"firestore-rules/src/parser"
+)
+
+// Value is the result of evaluating an expression. Its dynamic type is one of
+//
+//	NullValue     null
+//	bool          bool
+//	int64         int
+//	float64       float
+//	string        string
+//	Bytes         bytes
+//	List          list
+//	Map           map
+//	*Set          set
+//	Path          path
+//	time.Time     timestamp
+//	time.Duration duration
+//	LatLng        latlng
+//	MapDiff       map_diff
+//	*Error        the error produced by an operation that failed
+type Value interface{}
+
+// NullValue is the type of Null.
+type NullValue struct{}
+
+// Null is the value of the null literal.
+var Null = NullValue{}
+
+// Bytes is a bytes value.
+type Bytes []byte
+
+// List is a list value.
+type List []Value
+
+// Map is a map value.
+type Map map[string]Value
+
+// Path is a document path such as /databases/(default)/documents/users/abc.
+type Path string
+
+// Segments returns the segments of p, without the slashes between them.
+func (p Path) Segments() []string {
+	s := strings.Trim(string(p), "/")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "/")
+}
+
+// LatLng is a geographic point.
+type LatLng struct {
+	Lat, Lng float64
+}
+
+// MapDiff is the result of Map.diff: how the map Lhs differs from the map Rhs.
+type MapDiff struct {
+	Lhs, Rhs Map
+}
+
+// Set is a set value. Its elements are distinct under Equal and kept in the
+// order they were added.
+type Set struct {
+	elems List
+}
+
+// NewSet returns a set of the distinct elements of list.
+func NewSet(list List) *Set {
+	s := &Set{}
+	for _, v := range list {
+		s.Add(v)
+	}
+	return s
+}
+
+// Add adds v to s if it is not already there.
+func (s *Set) Add(v Value) {
+	if !s.Contains(v) {
+		s.elems = append(s.elems, v)
+	}
+}
+
+// Contains reports whether s has an element equal to v.
+func (s *Set) Contains(v Value) bool {
+	for _, e := range s.elems {
+		if Equal(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Elems returns the elements of s.
+func (s *Set) Elems() List {
+	return s.elems
+}
+
+// Len returns the number of elements of s.
+func (s *Set) Len() int {
+	return len(s.elems)
+}
+
+// Error is the value of an expression whose evaluation failed. Errors
+// propagate through most operations; '&&', '||' and the conditional operator
+// are the only ones that can ignore them.
+type Error struct {
+	Msg string
+	// Node is the expression that failed, if known.
+	Node parser.Node
+}
+
+func (e *Error) Error() string {
+	if e.Node != nil {
+		return fmt.Sprintf("%s: %s", e.Node.Pos(), e.Msg)
+	}
+	return e.Msg
+}
+
+func errorf(format string, args ...interface{}) *Error {
+	return &Error{Msg: fmt.Sprintf(format, args...)}
+}
+
+// IsError reports whether v is an error value.
+func IsError(v Value) bool {
+	_, ok := v.(*Error)
+	return ok
+}
+
+// TypeName returns the name of the type of v, as used with 'is'.
+func TypeName(v Value) string {
+	switch v.(type) {
+	case NullValue:
+		return "null"
+	case bool:
+		return "bool"
+	case int64:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "string"
+	case Bytes:
+		return "bytes"
+	case List:
+		return "list"
+	case Map:
+		return "map"
+	case *Set:
+		return "set"
+	case Path:
+		return "path"
+	case time.Time:
+		return "timestamp"
+	case time.Duration:
+		return "duration"
+	case LatLng:
+		return "latlng"
+	case MapDiff:
+		return "map_diff"
+	case *Error:
+		return "error"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// Equal reports whether a and b are equal. Ints and floats are compared by
+// value; lists, maps and sets are compared element by element. Values of
+// different types are never equal.
+func Equal(a, b Value) bool {
+	switch a := a.(type) {
+	case int64:
+		switch b := b.(type) {
+		case int64:
+			return a == b
+		case float64:
+			return float64(a) == b
+		}
+		return false
+	case float64:
+		switch b := b.(type) {
+		case int64:
+			return a == float64(b)
+		case float64:
+			return a == b
+		}
+		return false
+	case Bytes:
+		b, ok := b.(Bytes)
+		return ok && bytes.Equal(a, b)
+	case List:
+		b, ok := b.(List)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k := range a {
+			if !Equal(a[k], b[k]) {
+				return false
+			}
+		}
+		return true
+	case Map:
+		b, ok := b.(Map)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			w, ok := b[k]
+			if !ok || !Equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case *Set:
+		b, ok := b.(*Set)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+		for _, v := range a.elems {
+			if !b.Contains(v) {
+				return false
+			}
+		}
+		return true
+	case time.Time:
+		b, ok := b.(time.Time)
+		return ok && a.Equal(b)
+	case MapDiff:
+		b, ok := b.(MapDiff)
+		return ok && Equal(a.Lhs, b.Lhs) && Equal(a.Rhs, b.Rhs)
+	case *Error:
+		return false
+	default:
+		return a == b
+	}
+}
+
+// compare returns -1, 0 or 1 as a is less than, equal to or greater than b,
+// or an error if the values cannot be ordered.
+func compare(a, b Value) (int, *Error) {
+	switch a := a.(type) {
+	case int64:
+		switch b := b.(type) {
+		case int64:
+			return cmpInt(a, b), nil
+		case float64:
+			return cmpFloat(float64(a), b), nil
+		}
+	case float64:
+		switch b := b.(type) {
+		case int64:
+			return cmpFloat(a, float64(b)), nil
+		case float64:
+			return cmpFloat(a, b), nil
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	case Bytes:
+		if b, ok := b.(Bytes); ok {
+			return bytes.Compare(a, b), nil
+		}
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			switch {
+			case a.Before(b):
+				return -1, nil
+			case a.After(b):
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case time.Duration:
+		if b, ok := b.(time.Duration); ok {
+			return cmpInt(int64(a), int64(b)), nil
+		}
+	}
+	return 0, errorf("cannot compare %s and %s", TypeName(a), TypeName(b))
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Format returns v written as it would be in a rules expression, where that
+// is possible. Map keys are sorted.
+func Format(v Value) string {
+	switch v := v.(type) {
+	case NullValue:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		switch {
+		case math.IsInf(v, 1):
+			return "inf"
+		case math.IsInf(v, -1):
+			return "-inf"
+		case math.IsNaN(v):
+			return "nan"
+		case v == math.Trunc(v) && math.Abs(v) < 1e21:
+			return strconv.FormatFloat(v, 'f', 1, 64)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return quote(v)
+	case Bytes:
+		return "b" + quoteBytes(v)
+	case List:
+		return "[" + formatList(v) + "]"
+	case Map:
+		keys := sortedKeys(v)
+		entries := make([]string, len(keys))
+		for k, key := range keys {
+			entries[k] = quote(key) + ": " + Format(v[key])
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	case *Set:
+		return "set([" + formatList(v.elems) + "])"
+	case Path:
+		return "path(" + quote(string(v)) + ")"
+	case time.Time:
+		return "timestamp(" + quote(v.UTC().Format(time.RFC3339Nano)) + ")"
+	case time.Duration:
+		return "duration(" + quote(v.String()) + ")"
+	case LatLng:
+		return "latlng(" + Format(v.Lat) + ", " + Format(v.Lng) + ")"
+	case MapDiff:
+		return "map_diff(" + Format(v.Lhs) + ", " + Format(v.Rhs) + ")"
+	case *Error:
+		return "error(" + quote(v.Msg) + ")"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func formatList(list List) string {
+	s := make([]string, len(list))
+	for k, v := range list {
+		s[k] = Format(v)
+	}
+	return strings.Join(s, ", ")
+}
+
+// quote returns s as a single-quoted string literal.
+func quote(s string) string {
+	q := strconv.Quote(s)
+	q = strings.Replace(q[1:len(q)-1], `\"`, `"`, -1)
+	return "'" + strings.Replace(q, "'", `\'`, -1) + "'"
+}
+
+// quoteBytes returns b as a single-quoted bytes literal, escaping every byte
+// that is not printable ASCII.
+func quoteBytes(b Bytes) string {
+	var sb strings.Builder
+	sb.WriteByte('\'')
+	for _, c := range b {
+		switch {
+		case c == '\'' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c >= ' ' && c <= '~':
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "\\x%02x", c)
+		}
+	}
+	sb.WriteByte('\'')
+	return sb.String()
+}
+
+func sortedKeys(m Map) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
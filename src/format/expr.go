@@ -0,0 +1,278 @@
+package format
+
+import (
+	"strings"
+
+	"firestore-rules/src/parser"
+)
+
+// Operator precedence, from loosest to tightest binding, following the table
+// in src/parser/grammar.
+const (
+	lowest = iota
+	ternaryPrec
+	orPrec
+	andPrec
+	eqPrec
+	inPrec
+	relationalPrec
+	additivePrec
+	multiplicativePrec
+	unaryPrec
+	postfixPrec
+	primaryPrec
+)
+
+func precedence(e parser.Expr) int {
+	switch e := e.(type) {
+	case *parser.TernaryExpr:
+		return ternaryPrec
+	case *parser.BinaryExpr:
+		return binaryPrecedence(e.Op.Kind)
+	case *parser.UnaryExpr:
+		return unaryPrec
+	case *parser.FunctionCall:
+		return postfixPrec
+	default:
+		return primaryPrec
+	}
+}
+
+func binaryPrecedence(kind parser.Kind) int {
+	switch kind {
+	case parser.OrOr:
+		return orPrec
+	case parser.AndAnd:
+		return andPrec
+	case parser.EqEq, parser.NotEq:
+		return eqPrec
+	case parser.In, parser.Is:
+		return inPrec
+	case parser.Less, parser.LessEq, parser.Greater, parser.GreaterEq:
+		return relationalPrec
+	case parser.Plus, parser.Minus:
+		return additivePrec
+	case parser.Star, parser.Slash, parser.Percent:
+		return multiplicativePrec
+	default:
+		return postfixPrec
+	}
+}
+
+// flat returns e on one line. It is parenthesized if it binds less tightly
+// than prec.
+func flat(e parser.Expr, prec int) string {
+	s := flatBody(e)
+	if precedence(e) < prec {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+func flatBody(e parser.Expr) string {
+	switch e := e.(type) {
+	case *parser.TernaryExpr:
+		return flat(e.Cond, orPrec) + " ? " + flat(e.True, ternaryPrec) + " : " + flat(e.False, ternaryPrec)
+	case *parser.BinaryExpr:
+		switch e.Op.Kind {
+		case parser.Dot:
+			return flat(e.Lhs, postfixPrec) + "." + flat(e.Rhs, primaryPrec)
+		case parser.LeftSquareBracket:
+			return flat(e.Lhs, postfixPrec) + "[" + flat(e.Rhs, lowest) + "]"
+		default:
+			prec := precedence(e)
+			return flat(e.Lhs, prec) + " " + e.Op.Value + " " + flat(e.Rhs, prec+1)
+		}
+	case *parser.UnaryExpr:
+		return e.Op.Value + flat(e.Operand, unaryPrec)
+	case *parser.FunctionCall:
+		return flat(e.Fn, postfixPrec) + "(" + flatList(e.Args) + ")"
+	case *parser.ArrayLiteral:
+		return "[" + flatList(e.Elements) + "]"
+	case *parser.MapLiteral:
+		entries := make([]string, len(e.Entries))
+		for k, v := range e.Entries {
+			entries[k] = flat(v.Key, lowest) + ": " + flat(v.Value, lowest)
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	case *parser.PathExpr:
+		segments := make([]string, len(e.Segments))
+		for k, v := range e.Segments {
+			switch {
+			case v.Expr == nil:
+				segments[k] = v.String()
+			case v.Interpolated:
+				segments[k] = "$(" + flat(v.Expr, lowest) + ")"
+			default:
+				segments[k] = "(" + flat(v.Expr, lowest) + ")"
+			}
+		}
+		return "/" + strings.Join(segments, "/")
+	default:
+		return e.String()
+	}
+}
+
+func flatList(list []parser.Expr) string {
+	s := make([]string, len(list))
+	for k, v := range list {
+		s[k] = flat(v, lowest)
+	}
+	return strings.Join(s, ", ")
+}
+
+// wrap returns e starting at column col of a line indented by indent. If the
+// expression followed by tail more characters does not fit in maxWidth it is
+// broken across lines: '&&' and '||' chains put each operand on a line of its
+// own, and array and map literals put each element on a line of its own.
+func (p *printer) wrap(e parser.Expr, prec int, indent string, col int, tail int) string {
+	s := flat(e, prec)
+	if col+len(s)+tail <= maxWidth && !p.hasCommentBefore(e.End()) {
+		return s
+	}
+	parens := precedence(e) < prec
+	if parens {
+		col++
+	}
+	var body string
+	switch e := e.(type) {
+	case *parser.TernaryExpr:
+		cont := indent + continuationUnit
+		body = p.wrap(e.Cond, orPrec, indent, col, 0) + "\n" +
+			cont + "? " + p.wrap(e.True, ternaryPrec, cont, len(cont)+2, 0) + "\n" +
+			cont + ": " + p.wrap(e.False, ternaryPrec, cont, len(cont)+2, tail)
+	case *parser.BinaryExpr:
+		switch e.Op.Kind {
+		case parser.AndAnd, parser.OrOr:
+			body = p.wrapChain(e, indent, col, tail)
+		case parser.Dot:
+			body = p.wrap(e.Lhs, postfixPrec, indent, col, 0) + "." + flat(e.Rhs, primaryPrec)
+		case parser.LeftSquareBracket:
+			lhs := p.wrap(e.Lhs, postfixPrec, indent, col, 0)
+			body = lhs + "[" + p.wrap(e.Rhs, lowest, indent, endCol(lhs, col)+1, tail+1) + "]"
+		default:
+			prec := precedence(e)
+			lhs := p.wrap(e.Lhs, prec, indent, col, 0)
+			op := " " + e.Op.Value + " "
+			body = lhs + op + p.wrap(e.Rhs, prec+1, indent, endCol(lhs, col)+len(op), tail)
+		}
+	case *parser.UnaryExpr:
+		body = e.Op.Value + p.wrap(e.Operand, unaryPrec, indent, col+len(e.Op.Value), tail)
+	case *parser.FunctionCall:
+		fn := p.wrap(e.Fn, postfixPrec, indent, col, 0)
+		body = fn + "(" + p.wrapList(e.Args, indent, endCol(fn, col)+1, tail+1) + ")"
+	case *parser.ArrayLiteral:
+		elements := make([]parser.Node, len(e.Elements))
+		for k, v := range e.Elements {
+			elements[k] = v
+		}
+		body = p.wrapElements("[", "]", elements, e.RightBracket, func(k int, indent string) string {
+			return p.wrap(e.Elements[k], lowest, indent, len(indent), 1)
+		}, indent)
+	case *parser.MapLiteral:
+		entries := make([]parser.Node, len(e.Entries))
+		for k, v := range e.Entries {
+			entries[k] = v
+		}
+		body = p.wrapElements("{", "}", entries, e.RightBrace, func(k int, indent string) string {
+			key := flat(e.Entries[k].Key, lowest) + ": "
+			return key + p.wrap(e.Entries[k].Value, lowest, indent, len(indent)+len(key), 1)
+		}, indent)
+	default:
+		body = flatBody(e)
+	}
+	if parens {
+		return "(" + body + ")"
+	}
+	return body
+}
+
+// wrapChain breaks a chain of '&&' or '||' operators so that each operand
+// after the first starts a new line with the operator. Comments found between
+// operands are kept there.
+func (p *printer) wrapChain(e *parser.BinaryExpr, indent string, col int, tail int) string {
+	operands := chain(e, e.Op.Kind)
+	prec := precedence(e)
+	cont := indent + continuationUnit
+	op := e.Op.Value + " "
+
+	var b strings.Builder
+	b.WriteString(p.wrap(operands[0], prec, indent, col, 0))
+	for k, x := range operands[1:] {
+		b.WriteString(p.trailing(operands[k].End().Line))
+		b.WriteString("\n")
+		b.WriteString(p.leadingText(x.Pos(), cont))
+		b.WriteString(cont)
+		b.WriteString(op)
+		t := 0
+		if k == len(operands)-2 {
+			t = tail
+		}
+		b.WriteString(p.wrap(x, prec+1, cont, len(cont)+len(op), t))
+	}
+	return b.String()
+}
+
+// chain flattens a left-associative chain of the given operator.
+func chain(e parser.Expr, kind parser.Kind) []parser.Expr {
+	if be, ok := e.(*parser.BinaryExpr); ok && be.Op.Kind == kind {
+		return append(chain(be.Lhs, kind), be.Rhs)
+	}
+	return []parser.Expr{e}
+}
+
+// wrapList returns the arguments of a call separated by commas. Each argument
+// is wrapped as needed.
+func (p *printer) wrapList(list []parser.Expr, indent string, col int, tail int) string {
+	var b strings.Builder
+	for k, x := range list {
+		if k > 0 {
+			b.WriteString(", ")
+			col += 2
+		}
+		t := 1
+		if k == len(list)-1 {
+			t = tail
+		}
+		s := p.wrap(x, lowest, indent, col, t)
+		b.WriteString(s)
+		col = endCol(s, col)
+	}
+	return b.String()
+}
+
+// wrapElements puts each of the elements on a line of its own, indented one
+// level deeper than indent and followed by a comma. Comments between elements
+// are kept there.
+func (p *printer) wrapElements(open, close string, elements []parser.Node, end parser.Token, element func(int, string) string, indent string) string {
+	if len(elements) == 0 {
+		return open + close
+	}
+	inner := indent + indentUnit
+	var b strings.Builder
+	b.WriteString(open)
+	for k, x := range elements {
+		if k > 0 {
+			b.WriteString(p.trailing(elements[k-1].End().Line))
+		}
+		b.WriteString("\n")
+		b.WriteString(p.leadingText(x.Pos(), inner))
+		b.WriteString(inner)
+		b.WriteString(element(k, inner))
+		b.WriteString(",")
+	}
+	b.WriteString(p.trailing(elements[len(elements)-1].End().Line))
+	b.WriteString("\n")
+	b.WriteString(p.leadingText(end.Start, inner))
+	b.WriteString(indent)
+	b.WriteString(close)
+	return b.String()
+}
+
+// endCol returns the column just past s when s starts at column col.
+func endCol(s string, col int) int {
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		return len(s) - i - 1
+	}
+	return col + len(s)
+}
@@ -0,0 +1,294 @@
+// Package format prints rules files in a canonical layout: two-space
+// indentation, one statement per line, minimal parentheses, long '&&' and '||'
+// chains and array literals broken across lines, and comments kept close to
+// where they were written.
+package format
+
+import (
+	"strings"
+
+	"firestore-rules/src/parser"
+)
+
+// maxWidth is the column past which expressions are broken across lines.
+const maxWidth = 80
+
+const (
+	indentUnit       = "  "
+	continuationUnit = "    "
+)
+
+// Source parses src as a rules file and returns it formatted. If src does not
+// parse, the parse errors are returned and nothing is formatted.
+func Source(src []byte) ([]byte, error) {
+	rules, err := parser.ParseRules(parser.New(string(src)))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(Rules(rules)), nil
+}
+
+// Rules returns the formatted text of a parsed rules file, including the
+// comments in rules.Comments.
+func Rules(rules *parser.Rules) string {
+	p := &printer{comments: rules.Comments, lastLine: -1}
+	p.rules(rules)
+	return p.buf.String()
+}
+
+// Expr returns e on a single line with only the parentheses its structure
+// requires.
+func Expr(e parser.Expr) string {
+	return flat(e, lowest)
+}
+
+type printer struct {
+	buf      strings.Builder
+	indent   string
+	comments []parser.Token
+	next     int // index of the first comment not yet printed
+	lastLine int // source line of the last thing printed
+}
+
+func (p *printer) rules(rules *parser.Rules) {
+	if rules.Keyword.Kind == parser.RulesVersion {
+		p.leading(rules.Keyword.Start, false)
+		p.write("rules_version = " + rules.Version.Value + ";")
+		p.lastLine = rules.Version.End.Line
+		p.newline()
+		p.buf.WriteString("\n")
+	}
+	if rules.Service != nil {
+		p.service(rules.Service)
+	}
+	p.rest()
+}
+
+func (p *printer) service(ss *parser.ServiceStmt) {
+	p.leading(ss.Pos(), false)
+	p.write("service " + ss.Name.String() + " {")
+	p.lastLine = ss.Name.End().Line
+	p.block(ss.Statements, ss.RightBrace)
+	p.newline()
+}
+
+// block prints a list of statements followed by the closing brace, assuming
+// the opening brace has just been written.
+func (p *printer) block(list []parser.Stmt, rightBrace parser.Token) {
+	if len(list) == 0 && !p.hasCommentBefore(rightBrace.Start) {
+		p.buf.WriteString("}")
+		p.lastLine = rightBrace.Start.Line
+		return
+	}
+	p.newline()
+	p.indent += indentUnit
+	for k, s := range list {
+		p.leading(s.Pos(), k > 0)
+		p.stmt(s)
+		p.newline()
+	}
+	p.closing(rightBrace.Start)
+	p.indent = p.indent[:len(p.indent)-len(indentUnit)]
+	p.write("}")
+	p.lastLine = rightBrace.Start.Line
+}
+
+func (p *printer) stmt(s parser.Stmt) {
+	switch s := s.(type) {
+	case *parser.MatchStmt:
+		docType := ""
+		if s.HasDocType() {
+			docType = " is " + s.DocType.Value
+		}
+		p.write("match " + s.Path.String() + docType + " {")
+		p.lastLine = s.Keyword.Start.Line
+		p.block(s.Components, s.RightBrace)
+	case *parser.FunctionDef:
+		p.function(s)
+	case *parser.TypeDecl:
+		p.typeDecl(s)
+	case *parser.AllowStmt:
+		actions := make([]string, len(s.Actions))
+		for k, v := range s.Actions {
+			actions[k] = v.Value
+		}
+		p.exprLine("allow "+strings.Join(actions, ", ")+": if ", s.Condition, ";")
+	}
+}
+
+func (p *printer) function(fd *parser.FunctionDef) {
+	params := make([]string, len(fd.Params))
+	for k, v := range fd.Params {
+		params[k] = v.Name.Value
+	}
+	p.write("function " + fd.Name.Value + "(" + strings.Join(params, ", ") + ") {")
+	p.lastLine = fd.Name.End.Line
+	p.newline()
+	p.indent += indentUnit
+	for k, let := range fd.Lets {
+		p.leading(let.Pos(), k > 0)
+		p.exprLine("let "+let.Name.Value+" = ", let.Value, ";")
+		p.newline()
+	}
+	p.leading(fd.Return.Pos(), len(fd.Lets) > 0)
+	p.exprLine("return ", fd.Return, ";")
+	p.newline()
+	p.closing(fd.RightBrace.Start)
+	p.indent = p.indent[:len(p.indent)-len(indentUnit)]
+	p.write("}")
+	p.lastLine = fd.RightBrace.Start.Line
+}
+
+func (p *printer) typeDecl(td *parser.TypeDecl) {
+	p.write("type " + td.Name.Value + " {")
+	p.lastLine = td.Name.End.Line
+	if len(td.Fields) == 0 && !p.hasCommentBefore(td.RightBrace.Start) {
+		p.buf.WriteString("}")
+		p.lastLine = td.RightBrace.Start.Line
+		return
+	}
+	p.newline()
+	p.indent += indentUnit
+	for k, f := range td.Fields {
+		p.leading(f.Pos(), k > 0)
+		p.field(f)
+		p.newline()
+	}
+	p.closing(td.RightBrace.Start)
+	p.indent = p.indent[:len(p.indent)-len(indentUnit)]
+	p.write("}")
+	p.lastLine = td.RightBrace.Start.Line
+}
+
+// field writes a field declaration, with its conditions on lines of their
+// own.
+func (p *printer) field(f *parser.FieldDecl) {
+	if !f.HasConditions() {
+		p.write(f.String())
+		p.lastLine = f.End().Line
+		return
+	}
+	p.write(f.Head() + " {")
+	p.lastLine = f.LeftBrace.Start.Line
+	if len(f.Conditions) == 0 && !p.hasCommentBefore(f.RightBrace.Start) {
+		p.buf.WriteString("}")
+		p.lastLine = f.RightBrace.Start.Line
+		return
+	}
+	p.newline()
+	p.indent += indentUnit
+	for k, c := range f.Conditions {
+		p.leading(c.Pos(), k > 0)
+		p.exprLine(c.Name.Value+": ", c.Cond, ";")
+		p.newline()
+	}
+	p.closing(f.RightBrace.Start)
+	p.indent = p.indent[:len(p.indent)-len(indentUnit)]
+	p.write("}")
+	p.lastLine = f.RightBrace.Start.Line
+}
+
+// exprLine writes prefix, e and suffix starting a new line, breaking e across
+// lines if it does not fit.
+func (p *printer) exprLine(prefix string, e parser.Expr, suffix string) {
+	col := len(p.indent) + len(prefix)
+	s := p.wrap(e, lowest, p.indent, col, len(suffix))
+	p.write(prefix + s + suffix)
+	p.lastLine = e.End().Line
+}
+
+func (p *printer) write(s string) {
+	p.buf.WriteString(p.indent)
+	p.buf.WriteString(s)
+}
+
+// newline ends the current line, first appending any comments that were on
+// the same source line as the last thing printed.
+func (p *printer) newline() {
+	p.buf.WriteString(p.trailing(p.lastLine))
+	p.buf.WriteString("\n")
+}
+
+func (p *printer) hasCommentBefore(pos parser.InputPosition) bool {
+	return p.next < len(p.comments) && p.comments[p.next].Start.Pos < pos.Pos
+}
+
+// trailing returns the unprinted comments that start on the given source
+// line, formatted to go at the end of the current output line.
+func (p *printer) trailing(line int) string {
+	var b strings.Builder
+	for p.next < len(p.comments) && p.comments[p.next].Start.Line == line {
+		b.WriteString(" ")
+		b.WriteString(p.comments[p.next].Value)
+		p.next++
+	}
+	return b.String()
+}
+
+// leading writes every unprinted comment that starts before pos on lines of
+// its own. A single blank line is kept wherever the source had one or more,
+// except at the start of a block where blank is false.
+func (p *printer) leading(pos parser.InputPosition, blank bool) {
+	for p.hasCommentBefore(pos) {
+		p.ownLine(blank)
+		blank = true
+	}
+	if blank && pos.Line-p.lastLine > 1 {
+		p.buf.WriteString("\n")
+	}
+}
+
+// closing writes the comments before the closing brace at pos. Blank lines
+// are kept between comments but never directly before the brace.
+func (p *printer) closing(pos parser.InputPosition) {
+	for p.hasCommentBefore(pos) {
+		p.ownLine(true)
+	}
+}
+
+// rest writes the comments that follow everything else in the file.
+func (p *printer) rest() {
+	for p.next < len(p.comments) {
+		p.ownLine(true)
+	}
+}
+
+// ownLine writes the next comment on a line of its own.
+func (p *printer) ownLine(blank bool) {
+	c := p.comments[p.next]
+	if blank && c.Start.Line-p.lastLine > 1 {
+		p.buf.WriteString("\n")
+	}
+	p.write(reindent(c, p.indent))
+	p.buf.WriteString("\n")
+	p.lastLine = c.End.Line
+	p.next++
+}
+
+// leadingText is like leading but returns the comments as text, each on a
+// line of its own with the given indent, for use inside a broken expression.
+func (p *printer) leadingText(pos parser.InputPosition, indent string) string {
+	var b strings.Builder
+	for p.hasCommentBefore(pos) {
+		b.WriteString(indent)
+		b.WriteString(reindent(p.comments[p.next], indent))
+		b.WriteString("\n")
+		p.next++
+	}
+	return b.String()
+}
+
+// reindent moves the second and later lines of a block comment so that they
+// keep their position relative to the first line once it is printed at indent.
+func reindent(c parser.Token, indent string) string {
+	lines := strings.Split(c.Value, "\n")
+	for k := 1; k < len(lines); k++ {
+		line := lines[k]
+		n := 0
+		for n < len(line) && n < c.Start.Col && (line[n] == ' ' || line[n] == '\t') {
+			n++
+		}
+		lines[k] = indent + line[n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,252 @@
+package format
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"firestore-rules/src/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpr(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"((a + b))", "a + b"},
+		{"a + (b * c)", "a + b * c"},
+		{"(a + b) * c", "(a + b) * c"},
+		{"a - (b - c)", "a - (b - c)"},
+		{"(a - b) - c", "a - b - c"},
+		{"(a || b) && c", "(a || b) && c"},
+		{"a || (b && c)", "a || b && c"},
+		{"!(a == b)", "!(a == b)"},
+		{"(!a) == b", "!a == b"},
+		{"-(a.b)", "-a.b"},
+		{"(a + b).size()", "(a + b).size()"},
+		{"(a)[(b)]", "a[b]"},
+		{"(a ? b : c) ? d : e", "(a ? b : c) ? d : e"},
+		{"a ? (b ? c : d) : (e || f)", "a ? b ? c : d : e || f"},
+		{"f((a), [(b), {'k': (c)}])", "f(a, [b, {'k': c}])"},
+		{"get(/databases/$(database)/documents/users/$((request.auth.uid)))", "get(/databases/$(database)/documents/users/$(request.auth.uid))"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			e, err := parser.ParseExpr(parser.New(test.input))
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, Expr(e))
+		})
+	}
+}
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "layout",
+			input:    "rules_version='2';service cloud.firestore{match /a/{b}{allow read,write:if (true);}}",
+			expected: "rules_version = '2';\n\nservice cloud.firestore {\n  match /a/{b} {\n    allow read, write: if true;\n  }\n}\n",
+		},
+		{
+			name:     "empty match",
+			input:    "rules_version = '2';\nservice cloud.firestore {\n  match /a/{b=**} {\n  }\n}\n",
+			expected: "rules_version = '2';\n\nservice cloud.firestore {\n  match /a/{b=**} {}\n}\n",
+		},
+		{
+			name: "blank lines",
+			input: `rules_version = '2';
+service cloud.firestore {
+
+  match /a/{b} {
+    function f(x, y) {
+      let z = x;
+
+
+      return z == y;
+    }
+    allow read: if f(1, 2);
+  }
+}
+`,
+			expected: `rules_version = '2';
+
+service cloud.firestore {
+  match /a/{b} {
+    function f(x, y) {
+      let z = x;
+
+      return z == y;
+    }
+    allow read: if f(1, 2);
+  }
+}
+`,
+		},
+		{
+			name: "long chain",
+			input: `rules_version = '2';
+service cloud.firestore {
+  match /a/{b} {
+    allow create: if request.auth != null && request.auth.uid == request.resource.data.owner && request.resource.data.size() < 10;
+  }
+}
+`,
+			expected: `rules_version = '2';
+
+service cloud.firestore {
+  match /a/{b} {
+    allow create: if request.auth != null
+        && request.auth.uid == request.resource.data.owner
+        && request.resource.data.size() < 10;
+  }
+}
+`,
+		},
+		{
+			name: "long list",
+			input: `rules_version = '2';
+service cloud.firestore {
+  match /a/{b} {
+    allow create: if request.resource.data.keys().hasOnly(['first', 'second', 'third', 'fourth']);
+  }
+}
+`,
+			expected: `rules_version = '2';
+
+service cloud.firestore {
+  match /a/{b} {
+    allow create: if request.resource.data.keys().hasOnly([
+      'first',
+      'second',
+      'third',
+      'fourth',
+    ]);
+  }
+}
+`,
+		},
+		{
+			name: "types",
+			input: `rules_version = '2';
+service cloud.firestore {
+  type Empty {   }
+  match /a/{b} {
+    type   T {
+      title :string< 100 > ; // the title
+      immutable   tags ?: list<string,20>;
+
+      // optional
+      note?:string;}
+  }
+  match /c/{d}   is   Empty {
+  }
+  type Issue {
+    id: string {
+      invariant: ${value}==${doc} ; // the id
+      allowUpdateIf: ${ value . prev }==${value}; }
+    note?: string {}
+  }
+}
+`,
+			expected: `rules_version = '2';
+
+service cloud.firestore {
+  type Empty {}
+  match /a/{b} {
+    type T {
+      title: string<100>; // the title
+      immutable tags?: list<string, 20>;
+
+      // optional
+      note?: string;
+    }
+  }
+  match /c/{d} is Empty {}
+  type Issue {
+    id: string {
+      invariant: ${value} == ${doc}; // the id
+      allowUpdateIf: ${value.prev} == ${value};
+    }
+    note?: string {}
+  }
+}
+`,
+		},
+		{
+			name: "comments",
+			input: `// header
+rules_version = '2'; // version
+service cloud.firestore {
+      /* block
+       * comment */
+  match /a/{b} { // trailing
+    allow read: if a // first
+      // between
+      && b;
+    allow write: if x in [
+      'a', // one
+      // two
+      'b'
+      // end
+    ];
+  }
+  // last in block
+}
+// footer
+`,
+			expected: `// header
+rules_version = '2'; // version
+
+service cloud.firestore {
+  /* block
+   * comment */
+  match /a/{b} { // trailing
+    allow read: if a // first
+        // between
+        && b;
+    allow write: if x in [
+      'a', // one
+      // two
+      'b',
+      // end
+    ];
+  }
+  // last in block
+}
+// footer
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := Source([]byte(test.input))
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, string(out))
+		})
+	}
+}
+
+func TestSourceError(t *testing.T) {
+	out, err := Source([]byte("rules_version = '2'; service cloud.firestore { match /a/{b} { allow read: if ; } }"))
+	assert.NotNil(t, err)
+	assert.Nil(t, out)
+}
+
+func TestSourceIdempotent(t *testing.T) {
+	src, err := ioutil.ReadFile("../../testdata/firestore.rules")
+	assert.Nil(t, err)
+	once, err := Source(src)
+	assert.Nil(t, err)
+	twice, err := Source(once)
+	assert.Nil(t, err)
+	assert.Equal(t, string(once), string(twice))
+
+	before, err := parser.ParseRules(parser.New(string(src)))
+	assert.Nil(t, err)
+	after, err := parser.ParseRules(parser.New(string(once)))
+	assert.Nil(t, err)
+	assert.Equal(t, before.String(), after.String())
+}
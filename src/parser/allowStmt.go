@@ -6,21 +6,30 @@ import (
 )
 
 type AllowStmt struct {
-	Stmt
-	actions   []Token
-	condition Expr
+	Keyword   Token
+	Actions   []Token
+	Condition Expr
+	SemiColon Token
 }
 
 func (as *AllowStmt) String() string {
-	a := make([]string, len(as.actions))
-	for k, v := range as.actions {
+	a := make([]string, len(as.Actions))
+	for k, v := range as.Actions {
 		a[k] = v.String()
 	}
-	return fmt.Sprintf("allow %s: if %s;", strings.Join(a, ", "), as.condition)
+	return fmt.Sprintf("allow %s: if %s;", strings.Join(a, ", "), as.Condition)
+}
+
+func (as *AllowStmt) Pos() InputPosition {
+	return as.Keyword.Start
+}
+
+func (as *AllowStmt) End() InputPosition {
+	return as.SemiColon.End
 }
 
 func ParseAllowStmt(tokens *Tokens) (*AllowStmt, error) {
-	_, err := tokens.Accept(Allow)
+	keyword, err := tokens.Accept(Allow)
 	if err != nil {
 		return nil, err
 	}
@@ -40,11 +49,11 @@ func ParseAllowStmt(tokens *Tokens) (*AllowStmt, error) {
 	if err != nil {
 		return nil, err
 	}
-	_, err = tokens.Accept(SemiColon)
+	semi, err := tokens.Accept(SemiColon)
 	if err != nil {
 		return nil, err
 	}
-	return &AllowStmt{actions: actions, condition: expr}, nil
+	return &AllowStmt{Keyword: keyword, Actions: actions, Condition: expr, SemiColon: semi}, nil
 }
 
 func ParseActionNameList(tokens *Tokens) ([]Token, error) {
@@ -57,7 +66,7 @@ func ParseActionNameList(tokens *Tokens) ([]Token, error) {
 	for {
 		switch tokens.Peek().Kind {
 		case Comma:
-			tokens.Accept(Comma)
+			tokens.AcceptAny()
 			action, err := ParseActionName(tokens)
 			if err != nil {
 				return nil, err
@@ -67,11 +76,7 @@ func ParseActionNameList(tokens *Tokens) ([]Token, error) {
 			return actions, nil
 		default:
 			badToken := tokens.AcceptAny()
-			return nil, LexError{
-				Start: badToken.Start,
-				Pos:   badToken.End,
-				msg:   fmt.Sprintf("unexpected token in accept list: (%s)", badToken),
-			}
+			return nil, unexpected(badToken, "unexpected token in accept list: (%s)")
 		}
 	}
 }
@@ -81,10 +86,6 @@ func ParseActionName(tokens *Tokens) (Token, error) {
 	if IsAction(result.Kind) {
 		return result, nil
 	} else {
-		return Token{Kind: Error}, &LexError{
-			Start: result.Start,
-			Pos:   result.End,
-			msg:   fmt.Sprintf("unexpected token in accept list (%s)", result),
-		}
+		return Token{Kind: Error}, unexpected(result, "unexpected token in accept list (%s)")
 	}
 }
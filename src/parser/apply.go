@@ -0,0 +1,289 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// An ApplyFunc is invoked by Apply for each node n, even if n is nil, before
+// and/or after the node's children, using a Cursor describing the current node
+// and providing operations on it.
+//
+// The return value of ApplyFunc controls the syntax tree traversal.
+// See Apply for details.
+type ApplyFunc func(*Cursor) bool
+
+// Apply traverses a syntax tree recursively, starting with root, and calling
+// pre and post for each node as described below. Apply returns the syntax tree,
+// possibly modified.
+//
+// If pre is not nil, it is called for each node before the node's children are
+// traversed (pre-order). If pre returns false, no children are traversed, and
+// post is not called for that node.
+//
+// If post is not nil, and a prior call of pre didn't return false, post is
+// called for each node after its children are traversed (post-order). If post
+// returns false, traversal is terminated and Apply returns immediately.
+//
+// Only fields that refer to nodes are traversed; they are traversed in the
+// same order as Walk. If pre replaces the current node, the children of the
+// replacement are traversed instead. Nodes inserted with InsertBefore or
+// InsertAfter are not traversed.
+func Apply(root Node, pre, post ApplyFunc) (result Node) {
+	holder := &rootHolder{root}
+	defer func() {
+		if r := recover(); r != nil && r != abort {
+			panic(r)
+		}
+		result = holder.Node
+	}()
+	a := &applier{pre: pre, post: post}
+	a.apply(&Cursor{parent: holder, name: "Node", node: root, set: func(n Node) { holder.Node = n }})
+	return holder.Node
+}
+
+var abort = new(int) // singleton, to signal termination of Apply
+
+// rootHolder is the parent of the root node passed to Apply.
+type rootHolder struct {
+	Node
+}
+
+// A Cursor describes a node encountered during Apply. Information about the
+// node and its parent is available from the Node, Parent, Name and Index
+// methods.
+type Cursor struct {
+	parent Node
+	name   string
+	node   Node
+	list   reflect.Value // the slice holding node, if any
+	iter   *iterator
+	set    func(Node)
+}
+
+// iterator tracks the position of a Cursor within a slice of nodes.
+type iterator struct {
+	index, step int
+}
+
+// Node returns the current Node.
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent returns the parent of the current Node.
+func (c *Cursor) Parent() Node { return c.parent }
+
+// Name returns the name of the parent Node field that contains the current
+// Node. If the parent is the root holder created by Apply, Name returns
+// "Node". The components of a Path are not held in a field, so for them Name
+// returns "".
+func (c *Cursor) Name() string { return c.name }
+
+// Index reports the index >= 0 of the current Node in the slice of Nodes that
+// contains it, or a value < 0 if the current Node is not part of a slice.
+// The index of the current node changes if InsertBefore is called while
+// processing the current node.
+func (c *Cursor) Index() int {
+	if c.iter != nil {
+		return c.iter.index
+	}
+	return -1
+}
+
+// Replace replaces the current Node with n.
+func (c *Cursor) Replace(n Node) {
+	if c.iter != nil {
+		c.list.Index(c.iter.index).Set(nodeValue(n, c.list.Type().Elem()))
+	} else {
+		c.set(n)
+	}
+	c.node = n
+}
+
+// Delete deletes the current Node from its containing slice. If the current
+// Node is not part of a slice, Delete panics.
+func (c *Cursor) Delete() {
+	if c.iter == nil {
+		panic("Delete node not contained in slice")
+	}
+	i := c.iter.index
+	l := c.list.Len()
+	reflect.Copy(c.list.Slice(i, l), c.list.Slice(i+1, l))
+	c.list.Index(l - 1).Set(reflect.Zero(c.list.Type().Elem()))
+	c.list.SetLen(l - 1)
+	c.iter.step--
+	c.node = nil
+}
+
+// InsertAfter inserts n after the current Node in its containing slice. If the
+// current Node is not part of a slice, InsertAfter panics. Apply does not walk
+// n.
+func (c *Cursor) InsertAfter(n Node) {
+	if c.iter == nil {
+		panic("InsertAfter node not contained in slice")
+	}
+	c.insert(c.iter.index+1, n)
+	c.iter.step++
+}
+
+// InsertBefore inserts n before the current Node in its containing slice. If
+// the current Node is not part of a slice, InsertBefore panics. Apply will not
+// walk n.
+func (c *Cursor) InsertBefore(n Node) {
+	if c.iter == nil {
+		panic("InsertBefore node not contained in slice")
+	}
+	c.insert(c.iter.index, n)
+	c.iter.index++
+}
+
+func (c *Cursor) insert(i int, n Node) {
+	c.list.Set(reflect.Append(c.list, reflect.Zero(c.list.Type().Elem())))
+	l := c.list.Len()
+	reflect.Copy(c.list.Slice(i+1, l), c.list.Slice(i, l))
+	c.list.Index(i).Set(nodeValue(n, c.list.Type().Elem()))
+}
+
+// nodeValue converts n for storing in a slice with element type t.
+func nodeValue(n Node, t reflect.Type) reflect.Value {
+	if n == nil {
+		return reflect.Zero(t)
+	}
+	return reflect.ValueOf(n)
+}
+
+type applier struct {
+	pre, post ApplyFunc
+}
+
+func (a *applier) apply(c *Cursor) {
+	if a.pre != nil && !a.pre(c) {
+		return
+	}
+	if c.node != nil {
+		a.applyChildren(c)
+	}
+	if a.post != nil && !a.post(c) {
+		panic(abort)
+	}
+}
+
+// field applies to a single child node held in a field of parent.
+func (a *applier) field(parent Node, name string, n Node, set func(Node)) {
+	a.apply(&Cursor{parent: parent, name: name, node: n, set: set})
+}
+
+// list applies to each node of the slice that ptr points to.
+func (a *applier) list(parent Node, name string, ptr interface{}) {
+	list := reflect.ValueOf(ptr).Elem()
+	iter := &iterator{}
+	for iter.index < list.Len() {
+		iter.step = 1
+		n, _ := list.Index(iter.index).Interface().(Node)
+		a.apply(&Cursor{parent: parent, name: name, node: n, list: list, iter: iter})
+		iter.index += iter.step
+	}
+}
+
+func (a *applier) applyChildren(c *Cursor) {
+	switch n := c.node.(type) {
+	case *Rules:
+		if n.Service != nil {
+			a.field(n, "Service", n.Service, func(x Node) { n.Service, _ = x.(*ServiceStmt) })
+		}
+
+	case *ServiceStmt:
+		if n.Name != nil {
+			a.field(n, "Name", n.Name, func(x Node) { n.Name, _ = x.(*ServiceName) })
+		}
+		a.list(n, "Statements", &n.Statements)
+
+	case *ServiceName:
+		// nothing to do
+
+	case *MatchStmt:
+		if n.Path != nil {
+			a.field(n, "Path", n.Path, func(x Node) { n.Path, _ = x.(Path) })
+		}
+		a.list(n, "Components", &n.Components)
+
+	case Path:
+		// A Path is a slice rather than a pointer, so deletions and insertions
+		// have to be written back to the field it came from.
+		p := n
+		a.list(n, "", &p)
+		c.set(p)
+		c.node = p
+
+	case Component:
+		// nothing to do
+
+	case *AllowStmt:
+		a.field(n, "Condition", n.Condition, func(x Node) { n.Condition, _ = x.(Expr) })
+
+	case *FunctionDef:
+		a.list(n, "Params", &n.Params)
+		a.list(n, "Lets", &n.Lets)
+		a.field(n, "Return", n.Return, func(x Node) { n.Return, _ = x.(Expr) })
+
+	case Param:
+		// nothing to do
+
+	case *LetDef:
+		a.field(n, "Value", n.Value, func(x Node) { n.Value, _ = x.(Expr) })
+
+	case *TypeDecl:
+		a.list(n, "Fields", &n.Fields)
+
+	case *FieldDecl:
+		a.field(n, "Type", n.Type, func(x Node) { n.Type, _ = x.(*TypeRef) })
+		a.list(n, "Conditions", &n.Conditions)
+
+	case *FieldCondition:
+		a.field(n, "Cond", n.Cond, func(x Node) { n.Cond, _ = x.(Expr) })
+
+	case *TypeRef:
+		if n.Elem != nil {
+			a.field(n, "Elem", n.Elem, func(x Node) { n.Elem, _ = x.(*TypeRef) })
+		}
+
+	case *TernaryExpr:
+		a.field(n, "Cond", n.Cond, func(x Node) { n.Cond, _ = x.(Expr) })
+		a.field(n, "True", n.True, func(x Node) { n.True, _ = x.(Expr) })
+		a.field(n, "False", n.False, func(x Node) { n.False, _ = x.(Expr) })
+
+	case *BinaryExpr:
+		a.field(n, "Lhs", n.Lhs, func(x Node) { n.Lhs, _ = x.(Expr) })
+		a.field(n, "Rhs", n.Rhs, func(x Node) { n.Rhs, _ = x.(Expr) })
+
+	case *UnaryExpr:
+		a.field(n, "Operand", n.Operand, func(x Node) { n.Operand, _ = x.(Expr) })
+
+	case *Id, *Literal, *Placeholder:
+		// nothing to do
+
+	case *FunctionCall:
+		a.field(n, "Fn", n.Fn, func(x Node) { n.Fn, _ = x.(Expr) })
+		a.list(n, "Args", &n.Args)
+
+	case *ArrayLiteral:
+		a.list(n, "Elements", &n.Elements)
+
+	case *MapLiteral:
+		a.list(n, "Entries", &n.Entries)
+
+	case *MapEntry:
+		a.field(n, "Key", n.Key, func(x Node) { n.Key, _ = x.(Expr) })
+		a.field(n, "Value", n.Value, func(x Node) { n.Value, _ = x.(Expr) })
+
+	case *PathExpr:
+		a.list(n, "Segments", &n.Segments)
+
+	case *PathSegment:
+		if n.Expr != nil {
+			a.field(n, "Expr", n.Expr, func(x Node) { n.Expr, _ = x.(Expr) })
+		}
+
+	default:
+		panic(fmt.Sprintf("parser.Apply: unexpected node type %T", n))
+	}
+}
@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestApplyReplace(t *testing.T) {
+	expr, err := ParseExpr(New("a + f(a, b) * a"))
+	assert.Nil(t, err)
+	result := Apply(expr, func(c *Cursor) bool {
+		if id, ok := c.Node().(*Id); ok && id.Name.Value == "a" {
+			c.Replace(&Literal{Token{Kind: IntLiteral, Value: "1"}})
+		}
+		return true
+	}, nil)
+	assert.Equal(t, "(1 + (f(1, b) * 1))", result.(Expr).String())
+}
+
+func TestApplyReplaceRoot(t *testing.T) {
+	expr, err := ParseExpr(New("a"))
+	assert.Nil(t, err)
+	result := Apply(expr, nil, func(c *Cursor) bool {
+		assert.Equal(t, "Node", c.Name())
+		c.Replace(&Id{Token{Kind: Identifier, Value: "b"}})
+		return true
+	})
+	assert.Equal(t, "b", result.(Expr).String())
+}
+
+func TestApplyDelete(t *testing.T) {
+	expr, err := ParseExpr(New("[1, 2, 3, 4, 5]"))
+	assert.Nil(t, err)
+	var seen []string
+	Apply(expr, func(c *Cursor) bool {
+		if lit, ok := c.Node().(*Literal); ok {
+			seen = append(seen, lit.Value.Value)
+			if lit.Value.Value == "2" || lit.Value.Value == "3" {
+				c.Delete()
+			}
+		}
+		return true
+	}, nil)
+	assert.Equal(t, "[1, 4, 5]", expr.String())
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, seen)
+}
+
+func TestApplyInsert(t *testing.T) {
+	ms, err := ParseMatchStmt(New("match /a/{b} { allow read: if true; allow write: if false; }"))
+	assert.Nil(t, err)
+	fn, err := ParseFunctionDef(New("function f() { return 1; }"))
+	assert.Nil(t, err)
+	allow, err := ParseAllowStmt(New("allow delete: if f();"))
+	assert.Nil(t, err)
+	var indexes []int
+	Apply(ms, func(c *Cursor) bool {
+		if as, ok := c.Node().(*AllowStmt); ok {
+			assert.Equal(t, "Components", c.Name())
+			assert.Equal(t, ms, c.Parent())
+			if as.Actions[0].Kind == Read {
+				c.InsertBefore(fn)
+			} else {
+				c.InsertAfter(allow)
+			}
+			indexes = append(indexes, c.Index())
+		}
+		return true
+	}, nil)
+	assert.Equal(t, []int{1, 2}, indexes)
+	assert.Equal(t,
+		"match /a/{b} {function f () {  return 1; }  allow read: if true;  allow write: if false;  allow delete: if f();}",
+		ms.String())
+}
+
+func TestApplyPathComponents(t *testing.T) {
+	ms, err := ParseMatchStmt(New("match /a/{b}/c { }"))
+	assert.Nil(t, err)
+	Apply(ms, func(c *Cursor) bool {
+		if comp, ok := c.Node().(Component); ok && comp.Wildcard {
+			c.Delete()
+		}
+		return true
+	}, nil)
+	assert.Equal(t, "/a/c", ms.Path.String())
+}
+
+func TestApplyAbort(t *testing.T) {
+	expr, err := ParseExpr(New("a && b && c"))
+	assert.Nil(t, err)
+	var ids []string
+	Apply(expr, nil, func(c *Cursor) bool {
+		if id, ok := c.Node().(*Id); ok {
+			ids = append(ids, id.Name.Value)
+			return id.Name.Value != "b"
+		}
+		return true
+	})
+	assert.Equal(t, []string{"a", "b"}, ids)
+}
+
+func TestApplyDeleteOutsideSlicePanics(t *testing.T) {
+	expr, err := ParseExpr(New("!a"))
+	assert.Nil(t, err)
+	assert.Panics(t, func() {
+		Apply(expr, func(c *Cursor) bool {
+			if _, ok := c.Node().(*Id); ok {
+				c.Delete()
+			}
+			return true
+		}, nil)
+	})
+}
@@ -6,47 +6,48 @@ import (
 )
 
 type ArrayLiteral struct {
-	elements []Expr
+	LeftBracket  Token
+	Elements     []Expr
+	RightBracket Token
 }
 
 func (al *ArrayLiteral) String() string {
-	result := make([]string, len(al.elements))
-	for k, v := range al.elements {
+	result := make([]string, len(al.Elements))
+	for k, v := range al.Elements {
 		result[k] = v.String()
 	}
 	return fmt.Sprintf("[%s]", strings.Join(result, ", "))
 }
 
+func (al *ArrayLiteral) Pos() InputPosition {
+	return al.LeftBracket.Start
+}
+
+func (al *ArrayLiteral) End() InputPosition {
+	return al.RightBracket.End
+}
+
 func ParseArrayLiteral(tokens *Tokens) (*ArrayLiteral, error) {
 	elts := make([]Expr, 0)
-	_, err := tokens.Accept(LeftSquareBracket)
-	if err != nil {
-		return nil, err
-	}
-	_, err = ParseExpr(tokens)
+	leftBracket, err := tokens.Accept(LeftSquareBracket)
 	if err != nil {
 		return nil, err
 	}
 	for {
+		if tokens.Peek().Kind == RightSquareBracket {
+			return &ArrayLiteral{leftBracket, elts, tokens.AcceptAny()}, nil
+		}
+		exp, err := ParseExpr(tokens)
+		if err != nil {
+			return nil, err
+		}
+		elts = append(elts, exp)
 		switch tokens.Peek().Kind {
 		case Comma:
-			_, _ = tokens.Accept(Comma)
-			exp, err := ParseExpr(tokens)
-			if err != nil {
-				return nil, err
-			}
-			elts = append(elts, exp)
+			tokens.AcceptAny()
 		case RightSquareBracket:
-			_, _ = tokens.Accept(RightSquareBracket)
-			return &ArrayLiteral{elts}, nil
 		default:
-			t := tokens.Peek()
-			return nil, LexError{
-				Start: t.Start,
-				Pos:   t.End,
-				msg:   fmt.Sprintf("unexpected token in array literal (%s)", t),
-			}
+			return nil, unexpected(tokens.Peek(), "unexpected token in array literal (%s)")
 		}
-
 	}
 }
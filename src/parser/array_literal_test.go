@@ -0,0 +1,24 @@
+package parser
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestArrayLiteral(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"[a]", "[a]"},
+		{"[1, 2]", "[1, 2]"},
+		{"[a, b, c]", "[a, b, c]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			al, err := ParseArrayLiteral(New(test.name))
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, al.String())
+		})
+	}
+}
@@ -6,65 +6,130 @@ import (
 )
 
 type Expr interface {
+	Node
 	String() string
 }
 
 type TernaryExpr struct {
-	cond Expr
-	t    Expr
-	f    Expr
+	Cond  Expr
+	True  Expr
+	False Expr
 }
 
 func (ter *TernaryExpr) String() string {
-	return fmt.Sprintf("(%s ? %s : %s)", ter.cond, ter.t, ter.f)
+	return fmt.Sprintf("(%s ? %s : %s)", ter.Cond, ter.True, ter.False)
 }
 
+func (ter *TernaryExpr) Pos() InputPosition {
+	return ter.Cond.Pos()
+}
+
+func (ter *TernaryExpr) End() InputPosition {
+	return ter.False.End()
+}
+
+// BinaryExpr is an infix operation. Field access (a.b) and indexing (a[b]) are
+// also represented as BinaryExprs, with Op being the '.' or '[' token. For
+// field access Rhs is always an *Id, and for indexing RightBracket is the
+// closing ']'.
 type BinaryExpr struct {
-	op  Token
-	lhs Expr
-	rhs Expr
+	Op           Token
+	Lhs          Expr
+	Rhs          Expr
+	RightBracket Token
 }
 
 func (be *BinaryExpr) String() string {
-	return fmt.Sprintf("%s %s %s", be.lhs.String(), be.op.String(), be.rhs.String())
+	switch be.Op.Kind {
+	case Dot:
+		return fmt.Sprintf("%s.%s", be.Lhs, be.Rhs)
+	case LeftSquareBracket:
+		return fmt.Sprintf("%s[%s]", be.Lhs, be.Rhs)
+	default:
+		return fmt.Sprintf("(%s %s %s)", be.Lhs.String(), be.Op.String(), be.Rhs.String())
+	}
+}
+
+func (be *BinaryExpr) Pos() InputPosition {
+	return be.Lhs.Pos()
+}
+
+func (be *BinaryExpr) End() InputPosition {
+	if be.Op.Kind == LeftSquareBracket {
+		return be.RightBracket.End
+	}
+	return be.Rhs.End()
 }
 
 type UnaryExpr struct {
-	op      Token
-	operand Expr
+	Op      Token
+	Operand Expr
 }
 
 func (ue *UnaryExpr) String() string {
-	return fmt.Sprintf("%s%s", ue.op, ue.operand)
+	return fmt.Sprintf("(%s%s)", ue.Op, ue.Operand)
+}
+
+func (ue *UnaryExpr) Pos() InputPosition {
+	return ue.Op.Start
+}
+
+func (ue *UnaryExpr) End() InputPosition {
+	return ue.Operand.End()
 }
 
 type Id struct {
-	id Token
+	Name Token
 }
 
 func (id *Id) String() string {
-	return fmt.Sprintf("%s", id.id.Value)
+	return fmt.Sprintf("%s", id.Name.Value)
+}
+
+func (id *Id) Pos() InputPosition {
+	return id.Name.Start
+}
+
+func (id *Id) End() InputPosition {
+	return id.Name.End
 }
 
 type Literal struct {
-	value Token
+	Value Token
 }
 
 func (lit *Literal) String() string {
-	return lit.value.String()
+	return lit.Value.String()
+}
+
+func (lit *Literal) Pos() InputPosition {
+	return lit.Value.Start
+}
+
+func (lit *Literal) End() InputPosition {
+	return lit.Value.End
 }
 
 type FunctionCall struct {
-	fn   Expr
-	args []Expr
+	Fn         Expr
+	Args       []Expr
+	RightParen Token
 }
 
 func (fc *FunctionCall) String() string {
-	argList := make([]string, len(fc.args))
-	for k, arg := range fc.args {
+	argList := make([]string, len(fc.Args))
+	for k, arg := range fc.Args {
 		argList[k] = arg.String()
 	}
-	return fmt.Sprintf("%s(%s)", fc.fn, strings.Join(argList, ", "))
+	return fmt.Sprintf("%s(%s)", fc.Fn, strings.Join(argList, ", "))
+}
+
+func (fc *FunctionCall) Pos() InputPosition {
+	return fc.Fn.Pos()
+}
+
+func (fc *FunctionCall) End() InputPosition {
+	return fc.RightParen.End
 }
 
 func ParseExpr(tokens *Tokens) (Expr, error) {
@@ -90,7 +155,7 @@ func ParseTernary(tokens *Tokens) (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		return &TernaryExpr{x, y, z}, nil
+		return &TernaryExpr{Cond: x, True: y, False: z}, nil
 	} else {
 		return x, nil
 	}
@@ -109,7 +174,7 @@ func ParseOrExprList(tokens *Tokens) (Expr, error) {
 			if err != nil {
 				return nil, err
 			}
-			result = &BinaryExpr{op, result, rhs}
+			result = &BinaryExpr{Op: op, Lhs: result, Rhs: rhs}
 		default:
 			return result, nil
 		}
@@ -129,7 +194,7 @@ func ParseAndExprList(tokens *Tokens) (Expr, error) {
 			if err != nil {
 				return nil, err
 			}
-			result = &BinaryExpr{op, result, rhs}
+			result = &BinaryExpr{Op: op, Lhs: result, Rhs: rhs}
 		default:
 			return result, nil
 		}
@@ -149,7 +214,7 @@ func ParseEqExprList(tokens *Tokens) (Expr, error) {
 			if err != nil {
 				return nil, err
 			}
-			result = &BinaryExpr{op, result, rhs}
+			result = &BinaryExpr{Op: op, Lhs: result, Rhs: rhs}
 		default:
 			return result, nil
 		}
@@ -169,7 +234,7 @@ func ParseInExprList(tokens *Tokens) (Expr, error) {
 			if err != nil {
 				return nil, err
 			}
-			result = &BinaryExpr{op, result, rhs}
+			result = &BinaryExpr{Op: op, Lhs: result, Rhs: rhs}
 		default:
 			return result, nil
 		}
@@ -189,7 +254,7 @@ func ParseRelationalExprList(tokens *Tokens) (Expr, error) {
 			if err != nil {
 				return nil, err
 			}
-			result = &BinaryExpr{op, result, rhs}
+			result = &BinaryExpr{Op: op, Lhs: result, Rhs: rhs}
 		default:
 			return result, nil
 		}
@@ -197,7 +262,7 @@ func ParseRelationalExprList(tokens *Tokens) (Expr, error) {
 }
 
 func ParseAdditiveExprList(tokens *Tokens) (Expr, error) {
-	result, err:= ParseMultiplicativeExprList(tokens)
+	result, err := ParseMultiplicativeExprList(tokens)
 	if err != nil {
 		return nil, err
 	}
@@ -209,7 +274,7 @@ func ParseAdditiveExprList(tokens *Tokens) (Expr, error) {
 			if err != nil {
 				return nil, err
 			}
-			result = &BinaryExpr{op, result, rhs}
+			result = &BinaryExpr{Op: op, Lhs: result, Rhs: rhs}
 		default:
 			return result, nil
 		}
@@ -229,7 +294,7 @@ func ParseMultiplicativeExprList(tokens *Tokens) (Expr, error) {
 			if err != nil {
 				return nil, err
 			}
-			result = &BinaryExpr{op, result, rhs}
+			result = &BinaryExpr{Op: op, Lhs: result, Rhs: rhs}
 		default:
 			return result, nil
 		}
@@ -245,7 +310,7 @@ func ParseUnaryExpr(tokens *Tokens) (Expr, error) {
 			if err != nil {
 				return nil, err
 			}
-			return &UnaryExpr{op, operand}, nil
+			return &UnaryExpr{Op: op, Operand: operand}, nil
 		default:
 			return ParseTerm(tokens)
 		}
@@ -262,30 +327,33 @@ func ParseTerm(tokens *Tokens) (Expr, error) {
 		switch tokens.Peek().Kind {
 		case Dot:
 			dot := tokens.AcceptAny()
-			rhs, err := tokens.Accept(Identifier)
-			if err != nil {
-				return nil, err
+			if !IsWord(tokens.Peek().Kind) {
+				return nil, unexpected(tokens.Peek(), "unexpected token (%s)")
 			}
-			result = &BinaryExpr{dot, result, rhs}
+			rhs := &Id{tokens.AcceptAny()}
+			result = &BinaryExpr{Op: dot, Lhs: result, Rhs: rhs}
 		case LeftSquareBracket:
 			brace := tokens.AcceptAny()
 			index, err := ParseExpr(tokens)
 			if err != nil {
 				return nil, err
 			}
-			_, _ = tokens.Accept(RightSquareBracket)
-			result = &BinaryExpr{brace, result, index}
+			rightBracket, err := tokens.Accept(RightSquareBracket)
+			if err != nil {
+				return nil, err
+			}
+			result = &BinaryExpr{Op: brace, Lhs: result, Rhs: index, RightBracket: rightBracket}
 		case LeftParen:
 			tokens.AcceptAny()
 			argList, err := ParseExprList(tokens)
 			if err != nil {
 				return nil, err
 			}
-			_, err = tokens.Accept(RightParen)
+			rightParen, err := tokens.Accept(RightParen)
 			if err != nil {
 				return nil, err
 			}
-			result = &FunctionCall{result, argList}
+			result = &FunctionCall{Fn: result, Args: argList, RightParen: rightParen}
 		default:
 			return result, nil
 		}
@@ -294,9 +362,11 @@ func ParseTerm(tokens *Tokens) (Expr, error) {
 
 func ParseBasicTerm(tokens *Tokens) (Expr, error) {
 	switch tokens.Peek().Kind {
-	case Identifier:
+	case Identifier, Get, List, Read, Write, Create, Update, Delete:
+		// Action names are also the names of functions and methods such as
+		// get(path) and map.get(key, default).
 		return &Id{tokens.AcceptAny()}, nil
-	case StringLiteral, IntLiteral, FloatLiteral, Bytes, True, False:
+	case StringLiteral, IntLiteral, FloatLiteral, Bytes, True, False, Null:
 		return &Literal{tokens.AcceptAny()}, nil
 	case LeftParen:
 		tokens.AcceptAny()
@@ -309,19 +379,36 @@ func ParseBasicTerm(tokens *Tokens) (Expr, error) {
 			return nil, err
 		}
 		return result, nil
+	case Slash:
+		result, err := ParsePathExpr(tokens)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
 	case LeftSquareBracket:
 		result, err := ParseArrayLiteral(tokens)
 		if err != nil {
 			return nil, err
 		}
 		return result, nil
+	case LeftBrace:
+		result, err := ParseMapLiteral(tokens)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	case Dollar:
+		result, err := ParsePlaceholder(tokens)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
 	default:
 		nextToken := tokens.Peek()
-		return nil, ParseError{
-			StartPos: nextToken.Start,
-			EndPos: nextToken.End,
-			msg: fmt.Sprintf("unexpected token in input: %s", nextToken),
+		if nextToken.Kind == Error {
+			return nil, nextToken.Error
 		}
+		return nil, unexpected(nextToken, "unexpected token in input: %s")
 	}
 }
 
@@ -337,8 +424,12 @@ func ParseExprList(tokens *Tokens) ([]Expr, error) {
 				return nil, err
 			}
 			result = append(result, x)
-			if tokens.Peek().Kind == Comma {
+			switch tokens.Peek().Kind {
+			case Comma:
 				tokens.AcceptAny()
+			case RightParen:
+			default:
+				return nil, unexpected(tokens.Peek(), "unexpected token in argument list (%s)")
 			}
 		}
 	}
@@ -112,3 +112,53 @@ func TestTernaryExpr(t *testing.T) {
 
 
 
+func TestLiterals(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"null", "null"},
+		{"true", "true"},
+		{"'string'", "'string'"},
+		{"b'bytes'", "b'bytes'"},
+		{"1e6", "1e6"},
+		{".5", ".5"},
+		{"2.5e-3", "2.5e-3"},
+		{"[]", "[]"},
+		{"[1, 2, 3,]", "[1, 2, 3]"},
+		{"{}", "{}"},
+		{"{'a': 1}", "{'a': 1}"},
+		{"{'a': 1, 'b': [null, .5],}", "{'a': 1, 'b': [null, .5]}"},
+		{"{'a': {'b': x + 1}}", "{'a': {'b': (x + 1)}}"},
+		{"request.auth != null", "(request.auth != null)"},
+		{"{'a': 1}.keys()", "{'a': 1}.keys()"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expr, err := ParseExpr(New(test.name))
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, expr.String())
+			reparsed, err := ParseExpr(New(expr.String()))
+			assert.Nil(t, err)
+			assert.Equal(t, expr.String(), reparsed.String())
+		})
+	}
+}
+
+func TestLiteralErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  string
+	}{
+		{"[1 2]", "line 1 col 4: unexpected token in array literal (2)"},
+		{"{'a' 1}", "line 1 col 6: unexpected token (1)"},
+		{"{'a': 1 'b': 2}", "line 1 col 9: unexpected token in map literal ('b')"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseExpr(New(test.name))
+			assert.NotNil(t, err)
+			assert.Equal(t, test.err, err.Error())
+		})
+	}
+}
@@ -6,49 +6,80 @@ import (
 )
 
 type FunctionDef struct {
-	Stmt
-	functionName  Token
-	paramNames    []Param
-	letStatements []LetDef
-	returnStmt    Expr
+	Keyword    Token
+	Name       Token
+	Params     []Param
+	Lets       []*LetDef
+	Return     Expr
+	RightBrace Token
 }
 
 func (fd *FunctionDef) String() string {
-	paramNames := make([]string, len(fd.paramNames))
-	for k, v := range fd.paramNames {
-		paramNames[k] = v.name.Value
+	paramNames := make([]string, len(fd.Params))
+	for k, v := range fd.Params {
+		paramNames[k] = v.Name.Value
 	}
 
-	letStmts := make([]string, len(fd.letStatements))
-	for k, v := range fd.letStatements {
+	letStmts := make([]string, len(fd.Lets))
+	for k, v := range fd.Lets {
 		letStmts[k] = v.String()
 	}
 
-	retStmt := fmt.Sprintf("return %s;", fd.returnStmt.String())
+	retStmt := fmt.Sprintf("return %s;", fd.Return.String())
 
 	return fmt.Sprintf("function %s (%s) { %s %s }",
-		fd.functionName.Value,
+		fd.Name.Value,
 		strings.Join(paramNames, ", "),
 		strings.Join(letStmts, ""),
 		retStmt,
 	)
 }
 
+func (fd *FunctionDef) Pos() InputPosition {
+	return fd.Keyword.Start
+}
+
+func (fd *FunctionDef) End() InputPosition {
+	return fd.RightBrace.End
+}
+
 type LetDef struct {
-	name  Token
-	value Expr
+	Keyword   Token
+	Name      Token
+	Value     Expr
+	SemiColon Token
 }
 
 func (ld *LetDef) String() string {
-	return fmt.Sprintf("let %s = %s;", ld.name.Value, ld.value.String())
+	return fmt.Sprintf("let %s = %s;", ld.Name.Value, ld.Value.String())
+}
+
+func (ld *LetDef) Pos() InputPosition {
+	return ld.Keyword.Start
+}
+
+func (ld *LetDef) End() InputPosition {
+	return ld.SemiColon.End
 }
 
 type Param struct {
-	name Token
+	Name Token
+}
+
+func (p Param) String() string {
+	return p.Name.Value
+}
+
+func (p Param) Pos() InputPosition {
+	return p.Name.Start
+}
+
+func (p Param) End() InputPosition {
+	return p.Name.End
 }
 
 func ParseFunctionDef(tokens *Tokens) (*FunctionDef, error) {
-	_, err := tokens.Accept(Function)
+	keyword, err := tokens.Accept(Function)
 	if err != nil {
 		return nil, err
 	}
@@ -72,15 +103,17 @@ func ParseFunctionDef(tokens *Tokens) (*FunctionDef, error) {
 	if err != nil {
 		return nil, err
 	}
-	_, err = tokens.Accept(RightBrace)
+	rightBrace, err := tokens.Accept(RightBrace)
 	if err != nil {
 		return nil, err
 	}
 	return &FunctionDef{
-		functionName:  name,
-		paramNames:    params,
-		letStatements: letStmts,
-		returnStmt:    retStmt,
+		Keyword:    keyword,
+		Name:       name,
+		Params:     params,
+		Lets:       letStmts,
+		Return:     retStmt,
+		RightBrace: rightBrace,
 	}, nil
 }
 
@@ -100,8 +133,8 @@ func ParseReturnStmt(tokens *Tokens) (Expr, error) {
 	return result, nil
 }
 
-func ParseLetStmtList(tokens *Tokens) ([]LetDef, error) {
-	result := make([]LetDef, 0)
+func ParseLetStmtList(tokens *Tokens) ([]*LetDef, error) {
+	result := make([]*LetDef, 0)
 	for {
 		switch tokens.Peek().Kind {
 		case Let:
@@ -109,7 +142,7 @@ func ParseLetStmtList(tokens *Tokens) ([]LetDef, error) {
 			if err != nil {
 				return nil, err
 			}
-			result = append(result, *letDef)
+			result = append(result, letDef)
 		default:
 			return result, nil
 		}
@@ -117,7 +150,7 @@ func ParseLetStmtList(tokens *Tokens) ([]LetDef, error) {
 }
 
 func ParseLetStmt(tokens *Tokens) (*LetDef, error) {
-	_, err := tokens.Accept(Let)
+	keyword, err := tokens.Accept(Let)
 	if err != nil {
 		return nil, err
 	}
@@ -133,11 +166,11 @@ func ParseLetStmt(tokens *Tokens) (*LetDef, error) {
 	if err != nil {
 		return nil, err
 	}
-	_, err = tokens.Accept(SemiColon)
+	semi, err := tokens.Accept(SemiColon)
 	if err != nil {
 		return nil, err
 	}
-	return  &LetDef{id, rhs}, nil
+	return &LetDef{keyword, id, rhs, semi}, nil
 }
 
 func ParseParamList(tokens *Tokens) ([]Param, error) {
@@ -154,7 +187,11 @@ func ParseParamList(tokens *Tokens) ([]Param, error) {
 		}
 		return result, nil
 	}
-	result = append(result, Param{tokens.AcceptAny()})
+	first, err := tokens.Accept(Identifier)
+	if err != nil {
+		return nil, err
+	}
+	result = append(result, Param{first})
 	for {
 		switch tokens.Peek().Kind {
 		case Comma:
@@ -171,10 +208,7 @@ func ParseParamList(tokens *Tokens) ([]Param, error) {
 			tokens.AcceptAny()
 			return result, nil
 		default:
-			return nil, fmt.Errorf(
-				`%s: unexpected token in parameter list ( "%s" )`,
-				tokens.Peek().Start,
-				tokens.Peek())
+			return nil, unexpected(tokens.Peek(), `unexpected token in parameter list ( "%s" )`)
 		}
 	}
 }
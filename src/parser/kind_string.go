@@ -45,30 +45,33 @@ func _() {
 	_ = x[Bytes-34]
 	_ = x[Percent-35]
 	_ = x[Identifier-36]
-	_ = x[Service-37]
-	_ = x[Match-38]
-	_ = x[Allow-39]
-	_ = x[Create-40]
-	_ = x[Update-41]
-	_ = x[Delete-42]
-	_ = x[Write-43]
-	_ = x[Get-44]
-	_ = x[List-45]
-	_ = x[Read-46]
-	_ = x[If-47]
-	_ = x[Function-48]
-	_ = x[True-49]
-	_ = x[False-50]
-	_ = x[In-51]
-	_ = x[Is-52]
-	_ = x[Return-53]
-	_ = x[Let-54]
-	_ = x[RulesVersion-55]
+	_ = x[Comment-37]
+	_ = x[Dollar-38]
+	_ = x[Service-39]
+	_ = x[Match-40]
+	_ = x[Allow-41]
+	_ = x[Create-42]
+	_ = x[Update-43]
+	_ = x[Delete-44]
+	_ = x[Write-45]
+	_ = x[Get-46]
+	_ = x[List-47]
+	_ = x[Read-48]
+	_ = x[If-49]
+	_ = x[Function-50]
+	_ = x[True-51]
+	_ = x[False-52]
+	_ = x[In-53]
+	_ = x[Is-54]
+	_ = x[Return-55]
+	_ = x[Let-56]
+	_ = x[RulesVersion-57]
+	_ = x[Null-58]
 }
 
-const _Kind_name = "ErrorEofWordDotIntLiteralFloatLiteralLeftBraceRightBraceLeftParenRightParenStringLiteralSlashMinusPlusCommaEqEqEqSemiColonLeftSquareBracketRightSquareBracketLessLessEqGreaterGreaterEqColonQuestionMarkAndAndAndOrOrOrNotEqBangStarStarStarBytesPercentIdentifierServiceMatchAllowCreateUpdateDeleteWriteGetListReadIfFunctionTrueFalseInIsReturnLetRulesVersion"
+const _Kind_name = "ErrorEofWordDotIntLiteralFloatLiteralLeftBraceRightBraceLeftParenRightParenStringLiteralSlashMinusPlusCommaEqEqEqSemiColonLeftSquareBracketRightSquareBracketLessLessEqGreaterGreaterEqColonQuestionMarkAndAndAndOrOrOrNotEqBangStarStarStarBytesPercentIdentifierCommentDollarServiceMatchAllowCreateUpdateDeleteWriteGetListReadIfFunctionTrueFalseInIsReturnLetRulesVersionNull"
 
-var _Kind_index = [...]uint16{0, 5, 8, 12, 15, 25, 37, 46, 56, 65, 75, 88, 93, 98, 102, 107, 109, 113, 122, 139, 157, 161, 167, 174, 183, 188, 200, 203, 209, 211, 215, 220, 224, 228, 236, 241, 248, 258, 265, 270, 275, 281, 287, 293, 298, 301, 305, 309, 311, 319, 323, 328, 330, 332, 338, 341, 353}
+var _Kind_index = [...]uint16{0, 5, 8, 12, 15, 25, 37, 46, 56, 65, 75, 88, 93, 98, 102, 107, 109, 113, 122, 139, 157, 161, 167, 174, 183, 188, 200, 203, 209, 211, 215, 220, 224, 228, 236, 241, 248, 258, 265, 271, 278, 283, 288, 294, 300, 306, 311, 314, 318, 322, 324, 332, 336, 341, 343, 345, 351, 354, 366, 370}
 
 func (i Kind) String() string {
 	if i < 0 || i >= Kind(len(_Kind_index)-1) {
@@ -3,8 +3,8 @@ package parser
 //go:generate stringer -type=Kind
 
 import (
+	"errors"
 	"fmt"
-	"os"
 	"unicode"
 )
 
@@ -48,6 +48,8 @@ const (
 	Bytes
 	Percent
 	Identifier
+	Comment
+	Dollar
 
 	// reserved words
 	Service
@@ -69,28 +71,35 @@ const (
 	Return
 	Let
 	RulesVersion
+	Null
 )
 
 var reservedWords = map[string]Kind{
-	"service":  Service,
-	"match":    Match,
-	"allow":    Allow,
-	"create":   Create,
-	"update":   Update,
-	"delete":   Delete,
-	"write":    Write,
-	"get":      Get,
-	"list":     List,
-	"read":     Read,
-	"if":       If,
-	"function": Function,
-	"true":     True,
-	"false":    False,
-	"in":       In,
-	"is":       Is,
-	"return":   Return,
-	"let":      Let,
+	"service":       Service,
+	"match":         Match,
+	"allow":         Allow,
+	"create":        Create,
+	"update":        Update,
+	"delete":        Delete,
+	"write":         Write,
+	"get":           Get,
+	"list":          List,
+	"read":          Read,
+	"if":            If,
+	"function":      Function,
+	"true":          True,
+	"false":         False,
+	"in":            In,
+	"is":            Is,
+	"return":        Return,
+	"let":           Let,
 	"rules_version": RulesVersion,
+	"null":          Null,
+}
+
+// IsWord reports whether kind is an identifier or a reserved word.
+func IsWord(kind Kind) bool {
+	return kind == Identifier || kind >= Service
 }
 
 func IsAction(kind Kind) bool {
@@ -111,20 +120,26 @@ func (ip InputPosition) String() string {
 
 type LexError struct {
 	Start InputPosition
-	Pos InputPosition
-	msg string
+	Pos   InputPosition
+	Msg   string
 }
 
 func (le LexError) Error() string {
-	return fmt.Sprintf("%s: %s", le.Start, le.msg)
+	return fmt.Sprintf("%s: %s", le.Start, le.Msg)
 }
 
+// Token is a single lexeme. Comments are not returned as tokens of their own;
+// instead they are attached as trivia to a neighbouring token. A comment that
+// starts on the same line as the end of the previous token is Trailing trivia
+// of that token; any other comment is Leading trivia of the token after it.
 type Token struct {
-	Kind  Kind
-	Value string
-	Start InputPosition
-	End   InputPosition
-	Error error
+	Kind     Kind
+	Value    string
+	Start    InputPosition
+	End      InputPosition
+	Error    error
+	Leading  []Token
+	Trailing []Token
 }
 
 func (token Token) String() string {
@@ -140,30 +155,61 @@ func (token Token) ErrString() string {
 	}
 }
 
+// Lexer turns its Input into Tokens on demand. Each call to Next scans just
+// far enough to produce one more token.
 type Lexer struct {
-	Input []rune
-	start InputPosition
-	pos   InputPosition
-	Chan  chan Token
+	Input    []rune
+	start    InputPosition
+	pos      InputPosition
+	state    stFunction
+	held     Token
+	holding  bool
+	comments []Token
+	queue    []Token
+	head     int
+	last     Token
 }
 
-func Start(s string) chan Token {
-	ch := make(chan Token)
-	lexer := &Lexer{
+func NewLexer(s string) *Lexer {
+	return &Lexer{
 		Input: []rune(s),
-		Chan:  ch,
 		start: InputPosition{},
 		pos:   InputPosition{},
+		state: startState,
+		queue: make([]Token, 0, 2),
 	}
-	go Run(lexer)
-	return ch
+}
+
+// Next returns the next token. Once the Eof token or an Error token has been
+// returned, every later call returns that same token again.
+func (lexer *Lexer) Next() Token {
+	for lexer.head == len(lexer.queue) {
+		if lexer.state == nil {
+			return lexer.last
+		}
+		lexer.queue = lexer.queue[:0]
+		lexer.head = 0
+		nextState, err := lexer.state(lexer)
+		if err != nil {
+			lexer.fail(err)
+		}
+		lexer.state = nextState
+	}
+	lexer.last = lexer.queue[lexer.head]
+	lexer.head++
+	return lexer.last
 }
 
 func (lexer *Lexer) peek() rune {
-	if len(lexer.Input) == lexer.pos.Pos {
+	return lexer.peekAt(0)
+}
+
+// peekAt returns the rune n places after the next one, or EOF.
+func (lexer *Lexer) peekAt(n int) rune {
+	if lexer.pos.Pos+n >= len(lexer.Input) {
 		return EOF
 	}
-	return lexer.Input[lexer.pos.Pos]
+	return lexer.Input[lexer.pos.Pos+n]
 }
 
 func (lexer *Lexer) expect(r rune) error {
@@ -195,15 +241,43 @@ func (lexer *Lexer) current() string {
 }
 
 func (lexer *Lexer) generate(kind Kind) {
+	value := lexer.current()
 	if kind == Word {
-		id, ok := reservedWords[lexer.current()]
+		id, ok := reservedWords[value]
 		if ok {
-			lexer.Chan <- Token{Kind: id, Value: lexer.current(), Start: lexer.start, End: lexer.pos}
+			kind = id
 		} else {
-			lexer.Chan <- Token{Kind: Identifier, Value: lexer.current(), Start: lexer.start, End: lexer.pos}
+			kind = Identifier
 		}
+	}
+	lexer.emit(Token{Kind: kind, Value: value, Start: lexer.start, End: lexer.pos})
+}
+
+// emit holds back each token until the next one is generated so that a comment
+// following it on the same line can still be attached as trailing trivia.
+func (lexer *Lexer) emit(token Token) {
+	token.Leading = lexer.comments
+	lexer.comments = nil
+	lexer.flush()
+	lexer.held = token
+	lexer.holding = true
+}
+
+func (lexer *Lexer) flush() {
+	if lexer.holding {
+		lexer.queue = append(lexer.queue, lexer.held)
+		lexer.held = Token{}
+		lexer.holding = false
+	}
+}
+
+// comment records the comment just scanned as trivia of a neighbouring token.
+func (lexer *Lexer) comment() {
+	token := Token{Kind: Comment, Value: lexer.current(), Start: lexer.start, End: lexer.pos}
+	if lexer.holding && lexer.held.End.Line == token.Start.Line {
+		lexer.held.Trailing = append(lexer.held.Trailing, token)
 	} else {
-		lexer.Chan <- Token{Kind: kind, Value: lexer.current(), Start: lexer.start, End: lexer.pos}
+		lexer.comments = append(lexer.comments, token)
 	}
 }
 
@@ -219,7 +293,7 @@ func startState(lexer *Lexer) (stFunction, error) {
 		lexer.acceptChar()
 	case c == EOF:
 		lexer.generate(Eof)
-		close(lexer.Chan)
+		lexer.flush()
 		return nil, nil
 	case c == 'b':
 		lexer.acceptChar()
@@ -233,7 +307,7 @@ func startState(lexer *Lexer) (stFunction, error) {
 			acceptIdentifier(lexer)
 			lexer.generate(Word)
 		}
-	case c == '.':
+	case c == '.' && !unicode.IsDigit(lexer.peekAt(1)):
 		lexer.acceptCharAndGenerate(Dot)
 	case unicode.IsLetter(c):
 		acceptIdentifier(lexer)
@@ -263,15 +337,8 @@ func startState(lexer *Lexer) (stFunction, error) {
 		lexer.acceptCharAndGenerate(Plus)
 	case c == '-':
 		lexer.acceptCharAndGenerate(Minus)
-	case unicode.IsDigit(c):
-		acceptDigits(lexer)
-		if lexer.peek() == '.' {
-			lexer.acceptChar()
-			acceptDigits(lexer)
-			lexer.generate(FloatLiteral)
-		} else {
-			lexer.generate(IntLiteral)
-		}
+	case unicode.IsDigit(c), c == '.' && unicode.IsDigit(lexer.peekAt(1)):
+		lexer.generate(acceptNumber(lexer))
 	case c == '(':
 		lexer.acceptCharAndGenerate(LeftParen)
 	case c == ')':
@@ -281,7 +348,20 @@ func startState(lexer *Lexer) (stFunction, error) {
 	case c == '}':
 		lexer.acceptCharAndGenerate(RightBrace)
 	case c == '/':
-		lexer.acceptCharAndGenerate(Slash)
+		lexer.acceptChar()
+		switch lexer.peek() {
+		case '/':
+			acceptLineComment(lexer)
+			lexer.comment()
+		case '*':
+			err := acceptBlockComment(lexer)
+			if err != nil {
+				return nil, err
+			}
+			lexer.comment()
+		default:
+			lexer.generate(Slash)
+		}
 	case c == ';':
 		lexer.acceptCharAndGenerate(SemiColon)
 	case c == '[':
@@ -336,12 +416,39 @@ func startState(lexer *Lexer) (stFunction, error) {
 		}
 	case c == '%':
 		lexer.acceptCharAndGenerate(Percent)
+	case c == '$':
+		lexer.acceptCharAndGenerate(Dollar)
 	default:
 		return nil, LexError{lexer.start, lexer.pos, fmt.Sprintf("unexpected character: %c", c)}
 	}
 	return startState, nil
 }
 
+// acceptNumber accepts an int or float literal: 12, 1.5, .5, 1e6, 2.5E-3.
+func acceptNumber(lexer *Lexer) Kind {
+	kind := IntLiteral
+	acceptDigits(lexer)
+	if lexer.peek() == '.' && unicode.IsDigit(lexer.peekAt(1)) {
+		lexer.acceptChar()
+		acceptDigits(lexer)
+		kind = FloatLiteral
+	}
+	if c := lexer.peek(); c == 'e' || c == 'E' {
+		n := 1
+		if sign := lexer.peekAt(1); sign == '+' || sign == '-' {
+			n = 2
+		}
+		if unicode.IsDigit(lexer.peekAt(n)) {
+			for ; n > 0; n-- {
+				lexer.acceptChar()
+			}
+			acceptDigits(lexer)
+			kind = FloatLiteral
+		}
+	}
+	return kind
+}
+
 func acceptDigits(lexer *Lexer) {
 	for {
 		switch {
@@ -359,6 +466,33 @@ func acceptIdentifier(lexer *Lexer) {
 	}
 }
 
+func acceptLineComment(lexer *Lexer) {
+	for c := lexer.peek(); c != '\n' && c != EOF; c = lexer.peek() {
+		lexer.acceptChar()
+	}
+}
+
+func acceptBlockComment(lexer *Lexer) error {
+	err := lexer.expect('*')
+	if err != nil {
+		return err
+	}
+	for {
+		switch lexer.peek() {
+		case EOF:
+			return LexError{lexer.start, lexer.pos, "unclosed block comment"}
+		case '*':
+			lexer.acceptChar()
+			if lexer.peek() == '/' {
+				lexer.acceptChar()
+				return nil
+			}
+		default:
+			lexer.acceptChar()
+		}
+	}
+}
+
 func acceptStringLiteral(lexer *Lexer, delimiter rune) error {
 	err := lexer.expect(delimiter)
 	if err != nil {
@@ -370,7 +504,7 @@ func acceptStringLiteral(lexer *Lexer, delimiter rune) error {
 			lexer.acceptChar()
 			return nil
 		case -1, '\n':
-			return LexError{lexer.start,lexer.pos, "unclosed string literal"}
+			return LexError{lexer.start, lexer.pos, "unclosed string literal"}
 		case '\\':
 			lexer.acceptChar()
 			c := lexer.peek()
@@ -384,22 +518,18 @@ func acceptStringLiteral(lexer *Lexer, delimiter rune) error {
 	}
 }
 
-func Run(lexer *Lexer) {
-	for state := startState; state != nil; {
-		nextState, err := state(lexer)
-		if err != nil {
-			lexError := err.(*LexError)
-			_, _ = fmt.Fprintf(os.Stderr, "lexical error: %s\n", lexError.Error())
-			errToken := Token{
-				Kind: Error,
-				Value: string(lexer.Input[lexer.start.Pos: lexer.pos.Pos]),
-				Start: lexError.Start,
-				End: lexError.Pos,
-				Error: lexError,
-			}
-			lexer.Chan <- errToken
-			close(lexer.Chan)
-		}
-		state = nextState
+// fail queues an Error token for err after any token still being held.
+func (lexer *Lexer) fail(err error) {
+	var lexError LexError
+	if !errors.As(err, &lexError) {
+		lexError = LexError{lexer.start, lexer.pos, err.Error()}
 	}
+	lexer.flush()
+	lexer.queue = append(lexer.queue, Token{
+		Kind:  Error,
+		Value: lexer.current(),
+		Start: lexError.Start,
+		End:   lexError.Pos,
+		Error: lexError,
+	})
 }
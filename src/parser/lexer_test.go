@@ -6,21 +6,21 @@ import (
 )
 
 func TestEmpty(t *testing.T) {
-	ch := setup("")
+	lexer := setup("")
 
-	token := <-ch
+	token := lexer.Next()
 	if token.Kind != Eof {
 		t.Fail()
 	}
 }
 
 func TestDot(t *testing.T) {
-	ch := setup(".")
-	token := <-ch
+	lexer := setup(".")
+	token := lexer.Next()
 	if token.Kind != Dot {
 		t.Fail()
 	}
-	token = <-ch
+	token = lexer.Next()
 	if token.Kind != Eof {
 		t.Fail()
 	}
@@ -38,8 +38,8 @@ func TestOperators(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			ch := setup(test.input)
-			token := <-ch
+			lexer := setup(test.input)
+			token := lexer.Next()
 			if token.Kind != test.kind {
 				t.Errorf("expected %v but got %v", test.kind, token.Kind)
 			}
@@ -52,28 +52,28 @@ func TestOperators(t *testing.T) {
 }
 
 func TestWord(t *testing.T) {
-	ch := setup("hello")
-	token := <-ch
+	lexer := setup("hello")
+	token := lexer.Next()
 	if token.Kind != Identifier || token.Value != "hello" {
 		t.Fail()
 	}
 }
 
 func TestWordDotWord(t *testing.T) {
-	ch := setup("foo42.ba3r")
-	token := <-ch
+	lexer := setup("foo42.ba3r")
+	token := lexer.Next()
 	if token.Kind != Identifier || token.Value != "foo42" {
 		t.Error("expected word1")
 	}
-	token = <-ch
+	token = lexer.Next()
 	if token.Kind != Dot || token.Value != "." {
 		t.Error("expected dot")
 	}
-	token = <-ch
+	token = lexer.Next()
 	if token.Kind != Identifier || token.Value != "ba3r" {
 		t.Error("expected ba3r but got", token.Value)
 	}
-	token = <-ch
+	token = lexer.Next()
 	if token.Kind != Eof || token.Value != "" {
 		t.Error("expected eof")
 	}
@@ -90,8 +90,8 @@ func TestStringLiterals(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			ch := setup(test.input)
-			token := <-ch
+			lexer := setup(test.input)
+			token := lexer.Next()
 			if token.Kind != StringLiteral || token.Value != test.input {
 				t.Errorf("expected %v but got %v", test.input, token.Value)
 			}
@@ -109,6 +109,9 @@ func TestSingleTokens(t *testing.T) {
 		{"dot", Dot, "."},
 		{"int", IntLiteral, "123"},
 		{"float", FloatLiteral, "123.456"},
+		{"float exponent", FloatLiteral, "1e6"},
+		{"float signed exponent", FloatLiteral, "2.5E-3"},
+		{"float leading dot", FloatLiteral, ".5"},
 		{"{", LeftBrace, "{"},
 		{"}", RightBrace, "}"},
 		{"(", LeftParen, "("},
@@ -138,6 +141,7 @@ func TestSingleTokens(t *testing.T) {
 		{"**", StarStar, "**"},
 		{"bytes", Bytes, "b'abc'"},
 		{"percent", Percent, "%"},
+		{"dollar", Dollar, "$"},
 		{"if", If, "if"},
 		{"service", Service, "service"},
 		{"match", Match, "match"},
@@ -150,16 +154,17 @@ func TestSingleTokens(t *testing.T) {
 		{"read", Read, "read"},
 		{"if", If, "if"},
 		{"function", Function, "function"},
+		{"null", Null, "null"},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			ch := setup(test.input)
-			token := <-ch
+			lexer := setup(test.input)
+			token := lexer.Next()
 			if token.Kind != test.kind || token.Value != test.input {
 				t.Fatalf("expected %s(%s) but got %s", test.kind, test.input, token)
 			}
-			token = <-ch
+			token = lexer.Next()
 			if token.Kind != Eof {
 				t.Fatalf("expected EOF")
 			}
@@ -234,12 +239,182 @@ func TestLexicalErrors(t *testing.T) {
 	}
 }
 
-func setup(s string) chan Token {
-	ch := make(chan Token)
-	lexer := Lexer{
-		Input: []rune(s),
-		Chan:  ch,
+func setup(s string) *Lexer {
+	return NewLexer(s)
+}
+
+func TestComments(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		kinds    []Kind
+		leading  map[int][]string
+		trailing map[int][]string
+	}{
+		{
+			name:    "line comment",
+			input:   "// hello\nfoo",
+			kinds:   []Kind{Identifier, Eof},
+			leading: map[int][]string{0: {"// hello"}},
+		},
+		{
+			name:     "trailing line comment",
+			input:    "foo; // hello\nbar",
+			kinds:    []Kind{Identifier, SemiColon, Identifier, Eof},
+			trailing: map[int][]string{1: {"// hello"}},
+		},
+		{
+			name:    "block comment",
+			input:   "/* a\n * b */ foo",
+			kinds:   []Kind{Identifier, Eof},
+			leading: map[int][]string{0: {"/* a\n * b */"}},
+		},
+		{
+			name:     "inline block comment",
+			input:    "a /* x */ / b",
+			kinds:    []Kind{Identifier, Slash, Identifier, Eof},
+			trailing: map[int][]string{0: {"/* x */"}},
+		},
+		{
+			name:    "comment before eof",
+			input:   "foo\n// bye",
+			kinds:   []Kind{Identifier, Eof},
+			leading: map[int][]string{1: {"// bye"}},
+		},
+		{
+			name:  "path is not a comment",
+			input: "/foo/bar",
+			kinds: []Kind{Slash, Identifier, Slash, Identifier, Eof},
+		},
+	}
+	values := func(tokens []Token) []string {
+		result := make([]string, 0)
+		for _, t := range tokens {
+			result = append(result, t.Value)
+		}
+		return result
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lexer := setup(test.input)
+			for k, kind := range test.kinds {
+				token := lexer.Next()
+				if token.Kind != kind {
+					t.Fatalf("token %d: expected %s but got %s", k, kind, token.Kind)
+				}
+				if expected := test.leading[k]; len(expected) > 0 || len(token.Leading) > 0 {
+					if strings.Join(expected, "|") != strings.Join(values(token.Leading), "|") {
+						t.Errorf("token %d: expected leading %v but got %v", k, expected, values(token.Leading))
+					}
+				}
+				if expected := test.trailing[k]; len(expected) > 0 || len(token.Trailing) > 0 {
+					if strings.Join(expected, "|") != strings.Join(values(token.Trailing), "|") {
+						t.Errorf("token %d: expected trailing %v but got %v", k, expected, values(token.Trailing))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestUnclosedBlockComment(t *testing.T) {
+	lexer := setup("foo /* bar")
+	token := lexer.Next()
+	if token.Kind != Identifier {
+		t.Fatalf("expected identifier but got %s", token.Kind)
+	}
+	token = lexer.Next()
+	if token.Kind != Error || token.Error == nil {
+		t.Fatalf("expected error but got %s", token.Kind)
+	}
+}
+
+func TestTokensComments(t *testing.T) {
+	tokens := New("// one\nfoo /* two */ bar // three\n// four")
+	for tokens.AcceptAny().Kind != Eof {
+	}
+	comments := tokens.Comments()
+	expected := []string{"// one", "/* two */", "// three", "// four"}
+	if len(comments) != len(expected) {
+		t.Fatalf("expected %d comments but got %d", len(expected), len(comments))
+	}
+	for k, c := range comments {
+		if c.Kind != Comment || c.Value != expected[k] {
+			t.Errorf("expected comment %q but got %s(%q)", expected[k], c.Kind, c.Value)
+		}
+	}
+}
+
+func TestNextAfterEnd(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		kind  Kind
+	}{
+		{"eof", "foo", Eof},
+		{"error", "foo 'bar", Error},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lexer := setup(test.input)
+			token := lexer.Next()
+			if token.Kind != Identifier {
+				t.Fatalf("expected identifier but got %s", token.Kind)
+			}
+			for i := 0; i < 3; i++ {
+				token = lexer.Next()
+				if token.Kind != test.kind {
+					t.Fatalf("expected %s but got %s", test.kind, token.Kind)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLexer(b *testing.B) {
+	input := GetFileContent("../../testdata/firestore.rules")
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lexer := NewLexer(input)
+		for lexer.Next().Kind != Eof {
+		}
+	}
+}
+
+func BenchmarkTokens(b *testing.B) {
+	input := GetFileContent("../../testdata/firestore.rules")
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tokens := New(input)
+		for tokens.AcceptAny().Kind != Eof {
+		}
+	}
+}
+
+func TestUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`'abc'`, "abc"},
+		{`"abc"`, "abc"},
+		{`'it\'s'`, "it's"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`'tab\there'`, "tab\there"},
+		{`'été'`, "été"},
+		{`b'\x00\xff'`, "\x00\xff"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			s, err := Unquote(test.input)
+			if err != nil || s != test.expected {
+				t.Errorf("Unquote(%s) = %q, %v; want %q", test.input, s, err, test.expected)
+			}
+		})
+	}
+	if _, err := Unquote("abc"); err == nil {
+		t.Errorf("Unquote(abc) succeeded")
 	}
-	go Run(&lexer)
-	return ch
 }
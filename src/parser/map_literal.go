@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+type MapLiteral struct {
+	LeftBrace  Token
+	Entries    []*MapEntry
+	RightBrace Token
+}
+
+func (ml *MapLiteral) String() string {
+	result := make([]string, len(ml.Entries))
+	for k, v := range ml.Entries {
+		result[k] = v.String()
+	}
+	return fmt.Sprintf("{%s}", strings.Join(result, ", "))
+}
+
+func (ml *MapLiteral) Pos() InputPosition {
+	return ml.LeftBrace.Start
+}
+
+func (ml *MapLiteral) End() InputPosition {
+	return ml.RightBrace.End
+}
+
+type MapEntry struct {
+	Key   Expr
+	Value Expr
+}
+
+func (me *MapEntry) String() string {
+	return fmt.Sprintf("%s: %s", me.Key, me.Value)
+}
+
+func (me *MapEntry) Pos() InputPosition {
+	return me.Key.Pos()
+}
+
+func (me *MapEntry) End() InputPosition {
+	return me.Value.End()
+}
+
+func ParseMapLiteral(tokens *Tokens) (*MapLiteral, error) {
+	entries := make([]*MapEntry, 0)
+	leftBrace, err := tokens.Accept(LeftBrace)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if tokens.Peek().Kind == RightBrace {
+			return &MapLiteral{leftBrace, entries, tokens.AcceptAny()}, nil
+		}
+		key, err := ParseExpr(tokens)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tokens.Accept(Colon)
+		if err != nil {
+			return nil, err
+		}
+		value, err := ParseExpr(tokens)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &MapEntry{key, value})
+		switch tokens.Peek().Kind {
+		case Comma:
+			tokens.AcceptAny()
+		case RightBrace:
+		default:
+			return nil, unexpected(tokens.Peek(), "unexpected token in map literal (%s)")
+		}
+	}
+}
@@ -5,10 +5,21 @@ import (
 	"strings"
 )
 
+// MatchStmt is a match block. A block written as
+//
+//	match /issues/{id} is Issue { ... }
+//
+// says that the documents it matches have the declared type Issue.
 type MatchStmt struct {
-	Stmt
-	Path       Path
+	Keyword Token
+	Path    Path
+	// Is is the 'is' before the document type. Its Kind is Is if the block
+	// names one.
+	Is Token
+	// DocType names the declared type of the documents.
+	DocType    Token
 	Components []Stmt
+	RightBrace Token
 }
 
 func (ms *MatchStmt) String() string {
@@ -16,18 +27,70 @@ func (ms *MatchStmt) String() string {
 	for k, v := range ms.Components {
 		comp[k] = v.String()
 	}
-	return fmt.Sprintf("match %s {%s}", ms.Path, strings.Join(comp, "  "))
+	return fmt.Sprintf("match %s%s {%s}", ms.Path, ms.isClause(), strings.Join(comp, "  "))
+}
+
+// HasDocType reports whether the block names the type of its documents.
+func (ms *MatchStmt) HasDocType() bool {
+	return ms.Is.Kind == Is
+}
+
+func (ms *MatchStmt) isClause() string {
+	if !ms.HasDocType() {
+		return ""
+	}
+	return " is " + ms.DocType.Value
+}
+
+func (ms *MatchStmt) Pos() InputPosition {
+	return ms.Keyword.Start
+}
+
+func (ms *MatchStmt) End() InputPosition {
+	return ms.RightBrace.End
+}
+
+// skipToMatchBody recovers from an error in the path of a match statement by
+// reporting it and skipping to the '{' that opens the body, so the body can
+// still be parsed. The body is recognized as a '{' followed by a statement
+// keyword or '}'. If there is no such '{' the error is returned.
+func skipToMatchBody(tokens *Tokens, err error) error {
+	for {
+		switch tokens.Peek().Kind {
+		case Eof, Error, Service, Match, Allow, Function:
+			return err
+		case Identifier:
+			if isTypeDecl(tokens, 0) {
+				return err
+			}
+		case LeftBrace:
+			switch next := tokens.peekAt(1).Kind; {
+			case next == Match, next == Allow, next == Function, next == RightBrace, isTypeDecl(tokens, 1):
+				tokens.report(err)
+				return nil
+			}
+		}
+		tokens.AcceptAny()
+	}
 }
 
 func ParseMatchStmt(tokens *Tokens) (*MatchStmt, error) {
-	_, err := tokens.Accept(Match)
+	keyword, err := tokens.Accept(Match)
 	if err != nil {
 		return nil, err
 	}
 	c := make([]Stmt, 0)
+	var is, docType Token
 	path, err := ParsePath(tokens)
+	if err == nil && tokens.Peek().Kind == Is {
+		is = tokens.AcceptAny()
+		docType, err = tokens.Accept(Identifier)
+	}
 	if err != nil {
-		return nil, err
+		err = skipToMatchBody(tokens, err)
+		if err != nil {
+			return nil, err
+		}
 	}
 	_, err = tokens.Accept(LeftBrace)
 	if err != nil {
@@ -35,30 +98,47 @@ func ParseMatchStmt(tokens *Tokens) (*MatchStmt, error) {
 	}
 
 	for {
+		start := tokens.pos
 		switch tokens.Peek().Kind {
 		case Function:
 			fn, err := ParseFunctionDef(tokens)
 			if err != nil {
-				return nil, err
+				tokens.recover(err, start)
+				continue
 			}
 			c = append(c, fn)
 		case Match:
 			m, err := ParseMatchStmt(tokens)
 			if err != nil {
-				return nil, err
+				tokens.recover(err, start)
+				continue
 			}
 			c = append(c, m)
 		case Allow:
 			a, err := ParseAllowStmt(tokens)
 			if err != nil {
-				return nil, err
+				tokens.recover(err, start)
+				continue
 			}
 			c = append(c, a)
+		case Identifier:
+			if !isTypeDecl(tokens, 0) {
+				tokens.recover(unexpected(tokens.Peek(), "unexpected token: %s"), start)
+				continue
+			}
+			td, err := ParseTypeDecl(tokens)
+			if err != nil {
+				tokens.recover(err, start)
+				continue
+			}
+			c = append(c, td)
 		case RightBrace:
-			tokens.AcceptAny()
-			return &MatchStmt{Path: path, Components: c}, nil
+			return &MatchStmt{Keyword: keyword, Path: path, Is: is, DocType: docType, Components: c, RightBrace: tokens.AcceptAny()}, nil
+		case Eof, Error:
+			tokens.report(unexpected(tokens.Peek(), "unexpected token (%s), expected }"))
+			return &MatchStmt{Keyword: keyword, Path: path, Is: is, DocType: docType, Components: c, RightBrace: tokens.Peek()}, nil
 		default:
-			return nil, fmt.Errorf("unexpected token: %s", tokens.Peek())
+			tokens.recover(unexpected(tokens.Peek(), "unexpected token: %s"), start)
 		}
 	}
 }
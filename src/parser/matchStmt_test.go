@@ -31,6 +31,11 @@ func TestParseMatchStmt(t *testing.T) {
 			input:    "match /foo/{bar} {function foo() {return 2+3;} function bar(a) {return a+1;}}",
 			expected: "match /foo/{bar} {function foo() {return (2+3); } function bar(a) {return (a+1);}}",
 		},
+		{
+			name:     "document type",
+			input:    "match /issues/{id} is Issue { type Issue { title: string; } }",
+			expected: "match /issues/{id} is Issue {type Issue { title: string; }}",
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -0,0 +1,9 @@
+package parser
+
+// Node is implemented by every node of the syntax tree. Pos is the position of
+// the first character belonging to the node and End is the position just past
+// the last one, so the source text of a node is Input[Pos().Pos:End().Pos].
+type Node interface {
+	Pos() InputPosition
+	End() InputPosition
+}
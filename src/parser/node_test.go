@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const spanInput = `rules_version = '2';
+service cloud.firestore {
+  match /databases/{database}/documents {
+    function owner(uid) {
+      let id = request.auth.uid;
+      return id == uid && -x < 1 ? [1, 2] : {'a': b[0]};
+    }
+    allow read: if owner(get(/users/$(uid)).data.id);
+  }
+}`
+
+func TestNodeSpans(t *testing.T) {
+	rules, err := ParseRules(New(spanInput))
+	assert.Nil(t, err)
+	text := func(n Node) string {
+		return spanInput[n.Pos().Pos:n.End().Pos]
+	}
+
+	match := rules.Service.Statements[0].(*MatchStmt)
+	fn := match.Components[0].(*FunctionDef)
+	ret := fn.Return.(*TernaryExpr)
+	cond := ret.Cond.(*BinaryExpr)
+	eq := cond.Lhs.(*BinaryExpr)
+	less := cond.Rhs.(*BinaryExpr)
+	allow := match.Components[1].(*AllowStmt)
+	call := allow.Condition.(*FunctionCall)
+	field := call.Args[0].(*BinaryExpr)
+	get := field.Lhs.(*BinaryExpr).Lhs.(*FunctionCall)
+	path := get.Args[0].(*PathExpr)
+	mapLit := ret.False.(*MapLiteral)
+
+	tests := []struct {
+		name     string
+		node     Node
+		expected string
+	}{
+		{"rules", rules, spanInput},
+		{"service name", rules.Service.Name, "cloud.firestore"},
+		{"match path", match.Path, "/databases/{database}/documents"},
+		{"wildcard", match.Path[1], "/{database}"},
+		{"literal component", match.Path[2], "/documents"},
+		{"param", fn.Params[0], "uid"},
+		{"let", fn.Lets[0], "let id = request.auth.uid;"},
+		{"field access", fn.Lets[0].Value, "request.auth.uid"},
+		{"ternary", ret, "id == uid && -x < 1 ? [1, 2] : {'a': b[0]}"},
+		{"equality", eq, "id == uid"},
+		{"less", less, "-x < 1"},
+		{"unary", less.Lhs, "-x"},
+		{"literal", less.Rhs, "1"},
+		{"array", ret.True, "[1, 2]"},
+		{"map", mapLit, "{'a': b[0]}"},
+		{"map entry", mapLit.Entries[0], "'a': b[0]"},
+		{"index", mapLit.Entries[0].Value, "b[0]"},
+		{"allow", allow, "allow read: if owner(get(/users/$(uid)).data.id);"},
+		{"call", call, "owner(get(/users/$(uid)).data.id)"},
+		{"id", call.Fn, "owner"},
+		{"path", path, "/users/$(uid)"},
+		{"path segment", path.Segments[1], "/$(uid)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, text(test.node))
+		})
+	}
+	assert.Equal(t, 4, fn.Pos().Line+1)
+	assert.Equal(t, 5, fn.Pos().Col+1)
+}
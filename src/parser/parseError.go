@@ -1,16 +1,60 @@
 package parser
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
 
 type ParseError struct {
 	StartPos InputPosition
 	EndPos   InputPosition
-	msg      string
+	Msg      string
 }
 
 func (e ParseError) Error() string {
-	return fmt.Sprintf("%s: %s", e.StartPos, e.msg)
+	return fmt.Sprintf("%s: %s", e.StartPos, e.Msg)
 }
 
+// unexpected builds the usual error for a token that cannot appear where it was found.
+func unexpected(t Token, format string) ParseError {
+	return ParseError{
+		StartPos: t.Start,
+		EndPos:   t.End,
+		Msg:      fmt.Sprintf(format, t.ErrString()),
+	}
+}
+
+// toParseError converts any error produced while parsing into a ParseError.
+// Errors without a position of their own are placed at the token at.
+func toParseError(err error, at Token) ParseError {
+	var pe ParseError
+	if errors.As(err, &pe) {
+		return pe
+	}
+	var le LexError
+	if errors.As(err, &le) {
+		return ParseError{StartPos: le.Start, EndPos: le.Pos, Msg: le.Msg}
+	}
+	return ParseError{StartPos: at.Start, EndPos: at.End, Msg: err.Error()}
+}
 
+// ErrorList is every error reported during a parse, ordered by position.
+type ErrorList []ParseError
 
+func (list ErrorList) Error() string {
+	switch len(list) {
+	case 0:
+		return "no errors"
+	case 1:
+		return list[0].Error()
+	default:
+		return fmt.Sprintf("%s (and %d more errors)", list[0], len(list)-1)
+	}
+}
+
+func (list ErrorList) sort() {
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].StartPos.Pos < list[j].StartPos.Pos
+	})
+}
@@ -15,57 +15,96 @@ func (p Path) String() string {
 	return "/" + strings.Join(s, "/")
 }
 
+func (p Path) Pos() InputPosition {
+	if len(p) == 0 {
+		return InputPosition{}
+	}
+	return p[0].Pos()
+}
+
+func (p Path) End() InputPosition {
+	if len(p) == 0 {
+		return InputPosition{}
+	}
+	return p[len(p)-1].End()
+}
+
+// Component is one segment of a match path: a literal such as 'users', a
+// wildcard such as '{uid}', or a recursive wildcard such as '{rest=**}'.
 type Component struct {
-	wildcard bool
-	recursive bool
-	literal Token
+	Slash      Token
+	Wildcard   bool
+	Recursive  bool
+	Literal    Token
+	RightBrace Token
 }
 
 func (c Component) String() string {
-	if c.recursive {
-		return fmt.Sprintf("{%s=**}", c.literal)
-	} else if c.wildcard {
-		return fmt.Sprintf("{%s}", c.literal)
+	if c.Recursive {
+		return fmt.Sprintf("{%s=**}", c.Literal)
+	} else if c.Wildcard {
+		return fmt.Sprintf("{%s}", c.Literal)
 	} else {
-		return fmt.Sprintf("%s", c.literal)
+		return fmt.Sprintf("%s", c.Literal)
 	}
 }
 
+func (c Component) Pos() InputPosition {
+	return c.Slash.Start
+}
+
+func (c Component) End() InputPosition {
+	if c.Wildcard {
+		return c.RightBrace.End
+	}
+	return c.Literal.End
+}
+
 func ParsePath(tokens *Tokens) (Path, error) {
 	components := make([]Component, 0)
 	for {
+		var slash Token
 		if tokens.Peek().Kind == Slash {
-			tokens.AcceptAny()
+			slash = tokens.AcceptAny()
 		} else if len(components) == 0 {
-			return nil, fmt.Errorf("%s: Path expected", tokens.Peek().Start)
+			return nil, unexpected(tokens.Peek(), "Path expected, found %s")
 		} else {
 			return components, nil
 		}
 
 		switch tokens.Peek().Kind {
 		case Identifier:
-			components = append(components, Component{literal: tokens.AcceptAny()})
+			components = append(components, Component{Slash: slash, Literal: tokens.AcceptAny()})
 		case LeftBrace:
 			tokens.AcceptAny()
 			name, err := tokens.Accept(Identifier)
 			if err != nil {
-				return nil, err
+				return components, err
 			}
 			recursive := false
 			if tokens.Peek().Kind == Eq {
 				tokens.AcceptAny()
-				tokens.Accept(StarStar)
+				_, err = tokens.Accept(StarStar)
+				if err != nil {
+					return components, err
+				}
 				recursive = true
 			}
-			components = append(components, Component{literal: name, wildcard: true, recursive: recursive})
-			_, err = tokens.Accept(RightBrace)
+			rightBrace, err := tokens.Accept(RightBrace)
 			if err != nil {
-				return nil, err
+				return components, err
 			}
+			components = append(components, Component{
+				Slash:      slash,
+				Literal:    name,
+				Wildcard:   true,
+				Recursive:  recursive,
+				RightBrace: rightBrace,
+			})
 		case Slash:
 			tokens.AcceptAny()
 		default:
-			return nil, fmt.Errorf("%s: unexpected token: %s", tokens.Peek().Start, tokens.Peek())
+			return components, unexpected(tokens.Peek(), "unexpected token: %s")
 		}
 	}
-}
\ No newline at end of file
+}
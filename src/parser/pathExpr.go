@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PathExpr is a document path used as a value, as in
+// get(/databases/$(database)/documents/users/$(request.auth.uid)).
+type PathExpr struct {
+	Segments []*PathSegment
+}
+
+func (pe *PathExpr) String() string {
+	s := make([]string, len(pe.Segments))
+	for k, v := range pe.Segments {
+		s[k] = v.String()
+	}
+	return "/" + strings.Join(s, "/")
+}
+
+func (pe *PathExpr) Pos() InputPosition {
+	return pe.Segments[0].Pos()
+}
+
+func (pe *PathExpr) End() InputPosition {
+	return pe.Segments[len(pe.Segments)-1].End()
+}
+
+// PathSegment is one piece of a PathExpr. It is either literal text, a
+// $(expr) interpolation, or a parenthesized (expr). For the latter two Expr is
+// set and RightParen is the closing ')'.
+type PathSegment struct {
+	Slash        Token
+	Literal      []Token
+	Expr         Expr
+	Interpolated bool
+	RightParen   Token
+}
+
+func (ps *PathSegment) String() string {
+	switch {
+	case ps.Expr == nil:
+		s := make([]string, len(ps.Literal))
+		for k, v := range ps.Literal {
+			s[k] = v.Value
+		}
+		return strings.Join(s, "")
+	case ps.Interpolated:
+		return fmt.Sprintf("$(%s)", ps.Expr)
+	default:
+		return fmt.Sprintf("(%s)", ps.Expr)
+	}
+}
+
+func (ps *PathSegment) Pos() InputPosition {
+	return ps.Slash.Start
+}
+
+func (ps *PathSegment) End() InputPosition {
+	if ps.Expr != nil {
+		return ps.RightParen.End
+	}
+	return ps.Literal[len(ps.Literal)-1].End
+}
+
+func ParsePathExpr(tokens *Tokens) (*PathExpr, error) {
+	segments := make([]*PathSegment, 0)
+	slash, err := tokens.Accept(Slash)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		segment, err := ParsePathSegment(tokens, slash)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segment)
+		if tokens.Peek().Kind != Slash || segment.End() != tokens.Peek().Start {
+			return &PathExpr{segments}, nil
+		}
+		slash = tokens.AcceptAny()
+	}
+}
+
+func ParsePathSegment(tokens *Tokens, slash Token) (*PathSegment, error) {
+	next := tokens.Peek()
+	if !adjacent(slash, next) {
+		return nil, unexpected(next, "path segment expected, found %s")
+	}
+	switch {
+	case next.Kind == Dollar:
+		tokens.AcceptAny()
+		if tokens.Peek().Kind != LeftParen || !adjacent(next, tokens.Peek()) {
+			return nil, unexpected(tokens.Peek(), "expected ( after $, found %s")
+		}
+		expr, rightParen, err := parseParenthesized(tokens)
+		if err != nil {
+			return nil, err
+		}
+		return &PathSegment{Slash: slash, Expr: expr, Interpolated: true, RightParen: rightParen}, nil
+	case next.Kind == LeftParen:
+		expr, rightParen, err := parseParenthesized(tokens)
+		if err != nil {
+			return nil, err
+		}
+		return &PathSegment{Slash: slash, Expr: expr, RightParen: rightParen}, nil
+	case isPathLiteral(next.Kind):
+		literal := []Token{tokens.AcceptAny()}
+		for isPathLiteral(tokens.Peek().Kind) && adjacent(literal[len(literal)-1], tokens.Peek()) {
+			literal = append(literal, tokens.AcceptAny())
+		}
+		return &PathSegment{Slash: slash, Literal: literal}, nil
+	default:
+		return nil, unexpected(next, "path segment expected, found %s")
+	}
+}
+
+func parseParenthesized(tokens *Tokens) (Expr, Token, error) {
+	_, err := tokens.Accept(LeftParen)
+	if err != nil {
+		return nil, Token{}, err
+	}
+	expr, err := ParseExpr(tokens)
+	if err != nil {
+		return nil, Token{}, err
+	}
+	rightParen, err := tokens.Accept(RightParen)
+	if err != nil {
+		return nil, Token{}, err
+	}
+	return expr, rightParen, nil
+}
+
+func isPathLiteral(kind Kind) bool {
+	return IsWord(kind) || kind == IntLiteral || kind == Minus
+}
+
+// adjacent reports whether b starts exactly where a ends, with no space between.
+func adjacent(a, b Token) bool {
+	return a.End.Pos == b.Start.Pos
+}
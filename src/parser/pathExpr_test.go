@@ -0,0 +1,57 @@
+package parser
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPathExpr(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"literal", "/databases/foo/documents", "/databases/foo/documents"},
+		{"interpolated", "/databases/$(database)/documents", "/databases/$(database)/documents"},
+		{"parenthesized", "/databases/(database)/documents", "/databases/(database)/documents"},
+		{"dotted interpolation", "/users/$(request.auth.uid)", "/users/$(request.auth.uid)"},
+		{"expression interpolation", "/users/$(a + b)", "/users/$((a + b))"},
+		{"keywords and digits", "/list/get/abc-123/42", "/list/get/abc-123/42"},
+		{"in call", "get(/databases/$(database)/documents/users/$(request.auth.uid))",
+			"get(/databases/$(database)/documents/users/$(request.auth.uid))"},
+		{"field of call", "get(/a/$(b)).data.owner", "get(/a/$(b)).data.owner"},
+		{"comparison", "/a/$(b) == /a/c", "(/a/$(b) == /a/c)"},
+		{"division", "a / b", "(a / b)"},
+		{"path divided", "/a/b / c", "(/a/b / c)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expr, err := ParseExpr(New(test.input))
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, expr.String())
+			reparsed, err := ParseExpr(New(expr.String()))
+			assert.Nil(t, err)
+			assert.Equal(t, expr.String(), reparsed.String())
+		})
+	}
+}
+
+func TestPathExprErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"trailing slash", "/a/", "line 1 col 4: path segment expected, found EOF"},
+		{"space after slash", "/ a", "line 1 col 3: path segment expected, found a"},
+		{"dollar without parens", "/a/$b", "line 1 col 5: expected ( after $, found b"},
+		{"unclosed interpolation", "/a/$(b", "line 1 col 7: unexpected token (EOF)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseExpr(New(test.input))
+			assert.NotNil(t, err)
+			assert.Equal(t, test.err, err.Error())
+		})
+	}
+}
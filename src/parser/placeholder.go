@@ -0,0 +1,66 @@
+package parser
+
+import "fmt"
+
+// Placeholder stands for a value in the conditions of a field declaration.
+// ${value} is the new value of the field and ${name} that of another field of
+// the same type; ${value.prev} and ${name.prev} are their values before the
+// write; ${doc} is the id of the document and ${now} the time of the request.
+// The compiler replaces each placeholder with the expression it stands for.
+type Placeholder struct {
+	Dollar Token
+	Name   Token
+	// Prev is the 'prev' of ${name.prev}. Its Kind is Identifier if it is
+	// present.
+	Prev       Token
+	RightBrace Token
+}
+
+func (ph *Placeholder) String() string {
+	if ph.IsPrev() {
+		return fmt.Sprintf("${%s.prev}", ph.Name.Value)
+	}
+	return fmt.Sprintf("${%s}", ph.Name.Value)
+}
+
+func (ph *Placeholder) Pos() InputPosition {
+	return ph.Dollar.Start
+}
+
+func (ph *Placeholder) End() InputPosition {
+	return ph.RightBrace.End
+}
+
+// IsPrev reports whether the placeholder stands for a value before the
+// write.
+func (ph *Placeholder) IsPrev() bool {
+	return ph.Prev.Kind == Identifier
+}
+
+func ParsePlaceholder(tokens *Tokens) (*Placeholder, error) {
+	dollar, err := tokens.Accept(Dollar)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tokens.Accept(LeftBrace)
+	if err != nil {
+		return nil, err
+	}
+	name, err := tokens.Accept(Identifier)
+	if err != nil {
+		return nil, err
+	}
+	ph := &Placeholder{Dollar: dollar, Name: name}
+	if tokens.Peek().Kind == Dot {
+		tokens.AcceptAny()
+		if t := tokens.Peek(); t.Kind != Identifier || t.Value != "prev" {
+			return nil, unexpected(t, "unexpected token (%s), expected prev")
+		}
+		ph.Prev = tokens.AcceptAny()
+	}
+	ph.RightBrace, err = tokens.Accept(RightBrace)
+	if err != nil {
+		return nil, err
+	}
+	return ph, nil
+}
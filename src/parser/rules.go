@@ -3,28 +3,68 @@ package parser
 import "fmt"
 
 type Rules struct {
-	version Token
-	service *ServiceStmt
+	Keyword  Token
+	Version  Token
+	Service  *ServiceStmt
+	Comments []Token
 }
 
 func (rules *Rules) String() string {
 	return fmt.Sprintf(`
-rules_version = %s
+rules_version = %s;
 
 %s
-`, rules.version, rules.service)
+`, rules.Version, rules.Service)
 }
 
+func (rules *Rules) Pos() InputPosition {
+	if rules.Keyword.Kind == RulesVersion || rules.Service == nil {
+		return rules.Keyword.Start
+	}
+	return rules.Service.Pos()
+}
+
+func (rules *Rules) End() InputPosition {
+	if rules.Service == nil {
+		return rules.Version.End
+	}
+	return rules.Service.End()
+}
+
+// ParseRules parses a complete rules file. Parsing does not stop at the first
+// error: statements that fail to parse are reported and skipped, and the rest
+// of the file is still parsed. The returned Rules holds everything that could
+// be parsed. If anything went wrong the error is an ErrorList holding every
+// error in source order.
 func ParseRules(tokens *Tokens) (*Rules, error) {
+	rules := &Rules{}
+	start := tokens.pos
+	if tokens.Peek().Kind == RulesVersion {
+		rules.Keyword = tokens.Peek()
+	}
 	version, err := ParseRulesVersion(tokens)
 	if err != nil {
-		return nil, err
+		if tokens.pos == start {
+			tokens.report(err)
+		} else {
+			tokens.recover(err, start)
+		}
 	}
+	rules.Version = version
 	service, err := ParseServiceStmt(tokens)
 	if err != nil {
-		return nil, err
+		tokens.report(err)
+	} else {
+		rules.Service = service
+		if tokens.Peek().Kind != Eof {
+			tokens.report(unexpected(tokens.Peek(), "unexpected token after service (%s)"))
+		}
+	}
+	rules.Comments = tokens.Comments()
+	if errs := tokens.Errors(); len(errs) > 0 {
+		return rules, errs
 	}
-	return &Rules{version: version, service: service}, nil
+	return rules, nil
 }
 
 func ParseRulesVersion(tokens *Tokens) (Token, error) {
@@ -45,6 +85,6 @@ func ParseRulesVersion(tokens *Tokens) (Token, error) {
 		}
 		return v, nil
 	default:
-		return Token{}, fmt.Errorf("must start with rules_version")
+		return Token{}, unexpected(tokens.Peek(), "must start with rules_version, found %s")
 	}
 }
@@ -32,12 +32,12 @@ func TestRules(t *testing.T) {
 		{
 			name:     "basic",
 			input:    rulesA,
-			expected: "",
+			expected: "\nrules_version = '2';\n\nservice cloud.firestore { match /foo/{bar} {} }\n",
 		},
 		{
 			name: "file",
 			input: GetFileContent("../../testdata/firestore.rules"),
-			expected: "",
+			expected: GetFileContent("../../testdata/firestore.rules.golden"),
 		},
 	}
 	for _, test := range tests {
@@ -50,3 +50,113 @@ func TestRules(t *testing.T) {
 	}
 }
 
+func TestRulesErrorRecovery(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		errors   []string
+		expected string
+	}{
+		{
+			name: "two bad allows",
+			input: `rules_version = '2';
+service cloud.firestore {
+	match /foo/{bar} {
+		allow read: if a b;
+		allow write: if true;
+		allow foo: if false;
+	}
+}`,
+			errors: []string{
+				"line 4 col 20: unexpected token (b)",
+				"line 6 col 9: unexpected token in accept list (foo)",
+			},
+			expected: "service cloud.firestore { match /foo/{bar} {allow write: if true;} }",
+		},
+		{
+			name: "bad function body",
+			input: `rules_version = '2';
+service cloud.firestore {
+	match /foo/{bar} {
+		function f() { let x = ; return x; }
+		function g() { return 1 }
+		allow read: if g();
+	}
+}`,
+			errors: []string{
+				"line 4 col 26: unexpected token in input: ;",
+				"line 5 col 27: unexpected token (})",
+			},
+			expected: "service cloud.firestore { match /foo/{bar} {allow read: if g();} }",
+		},
+		{
+			name: "bad nested match",
+			input: `rules_version = '2';
+service cloud.firestore {
+	match /foo/{bar} {
+		match /baz/{ {
+			allow read: if true;
+		}
+		allow write: if a +;
+	}
+	function ok() { return true; }
+}`,
+			errors: []string{
+				"line 4 col 16: unexpected token ({)",
+				"line 7 col 22: unexpected token in input: ;",
+			},
+			expected: "service cloud.firestore { match /foo/{bar} {match /baz {allow read: if true;}}function ok () {  return true; } }",
+		},
+		{
+			name: "missing closing brace",
+			input: `rules_version = '2';
+service cloud.firestore {
+	match /foo/{bar} {
+		allow read: if true;
+`,
+			errors: []string{
+				"line 5 col 1: unexpected token (EOF), expected }",
+			},
+			expected: "service cloud.firestore { match /foo/{bar} {allow read: if true;} }",
+		},
+		{
+			name: "missing rules_version",
+			input: `service cloud.firestore {
+	match /foo/{bar} {
+		allow read: if true
+	}
+}`,
+			errors: []string{
+				"line 1 col 1: must start with rules_version, found service",
+				"line 4 col 2: unexpected token (})",
+			},
+			expected: "service cloud.firestore { match /foo/{bar} {} }",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules, err := ParseRules(New(test.input))
+			assert.NotNil(t, rules)
+			errs, ok := err.(ErrorList)
+			if !ok {
+				t.Fatalf("expected an ErrorList but got %v", err)
+			}
+			messages := make([]string, len(errs))
+			for k, e := range errs {
+				messages[k] = e.Error()
+			}
+			assert.Equal(t, test.errors, messages)
+			assert.Equal(t, test.expected, rules.Service.String())
+		})
+	}
+}
+
+func TestRulesComments(t *testing.T) {
+	rules, err := ParseRules(New("// a\nrules_version = '2'; // b\nservice cloud.firestore {\n/* c */\n}\n// d"))
+	assert.Nil(t, err)
+	comments := make([]string, len(rules.Comments))
+	for k, c := range rules.Comments {
+		comments[k] = c.Value
+	}
+	assert.Equal(t, []string{"// a", "// b", "/* c */", "// d"}, comments)
+}
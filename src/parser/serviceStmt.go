@@ -6,8 +6,10 @@ import (
 )
 
 type ServiceStmt struct {
-	Name Expr
+	Keyword    Token
+	Name       *ServiceName
 	Statements []Stmt
+	RightBrace Token
 }
 
 func (ss *ServiceStmt) String() string {
@@ -18,8 +20,16 @@ func (ss *ServiceStmt) String() string {
 	return fmt.Sprintf("service %s { %s }", ss.Name, strings.Join(stmts, ""))
 }
 
+func (ss *ServiceStmt) Pos() InputPosition {
+	return ss.Keyword.Start
+}
+
+func (ss *ServiceStmt) End() InputPosition {
+	return ss.RightBrace.End
+}
+
 func ParseServiceStmt(tokens *Tokens) (*ServiceStmt, error) {
-	_, err := tokens.Accept(Service)
+	keyword, err := tokens.Accept(Service)
 	if err != nil {
 		return nil, err
 	}
@@ -34,42 +44,64 @@ func ParseServiceStmt(tokens *Tokens) (*ServiceStmt, error) {
 
 	stmts := make([]Stmt, 0)
 	for {
+		start := tokens.pos
 		switch tokens.Peek().Kind {
 		case RightBrace:
-			tokens.AcceptAny()
-			return &ServiceStmt{name, stmts}, nil
+			return &ServiceStmt{keyword, name, stmts, tokens.AcceptAny()}, nil
+		case Eof, Error:
+			tokens.report(unexpected(tokens.Peek(), "unexpected token (%s), expected }"))
+			return &ServiceStmt{keyword, name, stmts, tokens.Peek()}, nil
 		case Function:
 			f, err := ParseFunctionDef(tokens)
 			if err != nil {
-				return nil, err
+				tokens.recover(err, start)
+				continue
 			}
 			stmts = append(stmts, f)
 		case Match:
 			m, err := ParseMatchStmt(tokens)
 			if err != nil {
-				return nil, err
+				tokens.recover(err, start)
+				continue
 			}
 			stmts = append(stmts, m)
-			fmt.Printf("finished match\n")
-		default:
-			return nil, LexError{
-				Start: tokens.Peek().Start,
-				Pos:   tokens.Peek().End,
-				msg:   fmt.Sprintf("unexpected token (%s)", tokens.Peek()),
+		case Identifier:
+			if !isTypeDecl(tokens, 0) {
+				tokens.recover(unexpected(tokens.Peek(), "unexpected token (%s)"), start)
+				continue
+			}
+			td, err := ParseTypeDecl(tokens)
+			if err != nil {
+				tokens.recover(err, start)
+				continue
 			}
+			stmts = append(stmts, td)
+		default:
+			tokens.recover(unexpected(tokens.Peek(), "unexpected token (%s)"), start)
 		}
 	}
 }
 
+// ServiceName is the dotted name of a service, such as cloud.firestore.
 type ServiceName struct {
-	name1 Token
-	name2 Token
+	Parts []Token
 }
 
 func (sn *ServiceName) String() string {
-	return fmt.Sprintf("%s.%s", sn.name1, sn.name2)
+	parts := make([]string, len(sn.Parts))
+	for k, v := range sn.Parts {
+		parts[k] = v.Value
+	}
+	return strings.Join(parts, ".")
+}
+
+func (sn *ServiceName) Pos() InputPosition {
+	return sn.Parts[0].Start
 }
 
+func (sn *ServiceName) End() InputPosition {
+	return sn.Parts[len(sn.Parts)-1].End
+}
 
 func ParseServiceName(tokens *Tokens) (*ServiceName, error) {
 	name1, err := tokens.Accept(Identifier)
@@ -84,6 +116,5 @@ func ParseServiceName(tokens *Tokens) (*ServiceName, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &ServiceName{name1, name2}, nil
+	return &ServiceName{[]Token{name1, name2}}, nil
 }
-
@@ -2,7 +2,9 @@ package parser
 
 import "fmt"
 
-// This is a marker for statement-level nodes: 'allow' and 'function'.
-type Stmt interface{
+// Stmt is implemented by statement-level nodes: 'match', 'allow', 'function'
+// and 'type'.
+type Stmt interface {
+	Node
 	fmt.Stringer
 }
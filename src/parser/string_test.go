@@ -0,0 +1,27 @@
+package parser
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExprString(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"a.b.c", "a.b.c"},
+		{"a[1]", "a[1]"},
+		{"a[b + 1]", "a[(b + 1)]"},
+		{"a.b[c].d", "a.b[c].d"},
+		{"!a.b", "(!a.b)"},
+		{"a.b == c[0]", "(a.b == c[0])"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expr, err := ParseExpr(New(test.name))
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, expr.String())
+		})
+	}
+}
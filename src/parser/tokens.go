@@ -1,50 +1,130 @@
 package parser
 
-import (
-	"fmt"
-)
-
 type Tokens struct {
-	ch  chan Token
-	buf []Token
-	pos int
+	lexer  *Lexer
+	buf    []Token
+	pos    int
+	errors ErrorList
 }
 
 func New(input string) *Tokens {
 	return &Tokens{
-		ch:  Start(input),
-		buf: make([]Token, 0),
-		pos: 0,
+		lexer: NewLexer(input),
+		buf:   make([]Token, 0),
+		pos:   0,
 	}
 }
 
 func (tokens *Tokens) Peek() Token {
 	if tokens.pos >= len(tokens.buf) {
-		tokens.buf = append(tokens.buf, <-tokens.ch)
+		tokens.buf = append(tokens.buf, tokens.lexer.Next())
 	}
 	return tokens.buf[tokens.pos]
 }
 
+// peekAt returns the token n places after the next one without consuming anything.
+func (tokens *Tokens) peekAt(n int) Token {
+	for tokens.pos+n >= len(tokens.buf) {
+		tokens.buf = append(tokens.buf, tokens.lexer.Next())
+	}
+	return tokens.buf[tokens.pos+n]
+}
+
 func (tokens *Tokens) AcceptAny() Token {
 	if tokens.pos >= len(tokens.buf) {
-		tokens.buf = append(tokens.buf, <-tokens.ch)
+		tokens.buf = append(tokens.buf, tokens.lexer.Next())
 	}
 	tokens.pos++
 	return tokens.buf[tokens.pos-1]
 }
 
+// Accept consumes the next token if it is of the given kind. Otherwise the
+// token is left in place and an error is returned.
 func (tokens *Tokens) Accept(kind Kind) (Token, error) {
-	t := tokens.AcceptAny()
+	t := tokens.Peek()
 	switch t.Kind {
 	case kind:
-		return t, nil
+		return tokens.AcceptAny(), nil
 	case Error:
 		return Token{Kind: Error}, t.Error
 	default:
-		return Token{Kind: Error}, &LexError{
-			Start: t.Start,
-			Pos:   t.End,
-			msg:   fmt.Sprintf("unexpected token (%s)", t.ErrString()),
+		return Token{Kind: Error}, unexpected(t, "unexpected token (%s)")
+	}
+}
+
+// Comments returns the comment trivia attached to every token read so far, in
+// source order.
+func (tokens *Tokens) Comments() []Token {
+	result := make([]Token, 0)
+	for _, t := range tokens.buf {
+		result = append(result, t.Leading...)
+		result = append(result, t.Trailing...)
+	}
+	return result
+}
+
+// Errors returns the errors reported so far, ordered by position.
+func (tokens *Tokens) Errors() ErrorList {
+	result := make(ErrorList, len(tokens.errors))
+	copy(result, tokens.errors)
+	result.sort()
+	return result
+}
+
+func (tokens *Tokens) report(err error) {
+	pe := toParseError(err, tokens.Peek())
+	for _, e := range tokens.errors {
+		if e.StartPos == pe.StartPos {
+			return
+		}
+	}
+	tokens.errors = append(tokens.errors, pe)
+}
+
+// recover reports err and then skips ahead to a point where the statement
+// that began at token index start can be considered finished, so that its
+// enclosing block can carry on parsing. Skipping stops before a '}' that
+// closes the enclosing block, before a statement keyword,
+// at the end of input, or after the ';' or '}' that ends the statement.
+func (tokens *Tokens) recover(err error, start int) {
+	tokens.report(err)
+	depth := 0
+	for _, t := range tokens.buf[start:tokens.pos] {
+		switch t.Kind {
+		case LeftBrace:
+			depth++
+		case RightBrace:
+			depth--
+		}
+	}
+	if tokens.pos == start {
+		tokens.AcceptAny()
+	}
+	for {
+		switch tokens.Peek().Kind {
+		case Eof, Error, Service, Match, Allow, Function:
+			return
+		case Identifier:
+			if isTypeDecl(tokens, 0) {
+				return
+			}
+		case LeftBrace:
+			depth++
+		case RightBrace:
+			if depth <= 0 {
+				return
+			}
+			depth--
+			if depth == 0 {
+				tokens.AcceptAny()
+				return
+			}
+		case SemiColon:
+			if depth <= 0 {
+				tokens.AcceptAny()
+				return
+			}
 		}
+		tokens.AcceptAny()
 	}
 }
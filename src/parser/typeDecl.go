@@ -0,0 +1,380 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TypeDecl declares the shape of a document, listing the fields it may hold
+// and their types:
+//
+//	type Issue {
+//	  title: string<100>;
+//	  tags?: list<string, 20>;
+//	}
+type TypeDecl struct {
+	Keyword    Token
+	Name       Token
+	Fields     []*FieldDecl
+	RightBrace Token
+}
+
+func (td *TypeDecl) String() string {
+	fields := make([]string, len(td.Fields))
+	for k, v := range td.Fields {
+		fields[k] = v.String()
+	}
+	return fmt.Sprintf("type %s { %s }", td.Name.Value, strings.Join(fields, " "))
+}
+
+func (td *TypeDecl) Pos() InputPosition {
+	return td.Keyword.Start
+}
+
+func (td *TypeDecl) End() InputPosition {
+	return td.RightBrace.End
+}
+
+// Field returns the declaration of the named field, or nil if there is none.
+func (td *TypeDecl) Field(name string) *FieldDecl {
+	for _, f := range td.Fields {
+		if f.Name.Value == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// FieldDecl is a field of a TypeDecl. A field written with a '?' after its
+// name is optional: a document need not have it. Modifiers such as immutable
+// may precede the name, and conditions on the value of the field may follow
+// its type in braces:
+//
+//	immutable title: string {
+//	  invariant: ${value}.size() > 10;
+//	  allowCreateIf: ${author} == request.auth.uid;
+//	}
+type FieldDecl struct {
+	// Modifiers are the identifiers before the name, each one of Readonly,
+	// Immutable, ServerTimestamp and AuthorUid.
+	Modifiers []Token
+	Name      Token
+	// Optional is the '?' of an optional field. Its Kind is QuestionMark if
+	// it is present.
+	Optional Token
+	Type     *TypeRef
+	// SemiColon ends a field without conditions.
+	SemiColon Token
+	// LeftBrace opens the conditions of a field that has them. Its Kind is
+	// LeftBrace if it is present.
+	LeftBrace  Token
+	Conditions []*FieldCondition
+	RightBrace Token
+}
+
+func (fd *FieldDecl) String() string {
+	if !fd.HasConditions() {
+		return fd.Head() + ";"
+	}
+	conditions := make([]string, len(fd.Conditions))
+	for k, v := range fd.Conditions {
+		conditions[k] = v.String()
+	}
+	return fmt.Sprintf("%s { %s }", fd.Head(), strings.Join(conditions, " "))
+}
+
+// Head returns the modifiers, name and type of the field, as in
+// "readonly tags?: list<string>".
+func (fd *FieldDecl) Head() string {
+	var b strings.Builder
+	for _, m := range fd.Modifiers {
+		b.WriteString(m.Value + " ")
+	}
+	b.WriteString(fd.Name.Value)
+	if fd.IsOptional() {
+		b.WriteString("?")
+	}
+	fmt.Fprintf(&b, ": %s", fd.Type)
+	return b.String()
+}
+
+func (fd *FieldDecl) Pos() InputPosition {
+	if len(fd.Modifiers) > 0 {
+		return fd.Modifiers[0].Start
+	}
+	return fd.Name.Start
+}
+
+func (fd *FieldDecl) End() InputPosition {
+	if fd.HasConditions() {
+		return fd.RightBrace.End
+	}
+	return fd.SemiColon.End
+}
+
+// IsOptional reports whether the field was declared with a '?'.
+func (fd *FieldDecl) IsOptional() bool {
+	return fd.Optional.Kind == QuestionMark
+}
+
+// Has reports whether the field was declared with the named modifier.
+func (fd *FieldDecl) Has(modifier string) bool {
+	for _, m := range fd.Modifiers {
+		if m.Value == modifier {
+			return true
+		}
+	}
+	return false
+}
+
+// The modifiers of a field.
+const (
+	// Readonly fields cannot be written: a create cannot set them and an
+	// update cannot change them.
+	Readonly = "readonly"
+	// Immutable fields are set when a document is created and never change.
+	Immutable = "immutable"
+	// ServerTimestamp fields hold the time of the write.
+	ServerTimestamp = "serverTimestamp"
+	// AuthorUid fields hold the uid of the user who made the write.
+	AuthorUid = "authorUid"
+)
+
+// isModifier reports whether t is a field modifier rather than the name of
+// the field, which it is if a word follows it.
+func isModifier(t, next Token) bool {
+	if t.Kind != Identifier || !IsWord(next.Kind) {
+		return false
+	}
+	switch t.Value {
+	case Readonly, Immutable, ServerTimestamp, AuthorUid:
+		return true
+	}
+	return false
+}
+
+// HasConditions reports whether the field was declared with conditions in
+// braces, even if there are none.
+func (fd *FieldDecl) HasConditions() bool {
+	return fd.LeftBrace.Kind == LeftBrace
+}
+
+// The names of the conditions of a field.
+const (
+	// Invariant must hold for every value of the field that is written.
+	Invariant = "invariant"
+	// AllowCreateIf must hold when a document is created.
+	AllowCreateIf = "allowCreateIf"
+	// AllowUpdateIf must hold when a document is updated.
+	AllowUpdateIf = "allowUpdateIf"
+)
+
+// FieldCondition is a condition on the value of a field, such as
+//
+//	invariant: ${value}.size() > 10;
+//
+// Its Name is Invariant, AllowCreateIf or AllowUpdateIf.
+type FieldCondition struct {
+	Name      Token
+	Cond      Expr
+	SemiColon Token
+}
+
+func (fc *FieldCondition) String() string {
+	return fmt.Sprintf("%s: %s;", fc.Name.Value, fc.Cond)
+}
+
+func (fc *FieldCondition) Pos() InputPosition {
+	return fc.Name.Start
+}
+
+func (fc *FieldCondition) End() InputPosition {
+	return fc.SemiColon.End
+}
+
+// TypeRef is the type of a field: a primitive type such as string or int, or
+// the name of a declared type. Arguments in angle brackets give the element
+// type of a list or map and the largest size of a string, bytes, list or map
+// value, as in string<100>, list<string, 20> and map<int>.
+type TypeRef struct {
+	Name Token
+	// Elem is the element type of a list or map, or nil.
+	Elem *TypeRef
+	// Size is the IntLiteral giving the largest size, if there is one.
+	Size Token
+	// Greater is the '>' that closes the arguments, if there are any.
+	Greater Token
+}
+
+func (tr *TypeRef) String() string {
+	var args []string
+	if tr.Elem != nil {
+		args = append(args, tr.Elem.String())
+	}
+	if tr.HasSize() {
+		args = append(args, tr.Size.Value)
+	}
+	if len(args) == 0 {
+		return tr.Name.Value
+	}
+	return fmt.Sprintf("%s<%s>", tr.Name.Value, strings.Join(args, ", "))
+}
+
+func (tr *TypeRef) Pos() InputPosition {
+	return tr.Name.Start
+}
+
+func (tr *TypeRef) End() InputPosition {
+	if tr.Greater.Kind == Greater {
+		return tr.Greater.End
+	}
+	return tr.Name.End
+}
+
+// HasSize reports whether the type has a size bound.
+func (tr *TypeRef) HasSize() bool {
+	return tr.Size.Kind == IntLiteral
+}
+
+// typeKeyword introduces a type declaration. It is not a reserved word, so
+// that type can still name a path segment, a variable or a field.
+const typeKeyword = "type"
+
+// isTypeDecl reports whether the tokens from the nth on start a type
+// declaration: the identifier type, the name of the type and '{'.
+func isTypeDecl(tokens *Tokens, n int) bool {
+	t := tokens.peekAt(n)
+	return t.Kind == Identifier && t.Value == typeKeyword &&
+		tokens.peekAt(n+1).Kind == Identifier && tokens.peekAt(n+2).Kind == LeftBrace
+}
+
+func ParseTypeDecl(tokens *Tokens) (*TypeDecl, error) {
+	keyword := tokens.Peek()
+	if keyword.Kind != Identifier || keyword.Value != typeKeyword {
+		return nil, unexpected(keyword, "unexpected token (%s), expected type")
+	}
+	tokens.AcceptAny()
+	name, err := tokens.Accept(Identifier)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tokens.Accept(LeftBrace)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]*FieldDecl, 0)
+	for {
+		switch t := tokens.Peek(); {
+		case t.Kind == RightBrace:
+			return &TypeDecl{Keyword: keyword, Name: name, Fields: fields, RightBrace: tokens.AcceptAny()}, nil
+		case IsWord(t.Kind):
+			f, err := ParseFieldDecl(tokens)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, f)
+		default:
+			return nil, unexpected(t, "unexpected token in type declaration (%s)")
+		}
+	}
+}
+
+func ParseFieldDecl(tokens *Tokens) (*FieldDecl, error) {
+	var modifiers []Token
+	for isModifier(tokens.Peek(), tokens.peekAt(1)) {
+		modifiers = append(modifiers, tokens.AcceptAny())
+	}
+	name := tokens.Peek()
+	if !IsWord(name.Kind) {
+		return nil, unexpected(name, "unexpected token (%s), expected a field name")
+	}
+	tokens.AcceptAny()
+	var optional Token
+	if tokens.Peek().Kind == QuestionMark {
+		optional = tokens.AcceptAny()
+	}
+	_, err := tokens.Accept(Colon)
+	if err != nil {
+		return nil, err
+	}
+	typ, err := ParseTypeRef(tokens)
+	if err != nil {
+		return nil, err
+	}
+	fd := &FieldDecl{Modifiers: modifiers, Name: name, Optional: optional, Type: typ}
+	if tokens.Peek().Kind != LeftBrace {
+		fd.SemiColon, err = tokens.Accept(SemiColon)
+		if err != nil {
+			return nil, err
+		}
+		return fd, nil
+	}
+	fd.LeftBrace = tokens.AcceptAny()
+	fd.Conditions = make([]*FieldCondition, 0)
+	for tokens.Peek().Kind != RightBrace {
+		fc, err := ParseFieldCondition(tokens)
+		if err != nil {
+			return nil, err
+		}
+		fd.Conditions = append(fd.Conditions, fc)
+	}
+	fd.RightBrace = tokens.AcceptAny()
+	return fd, nil
+}
+
+func ParseFieldCondition(tokens *Tokens) (*FieldCondition, error) {
+	name := tokens.Peek()
+	if name.Kind != Identifier || name.Value != Invariant && name.Value != AllowCreateIf && name.Value != AllowUpdateIf {
+		return nil, unexpected(name, "unexpected token (%s), expected invariant, allowCreateIf or allowUpdateIf")
+	}
+	tokens.AcceptAny()
+	_, err := tokens.Accept(Colon)
+	if err != nil {
+		return nil, err
+	}
+	cond, err := ParseExpr(tokens)
+	if err != nil {
+		return nil, err
+	}
+	semi, err := tokens.Accept(SemiColon)
+	if err != nil {
+		return nil, err
+	}
+	return &FieldCondition{Name: name, Cond: cond, SemiColon: semi}, nil
+}
+
+// ParseTypeRef parses a type: a name, optionally followed by an element type
+// and a size, or by a size alone, in angle brackets.
+func ParseTypeRef(tokens *Tokens) (*TypeRef, error) {
+	name := tokens.Peek()
+	if !IsWord(name.Kind) {
+		return nil, unexpected(name, "unexpected token (%s), expected a type")
+	}
+	tokens.AcceptAny()
+	tr := &TypeRef{Name: name}
+	if tokens.Peek().Kind != Less {
+		return tr, nil
+	}
+	tokens.AcceptAny()
+	if tokens.Peek().Kind != IntLiteral {
+		elem, err := ParseTypeRef(tokens)
+		if err != nil {
+			return nil, err
+		}
+		tr.Elem = elem
+		if tokens.Peek().Kind == Comma {
+			tokens.AcceptAny()
+			if tr.Size, err = tokens.Accept(IntLiteral); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		tr.Size = tokens.AcceptAny()
+	}
+	greater, err := tokens.Accept(Greater)
+	if err != nil {
+		return nil, err
+	}
+	tr.Greater = greater
+	return tr, nil
+}
@@ -0,0 +1,234 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTypeDecl(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "empty",
+			input:    "type Empty {}",
+			expected: "type Empty {  }",
+		},
+		{
+			name:     "primitives",
+			input:    "type Issue { title: string; votes: int; open: bool; created: timestamp; }",
+			expected: "type Issue { title: string; votes: int; open: bool; created: timestamp; }",
+		},
+		{
+			name:     "optional",
+			input:    "type Issue { description?: string; }",
+			expected: "type Issue { description?: string; }",
+		},
+		{
+			name:     "sizes",
+			input:    "type Issue { title: string<100>; tags: list<string, 20>; scores: map<int>; labels: list<string<10>>; }",
+			expected: "type Issue { title: string<100>; tags: list<string, 20>; scores: map<int>; labels: list<string<10>>; }",
+		},
+		{
+			name:     "reserved words as names",
+			input:    "type Request { delete: bool; list: list; }",
+			expected: "type Request { delete: bool; list: list; }",
+		},
+		{
+			name:     "declared type",
+			input:    "type User { address?: Address; }",
+			expected: "type User { address?: Address; }",
+		},
+		{
+			name:     "modifiers",
+			input:    "type Post { immutable serverTimestamp created: timestamp; readonly votes?: int; readonly: bool; immutable immutable: string; }",
+			expected: "type Post { immutable serverTimestamp created: timestamp; readonly votes?: int; readonly: bool; immutable immutable: string; }",
+		},
+		{
+			name:     "conditions",
+			input:    "type Issue { id: string { invariant: ${value} == ${doc}; allowUpdateIf: ${value} == ${value.prev}; } note?: string {} }",
+			expected: "type Issue { id: string { invariant: (${value} == ${doc}); allowUpdateIf: (${value} == ${value.prev}); } note?: string {  } }",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			td, err := ParseTypeDecl(New(test.input))
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, td.String())
+		})
+	}
+}
+
+func TestTypeDeclFields(t *testing.T) {
+	td, err := ParseTypeDecl(New("type Issue { title: string<100>; tags?: list<string, 20>; }"))
+	assert.Nil(t, err)
+	title, tags := td.Field("title"), td.Field("tags")
+	assert.False(t, title.IsOptional())
+	assert.True(t, title.Type.HasSize())
+	assert.Equal(t, "100", title.Type.Size.Value)
+	assert.Nil(t, title.Type.Elem)
+	assert.True(t, tags.IsOptional())
+	assert.Equal(t, "string", tags.Type.Elem.Name.Value)
+	assert.Equal(t, "20", tags.Type.Size.Value)
+	assert.Nil(t, td.Field("nope"))
+	assert.False(t, title.HasConditions())
+}
+
+func TestFieldModifiers(t *testing.T) {
+	input := "type Post { immutable authorUid author: string; readonly: bool; }"
+	td, err := ParseTypeDecl(New(input))
+	assert.Nil(t, err)
+	author := td.Field("author")
+	assert.True(t, author.Has(Immutable))
+	assert.True(t, author.Has(AuthorUid))
+	assert.False(t, author.Has(Readonly))
+	assert.Equal(t, "immutable authorUid author: string;", input[author.Pos().Pos:author.End().Pos])
+	readonly := td.Field("readonly")
+	assert.Empty(t, readonly.Modifiers)
+}
+
+func TestFieldConditions(t *testing.T) {
+	td, err := ParseTypeDecl(New("type Issue { created: timestamp { allowCreateIf: ${value} == ${now}; allowUpdateIf: ${value} == ${created.prev}; } }"))
+	assert.Nil(t, err)
+	created := td.Field("created")
+	assert.True(t, created.HasConditions())
+	if assert.Len(t, created.Conditions, 2) {
+		assert.Equal(t, AllowCreateIf, created.Conditions[0].Name.Value)
+		assert.Equal(t, AllowUpdateIf, created.Conditions[1].Name.Value)
+		prev := created.Conditions[1].Cond.(*BinaryExpr).Rhs.(*Placeholder)
+		assert.Equal(t, "created", prev.Name.Value)
+		assert.True(t, prev.IsPrev())
+		now := created.Conditions[0].Cond.(*BinaryExpr).Rhs.(*Placeholder)
+		assert.False(t, now.IsPrev())
+		assert.Equal(t, "${now}", now.String())
+	}
+}
+
+func TestTypeDeclErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		error string
+	}{
+		{"missing name", "type { }", "line 1 col 6: unexpected token ({)"},
+		{"missing colon", "type T { a string; }", "line 1 col 12: unexpected token (string)"},
+		{"missing type", "type T { a: ; }", "line 1 col 13: unexpected token (;), expected a type"},
+		{"missing semicolon", "type T { a: string }", "line 1 col 20: unexpected token (})"},
+		{"unclosed size", "type T { a: string<100; }", "line 1 col 23: unexpected token (;)"},
+		{"bad size", "type T { a: list<string, x>; }", "line 1 col 26: unexpected token (x)"},
+		{"not a field", "type T { 1: int; }", "line 1 col 10: unexpected token in type declaration (1)"},
+		{"unknown condition", "type T { a: int { check: true; } }", "line 1 col 19: unexpected token (check), expected invariant, allowCreateIf or allowUpdateIf"},
+		{"condition without semicolon", "type T { a: int { invariant: true } }", "line 1 col 35: unexpected token (})"},
+		{"bad placeholder", "type T { a: int { invariant: ${value.next} > 0; } }", "line 1 col 38: unexpected token (next), expected prev"},
+		{"unclosed placeholder", "type T { a: int { invariant: ${value > 0; } }", "line 1 col 38: unexpected token (>)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseTypeDecl(New(test.input))
+			if assert.NotNil(t, err) {
+				assert.Equal(t, test.error, err.Error())
+			}
+		})
+	}
+}
+
+func TestParseTypeDeclInRules(t *testing.T) {
+	input := `rules_version = '2';
+service cloud.firestore {
+  type Address { city: string<50>; }
+  match /databases/{database}/documents {
+    match /users/{uid} {
+      type User {
+        name: string<100>;
+        address?: Address;
+      }
+      allow read: if true;
+    }
+  }
+}`
+	rules, err := ParseRules(New(input))
+	assert.Nil(t, err)
+	address := rules.Service.Statements[0].(*TypeDecl)
+	assert.Equal(t, "Address", address.Name.Value)
+	match := rules.Service.Statements[1].(*MatchStmt).Components[0].(*MatchStmt)
+	user := match.Components[0].(*TypeDecl)
+	assert.Equal(t, "type User { name: string<100>; address?: Address; }", user.String())
+
+	text := func(n Node) string {
+		return input[n.Pos().Pos:n.End().Pos]
+	}
+	assert.Equal(t, "type Address { city: string<50>; }", text(address))
+	assert.Equal(t, "name: string<100>;", text(user.Fields[0]))
+	assert.Equal(t, "string<100>", text(user.Fields[0].Type))
+	assert.Equal(t, "Address", text(user.Fields[1].Type))
+
+	count := 0
+	Inspect(rules, func(n Node) bool {
+		if _, ok := n.(*TypeRef); ok {
+			count++
+		}
+		return true
+	})
+	assert.Equal(t, 3, count)
+}
+
+func TestParseTypeDeclRecovers(t *testing.T) {
+	input := `rules_version = '2';
+service cloud.firestore {
+  match /databases/{database}/documents {
+    type T { a: ; }
+    allow read: if true;
+  }
+}`
+	rules, err := ParseRules(New(input))
+	assert.NotNil(t, err)
+	assert.Equal(t, "line 4 col 17: unexpected token (;), expected a type", err.Error())
+	match := rules.Service.Statements[0].(*MatchStmt)
+	assert.Len(t, match.Components, 1)
+}
+
+func TestTypeIsNotReserved(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "path segment",
+			input:    "match /type/{id} { allow read: if true; }",
+			expected: "match /type/{id} {allow read: if true;}",
+		},
+		{
+			name:     "path variable",
+			input:    "match /c/{type} { allow read: if type == 'a'; }",
+			expected: "match /c/{type} {allow read: if (type == 'a');}",
+		},
+		{
+			name:     "parameter",
+			input:    "function f(type) { return type; }",
+			expected: "function f (type) {  return type; }",
+		},
+		{
+			name:     "let",
+			input:    "function f() { let type = 1; return type; }",
+			expected: "function f () { let type = 1; return type; }",
+		},
+		{
+			name:     "field",
+			input:    "type T { type: string; }",
+			expected: "type T { type: string; }",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules, err := ParseRules(New("rules_version = '2'; service cloud.firestore { " + test.input + " }"))
+			assert.Nil(t, err)
+			if assert.Len(t, rules.Service.Statements, 1) {
+				assert.Equal(t, test.expected, rules.Service.Statements[0].String())
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package parser
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Unquote returns the value of the text of a string literal, which is quoted
+// with either ' or " and may contain the same escapes as a Go string. The
+// text of a bytes literal may be passed too, with its leading b.
+func Unquote(s string) (string, error) {
+	if strings.HasPrefix(s, "b") || strings.HasPrefix(s, "B") {
+		s = s[1:]
+	}
+	if len(s) < 2 || s[0] != s[len(s)-1] || (s[0] != '\'' && s[0] != '"') {
+		return "", errors.New("invalid string literal")
+	}
+	quote := s[0]
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for len(s) > 0 {
+		r, multibyte, tail, err := strconv.UnquoteChar(s, quote)
+		if err != nil {
+			return "", err
+		}
+		if r < 0x100 && !multibyte {
+			b.WriteByte(byte(r))
+		} else {
+			b.WriteRune(r)
+		}
+		s = tail
+	}
+	return b.String(), nil
+}
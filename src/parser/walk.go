@@ -0,0 +1,159 @@
+package parser
+
+import "fmt"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk. If
+// the result visitor w is not nil, Walk visits each of the children of node
+// with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node in depth-first order. It starts by
+// calling v.Visit(node); node must not be nil.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Rules:
+		if n.Service != nil {
+			Walk(v, n.Service)
+		}
+
+	case *ServiceStmt:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		walkStmtList(v, n.Statements)
+
+	case *ServiceName:
+		// nothing to do
+
+	case *MatchStmt:
+		if n.Path != nil {
+			Walk(v, n.Path)
+		}
+		walkStmtList(v, n.Components)
+
+	case Path:
+		for _, c := range n {
+			Walk(v, c)
+		}
+
+	case Component:
+		// nothing to do
+
+	case *AllowStmt:
+		Walk(v, n.Condition)
+
+	case *FunctionDef:
+		for _, p := range n.Params {
+			Walk(v, p)
+		}
+		for _, l := range n.Lets {
+			Walk(v, l)
+		}
+		Walk(v, n.Return)
+
+	case Param:
+		// nothing to do
+
+	case *LetDef:
+		Walk(v, n.Value)
+
+	case *TypeDecl:
+		for _, f := range n.Fields {
+			Walk(v, f)
+		}
+
+	case *FieldDecl:
+		Walk(v, n.Type)
+		for _, c := range n.Conditions {
+			Walk(v, c)
+		}
+
+	case *FieldCondition:
+		Walk(v, n.Cond)
+
+	case *TypeRef:
+		if n.Elem != nil {
+			Walk(v, n.Elem)
+		}
+
+	case *TernaryExpr:
+		Walk(v, n.Cond)
+		Walk(v, n.True)
+		Walk(v, n.False)
+
+	case *BinaryExpr:
+		Walk(v, n.Lhs)
+		Walk(v, n.Rhs)
+
+	case *UnaryExpr:
+		Walk(v, n.Operand)
+
+	case *Id, *Literal, *Placeholder:
+		// nothing to do
+
+	case *FunctionCall:
+		Walk(v, n.Fn)
+		walkExprList(v, n.Args)
+
+	case *ArrayLiteral:
+		walkExprList(v, n.Elements)
+
+	case *MapLiteral:
+		for _, e := range n.Entries {
+			Walk(v, e)
+		}
+
+	case *MapEntry:
+		Walk(v, n.Key)
+		Walk(v, n.Value)
+
+	case *PathExpr:
+		for _, s := range n.Segments {
+			Walk(v, s)
+		}
+
+	case *PathSegment:
+		if n.Expr != nil {
+			Walk(v, n.Expr)
+		}
+
+	default:
+		panic(fmt.Sprintf("parser.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkStmtList(v Visitor, list []Stmt) {
+	for _, s := range list {
+		Walk(v, s)
+	}
+}
+
+func walkExprList(v Visitor, list []Expr) {
+	for _, x := range list {
+		Walk(v, x)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node in depth-first order. It starts by
+// calling f(node); node must not be nil. If f returns true, Inspect invokes f
+// recursively for each of the children of node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
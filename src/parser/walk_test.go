@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const walkInput = `rules_version = '2';
+service cloud.firestore {
+  match /users/{uid} {
+    function owner(id) {
+      let x = [1, {'a': b}];
+      return id == uid ? !x : get(/users/$(id)).data;
+    }
+    allow read: if owner(uid);
+  }
+}`
+
+func TestInspect(t *testing.T) {
+	rules, err := ParseRules(New(walkInput))
+	assert.Nil(t, err)
+	var visited []string
+	Inspect(rules, func(n Node) bool {
+		if n != nil {
+			visited = append(visited, fmt.Sprintf("%T", n))
+		}
+		return true
+	})
+	assert.Equal(t, strings.Join([]string{
+		"*parser.Rules",
+		"*parser.ServiceStmt",
+		"*parser.ServiceName",
+		"*parser.MatchStmt",
+		"parser.Path",
+		"parser.Component",
+		"parser.Component",
+		"*parser.FunctionDef",
+		"parser.Param",
+		"*parser.LetDef",
+		"*parser.ArrayLiteral",
+		"*parser.Literal",
+		"*parser.MapLiteral",
+		"*parser.MapEntry",
+		"*parser.Literal",
+		"*parser.Id",
+		"*parser.TernaryExpr",
+		"*parser.BinaryExpr",
+		"*parser.Id",
+		"*parser.Id",
+		"*parser.UnaryExpr",
+		"*parser.Id",
+		"*parser.BinaryExpr",
+		"*parser.FunctionCall",
+		"*parser.Id",
+		"*parser.PathExpr",
+		"*parser.PathSegment",
+		"*parser.PathSegment",
+		"*parser.Id",
+		"*parser.Id",
+		"*parser.AllowStmt",
+		"*parser.FunctionCall",
+		"*parser.Id",
+		"*parser.Id",
+	}, "\n"), strings.Join(visited, "\n"))
+}
+
+func TestInspectPrune(t *testing.T) {
+	rules, err := ParseRules(New(walkInput))
+	assert.Nil(t, err)
+	var ids []string
+	Inspect(rules, func(n Node) bool {
+		switch n := n.(type) {
+		case *FunctionDef:
+			return false
+		case *Id:
+			ids = append(ids, n.Name.Value)
+		}
+		return true
+	})
+	assert.Equal(t, []string{"owner", "uid"}, ids)
+}
+
+type countingVisitor struct {
+	enter, leave int
+}
+
+func (v *countingVisitor) Visit(n Node) Visitor {
+	if n == nil {
+		v.leave++
+	} else {
+		v.enter++
+	}
+	return v
+}
+
+func TestWalkBalanced(t *testing.T) {
+	rules, err := ParseRules(New(GetFileContent("../../testdata/firestore.rules")))
+	assert.Nil(t, err)
+	v := &countingVisitor{}
+	Walk(v, rules)
+	assert.True(t, v.enter > 100)
+	assert.Equal(t, v.enter, v.leave)
+}
@@ -0,0 +1,306 @@
+// Package pathmatch matches document paths against the paths of match
+// statements. It finds the statements that apply to a document, the values
+// their wildcards capture, and the statements whose paths overlap so that
+// both apply to some documents.
+package pathmatch
+
+import (
+	"strings"
+
+	"firestore-rules/src/parser"
+)
+
+// Binding is the value a wildcard captured.
+type Binding struct {
+	Name string
+	// Value is the segment matched by a wildcard such as {uid}, or the path
+	// matched by a recursive wildcard such as {rest=**}, written with a
+	// leading slash.
+	Value     string
+	Recursive bool
+}
+
+// Prefix is one way a match path matches the start of a document path.
+type Prefix struct {
+	Bindings []Binding
+	// Rest holds the segments of the document path after the part matched.
+	Rest []string
+}
+
+// Match is a match statement whose path matches a whole document path.
+type Match struct {
+	// Chain holds the statement and the match statements enclosing it,
+	// outermost first. The statement itself is last.
+	Chain    []*parser.MatchStmt
+	Bindings []Binding
+}
+
+// Stmt returns the statement that matched.
+func (m Match) Stmt() *parser.MatchStmt {
+	return m.Chain[len(m.Chain)-1]
+}
+
+// Version returns the rules_version declared by rules: "1" or "2". It is "1"
+// if there is no declaration.
+func Version(rules *parser.Rules) string {
+	if v, err := parser.Unquote(rules.Version.Value); err == nil && v != "" {
+		return v
+	}
+	return "1"
+}
+
+// Segments splits a document path into its segments.
+func Segments(path string) []string {
+	s := strings.Trim(path, "/")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "/")
+}
+
+// MatchPrefix returns every way that path matches the start of segments.
+// Only a recursive wildcard can match in more than one way: in rules_version 2
+// it matches zero or more segments, and in version 1 one or more. The
+// results are ordered by how many segments the recursive wildcards matched,
+// fewest first.
+func MatchPrefix(path parser.Path, segments []string, version string) []Prefix {
+	if len(path) == 0 {
+		return []Prefix{{Rest: segments}}
+	}
+	c := path[0]
+	name := c.Literal.Value
+	var result []Prefix
+	switch {
+	case c.Recursive:
+		for n := minRecursive(version); n <= len(segments); n++ {
+			b := Binding{Name: name, Value: "/" + strings.Join(segments[:n], "/"), Recursive: true}
+			for _, p := range MatchPrefix(path[1:], segments[n:], version) {
+				p.Bindings = append([]Binding{b}, p.Bindings...)
+				result = append(result, p)
+			}
+		}
+	case len(segments) == 0:
+	case c.Wildcard:
+		b := Binding{Name: name, Value: segments[0]}
+		for _, p := range MatchPrefix(path[1:], segments[1:], version) {
+			p.Bindings = append([]Binding{b}, p.Bindings...)
+			result = append(result, p)
+		}
+	case name == segments[0]:
+		result = MatchPrefix(path[1:], segments[1:], version)
+	}
+	return result
+}
+
+func minRecursive(version string) int {
+	if version == "2" {
+		return 0
+	}
+	return 1
+}
+
+// Find returns every match statement of rules whose path, joined to the
+// paths of the statements enclosing it, matches the whole of the document
+// path, in source order. A statement is found once for each way it matches.
+func Find(rules *parser.Rules, path string) []Match {
+	if rules == nil || rules.Service == nil {
+		return nil
+	}
+	var result []Match
+	var find func(stmts []parser.Stmt, rest []string, chain []*parser.MatchStmt, bindings []Binding)
+	find = func(stmts []parser.Stmt, rest []string, chain []*parser.MatchStmt, bindings []Binding) {
+		for _, stmt := range stmts {
+			ms, ok := stmt.(*parser.MatchStmt)
+			if !ok {
+				continue
+			}
+			inner := append(append([]*parser.MatchStmt{}, chain...), ms)
+			for _, p := range MatchPrefix(ms.Path, rest, Version(rules)) {
+				all := append(append([]Binding{}, bindings...), p.Bindings...)
+				if len(p.Rest) == 0 {
+					result = append(result, Match{Chain: inner, Bindings: all})
+				}
+				find(ms.Components, p.Rest, inner, all)
+			}
+		}
+	}
+	find(rules.Service.Statements, Segments(path), nil, nil)
+	return result
+}
+
+// Overlap is a pair of match statements that both apply to some documents.
+type Overlap struct {
+	// A and B are the statements with the statements enclosing them,
+	// outermost first, as in Match.Chain. A comes first in the source.
+	A, B []*parser.MatchStmt
+	// Example is a document path both statements match. Each segment
+	// matched only by wildcards is written as the name of a wildcard.
+	Example string
+}
+
+// Overlaps returns each pair of match statements that hold allow statements
+// and whose full paths can both match the same document, so that both sets of
+// allow statements apply to it. A statement nested in another is not
+// reported as overlapping it.
+func Overlaps(rules *parser.Rules) []Overlap {
+	if rules == nil || rules.Service == nil {
+		return nil
+	}
+	version := Version(rules)
+	var blocks [][]*parser.MatchStmt
+	var collect func(stmts []parser.Stmt, chain []*parser.MatchStmt)
+	collect = func(stmts []parser.Stmt, chain []*parser.MatchStmt) {
+		for _, stmt := range stmts {
+			ms, ok := stmt.(*parser.MatchStmt)
+			if !ok {
+				continue
+			}
+			inner := append(append([]*parser.MatchStmt{}, chain...), ms)
+			if hasAllow(ms) {
+				blocks = append(blocks, inner)
+			}
+			collect(ms.Components, inner)
+		}
+	}
+	collect(rules.Service.Statements, nil)
+
+	var result []Overlap
+	for i, a := range blocks {
+		for _, b := range blocks[i+1:] {
+			if encloses(a, b) {
+				continue
+			}
+			if example, ok := intersect(pattern(a, version), pattern(b, version)); ok {
+				result = append(result, Overlap{A: a, B: b, Example: "/" + strings.Join(example, "/")})
+			}
+		}
+	}
+	return result
+}
+
+func hasAllow(ms *parser.MatchStmt) bool {
+	for _, stmt := range ms.Components {
+		if _, ok := stmt.(*parser.AllowStmt); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// encloses reports whether the statement at the end of outer encloses the one
+// at the end of inner.
+func encloses(outer, inner []*parser.MatchStmt) bool {
+	if len(outer) >= len(inner) {
+		return false
+	}
+	for k, ms := range outer {
+		if inner[k] != ms {
+			return false
+		}
+	}
+	return true
+}
+
+// element is a piece of a path pattern: a literal segment, a single wildcard
+// segment, or any number of segments.
+type element struct {
+	literal string
+	name    string
+	star    bool
+}
+
+// pattern returns the full path of the last statement of chain as a list of
+// elements. A version 1 recursive wildcard, which matches at least one
+// segment, becomes a single wildcard followed by a star.
+func pattern(chain []*parser.MatchStmt, version string) []element {
+	var result []element
+	for _, ms := range chain {
+		for _, c := range ms.Path {
+			name := c.Literal.Value
+			switch {
+			case c.Recursive:
+				if minRecursive(version) > 0 {
+					result = append(result, element{name: name})
+				}
+				result = append(result, element{name: name, star: true})
+			case c.Wildcard:
+				result = append(result, element{name: name})
+			default:
+				result = append(result, element{literal: name})
+			}
+		}
+	}
+	return result
+}
+
+// intersect reports whether some path matches both a and b, and returns one.
+func intersect(a, b []element) ([]string, bool) {
+	type state struct{ i, j int }
+	failed := map[state]bool{}
+	var search func(i, j int) ([]string, bool)
+	search = func(i, j int) ([]string, bool) {
+		if i == len(a) && j == len(b) {
+			return nil, true
+		}
+		if failed[state{i, j}] {
+			return nil, false
+		}
+		try := func(segment *string, i, j int) ([]string, bool) {
+			rest, ok := search(i, j)
+			if !ok || segment == nil {
+				return rest, ok
+			}
+			return append([]string{*segment}, rest...), true
+		}
+		switch {
+		case i < len(a) && a[i].star:
+			// The star of a either ends here, or takes the next element of
+			// b: another star ends, or a single segment is absorbed.
+			if rest, ok := try(nil, i+1, j); ok {
+				return rest, true
+			}
+			if j < len(b) {
+				var segment *string
+				if !b[j].star {
+					s := b[j].segment()
+					segment = &s
+				}
+				if rest, ok := try(segment, i, j+1); ok {
+					return rest, true
+				}
+			}
+		case j < len(b) && b[j].star:
+			if rest, ok := try(nil, i, j+1); ok {
+				return rest, true
+			}
+			if i < len(a) {
+				s := a[i].segment()
+				if rest, ok := try(&s, i+1, j); ok {
+					return rest, true
+				}
+			}
+		case i < len(a) && j < len(b):
+			x, y := a[i], b[j]
+			if x.literal == "" || y.literal == "" || x.literal == y.literal {
+				s := x.segment()
+				if y.literal != "" {
+					s = y.literal
+				}
+				if rest, ok := try(&s, i+1, j+1); ok {
+					return rest, true
+				}
+			}
+		}
+		failed[state{i, j}] = true
+		return nil, false
+	}
+	return search(0, 0)
+}
+
+// segment returns a segment of a document path that e matches.
+func (e element) segment() string {
+	if e.literal != "" {
+		return e.literal
+	}
+	return e.name
+}
@@ -0,0 +1,177 @@
+package pathmatch
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"firestore-rules/src/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func parse(t *testing.T, input string) *parser.Rules {
+	rules, err := parser.ParseRules(parser.New(input))
+	assert.Nil(t, err)
+	return rules
+}
+
+func parsePath(t *testing.T, input string) parser.Path {
+	path, err := parser.ParsePath(parser.New(input))
+	assert.Nil(t, err)
+	return path
+}
+
+// describe writes prefixes as "name=value ... | rest".
+func describe(prefixes []Prefix) []string {
+	result := []string{}
+	for _, p := range prefixes {
+		s := []string{}
+		for _, b := range p.Bindings {
+			s = append(s, b.Name+"="+b.Value)
+		}
+		result = append(result, strings.Join(s, " ")+" | "+strings.Join(p.Rest, "/"))
+	}
+	return result
+}
+
+func TestMatchPrefix(t *testing.T) {
+	tests := []struct {
+		path     string
+		doc      string
+		version  string
+		expected []string
+	}{
+		{"/users/{uid}", "/users/alice", "2", []string{"uid=alice | "}},
+		{"/users/{uid}", "/users/alice/posts/p", "2", []string{"uid=alice | posts/p"}},
+		{"/users/{uid}", "/users", "2", []string{}},
+		{"/users/{uid}", "/groups/a", "2", []string{}},
+		{"/users", "/users", "2", []string{" | "}},
+		{"/{a}/{b}", "/x/y", "1", []string{"a=x b=y | "}},
+		{"/docs/{rest=**}", "/docs/a/b", "2", []string{"rest=/ | a/b", "rest=/a | b", "rest=/a/b | "}},
+		{"/docs/{rest=**}", "/docs/a/b", "1", []string{"rest=/a | b", "rest=/a/b | "}},
+		{"/docs/{rest=**}", "/docs", "2", []string{"rest=/ | "}},
+		{"/docs/{rest=**}", "/docs", "1", []string{}},
+		{"/{rest=**}/{id}", "/a/b/c", "2", []string{"rest=/ id=a | b/c", "rest=/a id=b | c", "rest=/a/b id=c | "}},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s %s v%s", test.path, test.doc, test.version), func(t *testing.T) {
+			prefixes := MatchPrefix(parsePath(t, test.path), Segments(test.doc), test.version)
+			assert.Equal(t, test.expected, describe(prefixes))
+		})
+	}
+}
+
+const rules = `rules_version = '2';
+service cloud.firestore {
+  match /databases/{database}/documents {
+    match /users/{uid} {
+      allow read: if true;
+      match /posts/{post} {
+        allow read: if true;
+      }
+    }
+    match /users/{other} {
+      allow write: if true;
+    }
+    match /{collection}/{doc=**} {
+      allow read: if false;
+    }
+    match /groups/{gid} {
+      match /members/{mid} {
+        allow read: if true;
+      }
+    }
+    match /groups/admins {
+      allow read: if true;
+    }
+  }
+}
+`
+
+func TestFind(t *testing.T) {
+	r := parse(t, rules)
+	tests := []struct {
+		doc      string
+		expected []string
+	}{
+		{"/databases/(default)/documents/users/alice", []string{
+			"/users/{uid}: database=(default) uid=alice",
+			"/users/{other}: database=(default) other=alice",
+			"/{collection}/{doc=**}: database=(default) collection=users doc=/alice",
+		}},
+		{"/databases/db/documents/users/alice/posts/p1", []string{
+			"/posts/{post}: database=db uid=alice post=p1",
+			"/{collection}/{doc=**}: database=db collection=users doc=/alice/posts/p1",
+		}},
+		{"/databases/db/documents/groups", []string{
+			"/{collection}/{doc=**}: database=db collection=groups doc=/",
+		}},
+		{"/databases/db/documents/groups/g/members/m", []string{
+			"/{collection}/{doc=**}: database=db collection=groups doc=/g/members/m",
+			"/members/{mid}: database=db gid=g mid=m",
+		}},
+		{"/databases/db/documents", []string{"/databases/{database}/documents: database=db"}},
+		{"/other", []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.doc, func(t *testing.T) {
+			actual := []string{}
+			for _, m := range Find(r, test.doc) {
+				s := []string{}
+				for _, b := range m.Bindings {
+					s = append(s, b.Name+"="+b.Value)
+				}
+				actual = append(actual, m.Stmt().Path.String()+": "+strings.Join(s, " "))
+			}
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestFindVersion1(t *testing.T) {
+	src := strings.Replace(rules, "'2'", "'1'", 1)
+	matches := Find(parse(t, src), "/databases/db/documents/groups")
+	assert.Empty(t, matches)
+}
+
+func TestOverlaps(t *testing.T) {
+	actual := []string{}
+	for _, o := range Overlaps(parse(t, rules)) {
+		a, b := o.A[len(o.A)-1], o.B[len(o.B)-1]
+		actual = append(actual, fmt.Sprintf("%s (line %d) and %s (line %d): %s",
+			a.Path, a.Pos().Line+1, b.Path, b.Pos().Line+1, o.Example))
+	}
+	assert.Equal(t, []string{
+		"/users/{uid} (line 4) and /users/{other} (line 10): /databases/database/documents/users/uid",
+		"/users/{uid} (line 4) and /{collection}/{doc=**} (line 13): /databases/database/documents/users/uid",
+		"/posts/{post} (line 6) and /{collection}/{doc=**} (line 13): /databases/database/documents/users/uid/posts/post",
+		"/users/{other} (line 10) and /{collection}/{doc=**} (line 13): /databases/database/documents/users/other",
+		"/{collection}/{doc=**} (line 13) and /members/{mid} (line 17): /databases/database/documents/groups/gid/members/mid",
+		"/{collection}/{doc=**} (line 13) and /groups/admins (line 21): /databases/database/documents/groups/admins",
+	}, actual)
+}
+
+func TestIntersect(t *testing.T) {
+	lit := func(s string) element { return element{literal: s} }
+	one := func(s string) element { return element{name: s} }
+	star := func(s string) element { return element{name: s, star: true} }
+	tests := []struct {
+		a, b     []element
+		expected string
+		ok       bool
+	}{
+		{[]element{lit("a")}, []element{lit("a")}, "a", true},
+		{[]element{lit("a")}, []element{lit("b")}, "", false},
+		{[]element{lit("a"), one("x")}, []element{one("y"), lit("b")}, "a/b", true},
+		{[]element{star("r")}, []element{}, "", true},
+		{[]element{star("r")}, []element{lit("a"), lit("b")}, "a/b", true},
+		{[]element{star("r"), lit("z")}, []element{lit("a"), star("s")}, "a/z", true},
+		{[]element{lit("a"), lit("b")}, []element{lit("a")}, "", false},
+		{[]element{one("x"), star("r")}, []element{}, "", false},
+	}
+	for _, test := range tests {
+		example, ok := intersect(test.a, test.b)
+		assert.Equal(t, test.ok, ok, "%v %v", test.a, test.b)
+		assert.Equal(t, test.expected, strings.Join(example, "/"), "%v %v", test.a, test.b)
+	}
+}
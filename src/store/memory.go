@@ -0,0 +1,132 @@
+// Package store holds documents for the rules simulator to read with get()
+// and exists().
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"firestore-rules/src/eval"
+	"gopkg.in/yaml.v3"
+)
+
+// Memory is a DocumentStore that keeps its documents in memory.
+type Memory struct {
+	docs map[eval.Path]eval.Map
+}
+
+var _ eval.DocumentStore = (*Memory)(nil)
+
+// NewMemory returns an empty store.
+func NewMemory() *Memory {
+	return &Memory{docs: map[eval.Path]eval.Map{}}
+}
+
+// key returns the full path of the document at path, which may be relative to
+// the default database.
+func key(path string) eval.Path {
+	return eval.DocumentPath("", path)
+}
+
+// Get returns the data of the document at path.
+func (m *Memory) Get(path eval.Path) (eval.Map, bool) {
+	data, ok := m.docs[key(string(path))]
+	return data, ok
+}
+
+// Set stores data as the document at path. A path that does not start with
+// /databases/ is in the default database.
+func (m *Memory) Set(path string, data eval.Map) {
+	m.docs[key(path)] = data
+}
+
+// Delete removes the document at path.
+func (m *Memory) Delete(path string) {
+	delete(m.docs, key(path))
+}
+
+// Paths returns the full paths of every document, sorted.
+func (m *Memory) Paths() []eval.Path {
+	paths := make([]eval.Path, 0, len(m.docs))
+	for p := range m.docs {
+		paths = append(paths, p)
+	}
+	sort.Slice(paths, func(i, j int) bool { return paths[i] < paths[j] })
+	return paths
+}
+
+// Load stores the documents in fixtures, which maps document paths to their
+// data as decoded from JSON or YAML. Values are converted by
+// eval.FromNative.
+func (m *Memory) Load(fixtures map[string]interface{}) error {
+	paths := make([]string, 0, len(fixtures))
+	for path := range fixtures {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		raw := fixtures[path]
+		// A full document path is /databases/db/documents followed by pairs
+		// of collection and document ids.
+		if n := len(key(path).Segments()); n < 5 || n%2 == 0 {
+			return fmt.Errorf("%s is not a document path", path)
+		}
+		v, err := eval.FromNative(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		data, ok := v.(eval.Map)
+		if !ok {
+			return fmt.Errorf("%s: document is %s, not map", path, eval.TypeName(v))
+		}
+		m.Set(path, data)
+	}
+	return nil
+}
+
+// Decode decodes fixtures written in JSON or, if yamlFormat is set, YAML. The
+// result can be passed to Load.
+func Decode(src []byte, yamlFormat bool) (map[string]interface{}, error) {
+	fixtures := map[string]interface{}{}
+	if yamlFormat {
+		if err := yaml.Unmarshal(src, &fixtures); err != nil {
+			return nil, err
+		}
+		return fixtures, nil
+	}
+	d := json.NewDecoder(bytes.NewReader(src))
+	d.UseNumber()
+	if err := d.Decode(&fixtures); err != nil {
+		return nil, err
+	}
+	return fixtures, nil
+}
+
+// IsYAML reports whether the file name has a YAML extension.
+func IsYAML(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// LoadFile returns a store holding the documents in the named JSON or YAML
+// fixture file. The format is chosen by the file's extension.
+func LoadFile(name string) (*Memory, error) {
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	fixtures, err := Decode(src, IsYAML(name))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	m := NewMemory()
+	if err := m.Load(fixtures); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"testing"
+
+	"firestore-rules/src/eval"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadFile(t *testing.T) {
+	for _, name := range []string{"testdata/docs.yaml", "testdata/docs.json"} {
+		t.Run(name, func(t *testing.T) {
+			m, err := LoadFile(name)
+			assert.Nil(t, err)
+			assert.Equal(t, []eval.Path{
+				"/databases/(default)/documents/users/alice",
+				"/databases/(default)/documents/users/bob",
+			}, m.Paths())
+			alice, ok := m.Get("/databases/(default)/documents/users/alice")
+			assert.True(t, ok)
+			assert.Equal(t, "{'admin': true, 'age': 30, 'height': 1.7, 'joined': timestamp('2020-09-13T12:26:40Z'), 'name': 'Alice', 'tags': ['a', 'b']}",
+				eval.Format(alice))
+			bob, ok := m.Get("/users/bob")
+			assert.True(t, ok)
+			assert.Equal(t, eval.LatLng{Lat: 51.5, Lng: -0.1}, bob["home"])
+			_, ok = m.Get("/users/carol")
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"/users": {}}`, "/users is not a document path"},
+		{`{"/users/a/posts": {}}`, "/users/a/posts is not a document path"},
+		{`{"/users/a": 1}`, "/users/a: document is int, not map"},
+		{`{"/users/a": {"t": {"$timestamp": "yesterday"}}}`, `/users/a: t: parsing time "yesterday" as "2006-01-02T15:04:05.999999999Z07:00": cannot parse "yesterday" as "2006"`},
+		{`{"/users/a": {"x": {"$nope": 1}}}`, "/users/a: x: unknown type $nope"},
+	}
+	for _, test := range tests {
+		fixtures, err := Decode([]byte(test.input), false)
+		assert.Nil(t, err)
+		err = NewMemory().Load(fixtures)
+		if assert.NotNil(t, err, test.input) {
+			assert.Equal(t, test.expected, err.Error())
+		}
+	}
+}
+
+func TestSetDelete(t *testing.T) {
+	m := NewMemory()
+	m.Set("/users/a", eval.Map{"x": int64(1)})
+	data, ok := m.Get("/databases/(default)/documents/users/a")
+	assert.True(t, ok)
+	assert.Equal(t, eval.Map{"x": int64(1)}, data)
+	m.Delete("/databases/(default)/documents/users/a")
+	_, ok = m.Get("/users/a")
+	assert.False(t, ok)
+	assert.True(t, IsYAML("a.YML"))
+	assert.False(t, IsYAML("a.json"))
+}
@@ -0,0 +1,112 @@
+package suite
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Report is the results of running a suite, for JUnit output.
+type Report struct {
+	// Name names the suite, usually by its file name.
+	Name    string
+	Results []Result
+	// Source is the source of the rules, used to render decision traces.
+	Source string
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Tests   int          `xml:"tests,attr"`
+	Fail    int          `xml:"failures,attr"`
+	Errors  int          `xml:"errors,attr"`
+	Time    string       `xml:"time,attr"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name   string      `xml:"name,attr"`
+	Tests  int         `xml:"tests,attr"`
+	Fail   int         `xml:"failures,attr"`
+	Errors int         `xml:"errors,attr"`
+	Time   string      `xml:"time,attr"`
+	Cases  []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure"`
+	Error     *junitProblem `xml:"error"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes reports to w as a JUnit XML document, with a testsuite
+// element for each report. A case that failed has a failure element holding
+// the traces of its decisions; one that could not be run has an error
+// element.
+func WriteJUnit(w io.Writer, reports []Report) error {
+	var doc junitSuites
+	var total time.Duration
+	for _, report := range reports {
+		s := junitSuite{Name: report.Name, Tests: len(report.Results)}
+		var elapsed time.Duration
+		for _, r := range report.Results {
+			c := junitCase{Name: r.Name, ClassName: report.Name, Time: seconds(r.Time)}
+			switch {
+			case r.Err != nil:
+				c.Error = &junitProblem{Message: r.Err.Error()}
+				s.Errors++
+			case !r.Passed():
+				c.Failure = &junitProblem{
+					Message: strings.Join(r.Failures, "; "),
+					Text:    Traces(r, report.Source),
+				}
+				s.Fail++
+			}
+			elapsed += r.Time
+			s.Cases = append(s.Cases, c)
+		}
+		s.Time = seconds(elapsed)
+		doc.Tests += s.Tests
+		doc.Fail += s.Fail
+		doc.Errors += s.Errors
+		total += elapsed
+		doc.Suites = append(doc.Suites, s)
+	}
+	doc.Time = seconds(total)
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	if err := e.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Traces renders the traces of the decisions of r against the rules source
+// src, one after another.
+func Traces(r Result, src string) string {
+	var b strings.Builder
+	for _, d := range r.Decisions {
+		if d.Trace == nil {
+			continue
+		}
+		b.WriteString(d.Trace.Text(src))
+	}
+	return b.String()
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,155 @@
+package suite
+
+import (
+	"fmt"
+	"time"
+
+	"firestore-rules/src/eval"
+	"firestore-rules/src/parser"
+	"firestore-rules/src/store"
+)
+
+// Result is the outcome of running a Case.
+type Result struct {
+	Name string
+	// Err is set if the case could not be run because it is malformed.
+	Err error
+	// Failures describes each decision that was not the one expected. The
+	// case passed if there are none and Err is nil.
+	Failures []string
+	// Decisions holds the decision on the request, or on each operation of a
+	// batch, with its trace.
+	Decisions []eval.Decision
+	Time      time.Duration
+}
+
+// Passed reports whether the case ran and every decision was as expected.
+func (r Result) Passed() bool {
+	return r.Err == nil && len(r.Failures) == 0
+}
+
+// Run runs every case of s against rules, in order.
+func Run(rules *parser.Rules, s *Suite) []Result {
+	results := make([]Result, len(s.Tests))
+	for k := range s.Tests {
+		c := &s.Tests[k]
+		start := time.Now()
+		results[k] = run(rules, s, c)
+		results[k].Time = time.Since(start)
+		if results[k].Name = c.Name; c.Name == "" {
+			results[k].Name = fmt.Sprintf("case %d", k+1)
+		}
+	}
+	return results
+}
+
+func run(rules *parser.Rules, s *Suite, c *Case) Result {
+	if err := checkExpect(c.Expect, false); err != nil {
+		return Result{Err: err}
+	}
+	docs := store.NewMemory()
+	if err := docs.Load(s.Documents); err != nil {
+		return Result{Err: fmt.Errorf("suite documents: %v", err)}
+	}
+	if err := docs.Load(c.Documents); err != nil {
+		return Result{Err: fmt.Errorf("documents: %v", err)}
+	}
+	auth, err := optionalMap(c.Auth, "auth")
+	if err != nil {
+		return Result{Err: err}
+	}
+	t, err := requestTime(c.Time)
+	if err != nil {
+		return Result{Err: err}
+	}
+
+	if len(c.Batch) > 0 {
+		ops, err := c.operations()
+		if err != nil {
+			return Result{Err: err}
+		}
+		d := eval.EvaluateBatchTrace(rules, eval.Batch{
+			Database:   c.Database,
+			Auth:       auth,
+			Time:       t,
+			Store:      docs,
+			Operations: ops,
+		})
+		r := Result{Decisions: d.Decisions}
+		if actual := decision(d.Committed); actual != c.Expect {
+			r.Failures = append(r.Failures, fmt.Sprintf("expected the batch to %s, got %s", c.Expect, actual))
+		}
+		for k, op := range c.Batch {
+			if actual := d.Decisions[k].String(); op.Expect != "" && actual != op.Expect {
+				r.Failures = append(r.Failures, fmt.Sprintf("operation %d: expected %s, got %s", k+1, op.Expect, actual))
+			}
+		}
+		return r
+	}
+
+	req := eval.Request{
+		Method:   eval.Method(c.Method),
+		Path:     c.Path,
+		Database: c.Database,
+		Auth:     auth,
+		Time:     t,
+		Store:    docs,
+	}
+	if !req.Method.Valid() {
+		return Result{Err: fmt.Errorf("unknown method %q", c.Method)}
+	}
+	if c.Path == "" {
+		return Result{Err: fmt.Errorf("no path")}
+	}
+	if req.Data, err = optionalMap(c.Data, "data"); err != nil {
+		return Result{Err: err}
+	}
+	if req.Query, err = optionalMap(c.Query, "query"); err != nil {
+		return Result{Err: err}
+	}
+	if c.Existing != nil {
+		if req.Existing, err = optionalMap(c.Existing, "existing"); err != nil {
+			return Result{Err: err}
+		}
+	} else {
+		req.Existing, _ = docs.Get(eval.DocumentPath(c.Database, c.Path))
+	}
+	d := eval.EvaluateTrace(rules, req)
+	r := Result{Decisions: []eval.Decision{d}}
+	if actual := d.String(); actual != c.Expect {
+		r.Failures = append(r.Failures, fmt.Sprintf("expected %s, got %s", c.Expect, actual))
+	}
+	return r
+}
+
+// decision names the decision on a batch as in a case's expect.
+func decision(committed bool) string {
+	if committed {
+		return "allow"
+	}
+	return "deny"
+}
+
+// requestTime converts the time of a case. A missing time is zero, which the
+// simulator takes to be the current time.
+func requestTime(v interface{}) (time.Time, error) {
+	if v == nil {
+		return time.Time{}, nil
+	}
+	if s, ok := v.(string); ok {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("time: %v", err)
+		}
+		return t, nil
+	}
+	value, err := eval.FromNative(v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("time: %v", err)
+	}
+	t, ok := value.(time.Time)
+	if !ok {
+		return time.Time{}, fmt.Errorf("time is %s, not timestamp", eval.TypeName(value))
+	}
+	return t, nil
+}
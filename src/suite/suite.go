@@ -0,0 +1,182 @@
+// Package suite reads rules test suites and runs them with the simulator.
+//
+// A suite is a JSON or YAML file naming a rules file and listing test cases.
+// Each case describes a request and whether the rules should allow it:
+//
+//	rules: firestore.rules
+//	documents:
+//	  /users/alice: {name: Alice}
+//	tests:
+//	  - name: owner reads their profile
+//	    auth: {uid: alice}
+//	    method: get
+//	    path: /users/alice
+//	    expect: allow
+//	  - name: a room and its first member are created together
+//	    auth: {uid: alice}
+//	    batch:
+//	      - {method: create, path: /rooms/r1, data: {owner: alice}}
+//	      - {method: create, path: /members/alice_r1, data: {room: r1}}
+//	    expect: allow
+//
+// Documents, data and auth are written as in the fixtures read by the store
+// package, so {$timestamp: ...} and the other special forms of
+// eval.FromNative can be used in them.
+package suite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"firestore-rules/src/eval"
+	"firestore-rules/src/store"
+	"gopkg.in/yaml.v3"
+)
+
+// Suite is a list of test cases for a rules file.
+type Suite struct {
+	// Rules is the name of the rules file. A relative name is relative to
+	// the directory of the suite file.
+	Rules string `json:"rules" yaml:"rules"`
+	// Documents are stored in the database for every case.
+	Documents map[string]interface{} `json:"documents" yaml:"documents"`
+	Tests     []Case                 `json:"tests" yaml:"tests"`
+}
+
+// Case is a request, or a batch of them, and the expected decision.
+type Case struct {
+	Name string `json:"name" yaml:"name"`
+	// Method and Path are those of a single request. They are not used
+	// with Batch.
+	Method string `json:"method" yaml:"method"`
+	Path   string `json:"path" yaml:"path"`
+	// Database is the database of the request; it is (default) if empty.
+	Database string `json:"database" yaml:"database"`
+	// Auth is request.auth; a case without it is unauthenticated.
+	Auth interface{} `json:"auth" yaml:"auth"`
+	// Data is request.resource.data for a create or update.
+	Data interface{} `json:"data" yaml:"data"`
+	// Existing is resource.data. If it is missing it is the document at
+	// Path among the documents of the suite and the case.
+	Existing interface{} `json:"existing" yaml:"existing"`
+	// Query is request.query for a list request.
+	Query interface{} `json:"query" yaml:"query"`
+	// Time is request.time, as an RFC 3339 string or a $timestamp. It is
+	// the current time if missing.
+	Time interface{} `json:"time" yaml:"time"`
+	// Documents are stored in the database for this case, in addition to
+	// those of the suite.
+	Documents map[string]interface{} `json:"documents" yaml:"documents"`
+	// Batch lists the operations of a batched write or transaction.
+	Batch []Operation `json:"batch" yaml:"batch"`
+	// Expect is "allow" or "deny". For a batch, allow means that the batch
+	// commits.
+	Expect string `json:"expect" yaml:"expect"`
+}
+
+// Operation is one operation of a batch.
+type Operation struct {
+	Method string      `json:"method" yaml:"method"`
+	Path   string      `json:"path" yaml:"path"`
+	Data   interface{} `json:"data" yaml:"data"`
+	// Expect is "allow" or "deny", or empty if only the decision on the
+	// whole batch is checked.
+	Expect string `json:"expect" yaml:"expect"`
+}
+
+// Decode decodes a suite written in JSON or, if yamlFormat is set, YAML.
+func Decode(src []byte, yamlFormat bool) (*Suite, error) {
+	var s Suite
+	if yamlFormat {
+		d := yaml.NewDecoder(bytes.NewReader(src))
+		d.KnownFields(true)
+		if err := d.Decode(&s); err != nil {
+			return nil, err
+		}
+		return &s, nil
+	}
+	d := json.NewDecoder(bytes.NewReader(src))
+	d.UseNumber()
+	d.DisallowUnknownFields()
+	if err := d.Decode(&s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// LoadFile reads the named suite. The format is chosen by the file's
+// extension, and the name of the rules file is made relative to the current
+// directory.
+func LoadFile(name string) (*Suite, error) {
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Decode(src, store.IsYAML(name))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if s.Rules != "" && !filepath.IsAbs(s.Rules) {
+		s.Rules = filepath.Join(filepath.Dir(name), s.Rules)
+	}
+	return s, nil
+}
+
+// operations returns the operations of the batch of c.
+func (c *Case) operations() ([]eval.Operation, error) {
+	if c.Method != "" || c.Path != "" || c.Data != nil || c.Existing != nil || c.Query != nil {
+		return nil, fmt.Errorf("a batch case cannot have a method, path, data, existing document or query")
+	}
+	var result []eval.Operation
+	for k, op := range c.Batch {
+		method := eval.Method(op.Method)
+		if !method.Valid() {
+			return nil, fmt.Errorf("operation %d: unknown method %q", k+1, op.Method)
+		}
+		if op.Path == "" {
+			return nil, fmt.Errorf("operation %d: no path", k+1)
+		}
+		data, err := optionalMap(op.Data, "data")
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %v", k+1, err)
+		}
+		if err := checkExpect(op.Expect, true); err != nil {
+			return nil, fmt.Errorf("operation %d: %v", k+1, err)
+		}
+		result = append(result, eval.Operation{Method: method, Path: op.Path, Data: data})
+	}
+	return result, nil
+}
+
+// checkExpect returns an error unless expect is allow or deny, or empty and
+// optional.
+func checkExpect(expect string, optional bool) error {
+	switch {
+	case expect == "allow" || expect == "deny":
+		return nil
+	case expect == "" && optional:
+		return nil
+	case expect == "":
+		return fmt.Errorf("no expect: want allow or deny")
+	}
+	return fmt.Errorf("expect is %q, want allow or deny", expect)
+}
+
+// optionalMap converts v, which is missing if it is nil, to a Map.
+func optionalMap(v interface{}, name string) (eval.Map, error) {
+	if v == nil {
+		return nil, nil
+	}
+	value, err := eval.FromNative(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	m, ok := value.(eval.Map)
+	if !ok {
+		return nil, fmt.Errorf("%s is %s, not map", name, eval.TypeName(value))
+	}
+	return m, nil
+}
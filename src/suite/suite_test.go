@@ -0,0 +1,111 @@
+package suite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"firestore-rules/src/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func load(t *testing.T, name string) (*Suite, *parser.Rules, string) {
+	s, err := LoadFile(name)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	src, err := ioutil.ReadFile(s.Rules)
+	assert.Nil(t, err)
+	rules, err := parser.ParseRules(parser.New(string(src)))
+	assert.Nil(t, err)
+	return s, rules, string(src)
+}
+
+func TestRunTestdata(t *testing.T) {
+	s, rules, _ := load(t, "../../testdata/firestore.test.yaml")
+	for _, r := range Run(rules, s) {
+		assert.True(t, r.Passed(), "%s: %v %v", r.Name, r.Err, r.Failures)
+	}
+}
+
+func TestRun(t *testing.T) {
+	s, rules, _ := load(t, "testdata/rooms.json")
+	assert.Equal(t, "testdata/rooms.rules", s.Rules)
+	actual := []string{}
+	for _, r := range Run(rules, s) {
+		line := r.Name + ": "
+		switch {
+		case r.Err != nil:
+			line += "error: " + r.Err.Error()
+		case r.Passed():
+			line += "pass"
+		default:
+			line += strings.Join(r.Failures, "; ")
+		}
+		actual = append(actual, line)
+	}
+	assert.Equal(t, []string{
+		"read: pass",
+		"create for someone else: expected allow, got deny",
+		"delete: pass",
+		"existing overrides the documents: pass",
+		"batch: expected the batch to allow, got deny; operation 2: expected allow, got deny",
+		`bad method: error: unknown method "write"`,
+	}, actual)
+}
+
+func TestCaseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"{method: get, path: /a/b}", "no expect: want allow or deny"},
+		{"{method: get, path: /a/b, expect: yes}", `expect is "yes", want allow or deny`},
+		{"{method: get, expect: allow}", "no path"},
+		{"{method: get, path: /a/b, auth: 1, expect: allow}", "auth is int, not map"},
+		{"{method: get, path: /a/b, time: yesterday, expect: allow}", `time: parsing time "yesterday" as "2006-01-02T15:04:05.999999999Z07:00": cannot parse "yesterday" as "2006"`},
+		{"{method: get, path: /a/b, time: 1, expect: allow}", "time is int, not timestamp"},
+		{"{method: create, path: /a/b, data: {x: {$when: 1}}, expect: allow}", "data: x: unknown type $when"},
+		{"{method: get, path: /a/b, documents: {/a: {}}, expect: allow}", "documents: /a is not a document path"},
+		{"{path: /a/b, batch: [{method: get, path: /a/b}], expect: allow}", "a batch case cannot have a method, path, data, existing document or query"},
+		{"{batch: [{method: get}], expect: allow}", "operation 1: no path"},
+		{"{batch: [{method: get, path: /a/b, expect: no}], expect: allow}", `operation 1: expect is "no", want allow or deny`},
+	}
+	for _, test := range tests {
+		s, err := Decode([]byte("tests: ["+test.input+"]"), true)
+		if !assert.Nil(t, err, test.input) {
+			continue
+		}
+		r := Run(nil, s)[0]
+		if assert.NotNil(t, r.Err, test.input) {
+			assert.Equal(t, test.expected, r.Err.Error(), test.input)
+		}
+	}
+}
+
+func TestDecodeUnknownField(t *testing.T) {
+	_, err := Decode([]byte(`{"tests": [{"expected": "allow"}]}`), false)
+	assert.NotNil(t, err)
+	_, err = Decode([]byte("tests: [{expected: allow}]"), true)
+	assert.NotNil(t, err)
+}
+
+func TestWriteJUnit(t *testing.T) {
+	s, rules, src := load(t, "testdata/rooms.json")
+	results := Run(rules, s)
+	for k := range results {
+		results[k].Time = 0
+	}
+	var b bytes.Buffer
+	assert.Nil(t, WriteJUnit(&b, []Report{{Name: "rooms.json", Results: results, Source: src}}))
+	out := b.String()
+	assert.True(t, strings.HasPrefix(out, `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="6" failures="2" errors="1" time="0.000">
+  <testsuite name="rooms.json" tests="6" failures="2" errors="1" time="0.000">
+    <testcase name="read" classname="rooms.json" time="0.000"></testcase>
+    <testcase name="create for someone else" classname="rooms.json" time="0.000">
+      <failure message="expected allow, got deny">deny create /databases/(default)/documents/rooms/r2&#xA;`), out)
+	assert.Contains(t, out, `<error message="unknown method &#34;write&#34;"></error>`)
+	assert.Contains(t, out, "request.resource.data.owner == request.auth.uid")
+}
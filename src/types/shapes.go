@@ -0,0 +1,59 @@
+package types
+
+// Resource is the type of resource, request.resource and the result of get()
+// and getAfter(): a document with its id, full path and data.
+var Resource = DocumentOf(MapOf(AnyType))
+
+// DocumentOf returns the type of a document whose data has type data.
+func DocumentOf(data *Type) *Type {
+	return Record(map[string]*Type{
+		"data":     data,
+		"id":       StringType,
+		"__name__": PathType,
+	})
+}
+
+// Token is the type of request.auth.token, the claims of the Firebase
+// Authentication token. Custom claims may add any other key.
+var Token = &Type{
+	Kind: Map,
+	Elem: AnyType,
+	Fields: map[string]*Type{
+		"email":          StringType,
+		"email_verified": BoolType,
+		"phone_number":   StringType,
+		"name":           StringType,
+		"sub":            StringType,
+		"firebase": Record(map[string]*Type{
+			"identities":       MapOf(AnyType),
+			"sign_in_provider": StringType,
+			"tenant":           StringType,
+		}),
+	},
+}
+
+// Auth is the type of request.auth. It is null when the user is not signed in.
+var Auth = Record(map[string]*Type{
+	"uid":   StringType,
+	"token": Token,
+})
+
+// Request is the type of request.
+var Request = RequestOf(Resource)
+
+// RequestOf returns the type of request for a write of a document of type
+// doc.
+func RequestOf(doc *Type) *Type {
+	return Record(map[string]*Type{
+		"auth":     Auth,
+		"method":   StringType,
+		"path":     PathType,
+		"resource": doc,
+		"time":     TimeType,
+		"query": Record(map[string]*Type{
+			"limit":   IntType,
+			"offset":  AnyType,
+			"orderBy": AnyType,
+		}),
+	})
+}
@@ -0,0 +1,311 @@
+// Package types describes the values of the Firestore rules language.
+package types
+
+import (
+	"sort"
+	"strings"
+)
+
+// Kind is the basic sort of a Type.
+type Kind int
+
+const (
+	// Invalid is the type of an expression that has already been reported as
+	// wrong. It is compatible with everything so that one mistake produces
+	// one error.
+	Invalid Kind = iota
+	// Any is the type of a value that cannot be known statically, such as a
+	// field of request.resource.data.
+	Any
+	Null
+	Bool
+	Int
+	Float
+	String
+	Bytes
+	Path
+	Timestamp
+	Duration
+	LatLng
+	List
+	Set
+	Map
+	// MapDiff is the result of map.diff(), which describes how two maps
+	// differ.
+	MapDiff
+	// Namespace is the type of a name such as math or hashing that only
+	// serves to qualify functions.
+	Namespace
+	// TypeName is the type of a name such as string or int that names a type
+	// in an 'is' expression.
+	TypeName
+	// Function is the type of the name of a function, which can only be
+	// called.
+	Function
+)
+
+var kindNames = [...]string{
+	Invalid:   "invalid type",
+	Any:       "any",
+	Null:      "null",
+	Bool:      "bool",
+	Int:       "int",
+	Float:     "float",
+	String:    "string",
+	Bytes:     "bytes",
+	Path:      "path",
+	Timestamp: "timestamp",
+	Duration:  "duration",
+	LatLng:    "latlng",
+	List:      "list",
+	Set:       "set",
+	Map:       "map",
+	MapDiff:   "map_diff",
+	Namespace: "namespace",
+	TypeName:  "type",
+	Function:  "function",
+}
+
+func (k Kind) String() string {
+	if k >= 0 && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "unknown"
+}
+
+// Type is the static type of an expression.
+type Type struct {
+	Kind Kind
+	// Elem is the element type of a List or Set, and the type of the values
+	// of a Map that are not listed in Fields. A Map with a nil Elem has only
+	// the keys in Fields.
+	Elem *Type
+	// Fields are the keys known to be in a Map and the types of their values.
+	Fields map[string]*Type
+	// Name is the name of a Namespace, TypeName or Function.
+	Name string
+}
+
+// The types with no parameters.
+var (
+	InvalidType = &Type{Kind: Invalid}
+	AnyType     = &Type{Kind: Any}
+	NullType    = &Type{Kind: Null}
+	BoolType    = &Type{Kind: Bool}
+	IntType     = &Type{Kind: Int}
+	FloatType   = &Type{Kind: Float}
+	StringType  = &Type{Kind: String}
+	BytesType   = &Type{Kind: Bytes}
+	PathType    = &Type{Kind: Path}
+	TimeType    = &Type{Kind: Timestamp}
+	DurType     = &Type{Kind: Duration}
+	LatLngType  = &Type{Kind: LatLng}
+	MapDiffType = &Type{Kind: MapDiff}
+)
+
+// ListOf returns the type of a list with elements of type elem.
+func ListOf(elem *Type) *Type {
+	return &Type{Kind: List, Elem: elem}
+}
+
+// SetOf returns the type of a set with elements of type elem.
+func SetOf(elem *Type) *Type {
+	return &Type{Kind: Set, Elem: elem}
+}
+
+// MapOf returns the type of a map whose values all have type elem.
+func MapOf(elem *Type) *Type {
+	return &Type{Kind: Map, Elem: elem}
+}
+
+// Record returns the type of a map with exactly the given keys.
+func Record(fields map[string]*Type) *Type {
+	return &Type{Kind: Map, Fields: fields}
+}
+
+// NamespaceOf returns the type of the namespace with the given name.
+func NamespaceOf(name string) *Type {
+	return &Type{Kind: Namespace, Name: name}
+}
+
+// TypeNameOf returns the type of a name used with 'is'.
+func TypeNameOf(name string) *Type {
+	return &Type{Kind: TypeName, Name: name}
+}
+
+// FunctionOf returns the type of the name of a function.
+func FunctionOf(name string) *Type {
+	return &Type{Kind: Function, Name: name}
+}
+
+func (t *Type) String() string {
+	switch t.Kind {
+	case List, Set:
+		if t.Elem == nil || t.Elem.Kind == Any {
+			return t.Kind.String()
+		}
+		return t.Kind.String() + "<" + t.Elem.String() + ">"
+	case Map:
+		if len(t.Fields) > 0 {
+			keys := make([]string, 0, len(t.Fields))
+			for k := range t.Fields {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return "map{" + strings.Join(keys, ", ") + "}"
+		}
+		if t.Elem == nil || t.Elem.Kind == Any {
+			return "map"
+		}
+		return "map<string, " + t.Elem.String() + ">"
+	case Namespace, TypeName:
+		return t.Name
+	case Function:
+		return "function " + t.Name
+	default:
+		return t.Kind.String()
+	}
+}
+
+// Unknown reports whether t says nothing about the value, either because it
+// cannot be known or because it is already wrong.
+func (t *Type) Unknown() bool {
+	return t.Kind == Any || t.Kind == Invalid
+}
+
+// Numeric reports whether t is int or float.
+func (t *Type) Numeric() bool {
+	return t.Kind == Int || t.Kind == Float
+}
+
+// Field returns the type of the value at key in a Map. The result is nil if
+// the map cannot have that key.
+func (t *Type) Field(key string) *Type {
+	if f, ok := t.Fields[key]; ok {
+		return f
+	}
+	return t.Elem
+}
+
+// Unify returns the type that covers both a and b: their common type if they
+// agree, float for an int and a float, and any otherwise.
+func Unify(a, b *Type) *Type {
+	switch {
+	case a.Kind == Invalid:
+		return b
+	case b.Kind == Invalid:
+		return a
+	case a.Kind != b.Kind:
+		if a.Numeric() && b.Numeric() {
+			return FloatType
+		}
+		return AnyType
+	case a.Kind == List || a.Kind == Set:
+		return &Type{Kind: a.Kind, Elem: Unify(elem(a), elem(b))}
+	case a.Kind == Map:
+		if a == b {
+			return a
+		}
+		return MapOf(AnyType)
+	default:
+		return a
+	}
+}
+
+func elem(t *Type) *Type {
+	if t.Elem == nil {
+		return AnyType
+	}
+	return t.Elem
+}
+
+// Comparable reports whether values of types a and b can ever be equal, so
+// that comparing them with == or != makes sense.
+func Comparable(a, b *Type) bool {
+	switch {
+	case a.Unknown() || b.Unknown():
+		return true
+	case a.Kind == Null || b.Kind == Null:
+		return true
+	case a.Numeric() && b.Numeric():
+		return true
+	default:
+		return a.Kind == b.Kind
+	}
+}
+
+// Ordered reports whether values of types a and b can be compared with <, <=,
+// > and >=.
+func Ordered(a, b *Type) bool {
+	switch {
+	case a.Unknown() || b.Unknown():
+		return true
+	case a.Numeric() && b.Numeric():
+		return true
+	case a.Kind != b.Kind:
+		return false
+	default:
+		switch a.Kind {
+		case String, Bytes, Timestamp, Duration:
+			return true
+		}
+		return false
+	}
+}
+
+// Is reports whether a value of type t may satisfy 'is name', where name is
+// the name of a type.
+func Is(t *Type, name string) bool {
+	if t.Unknown() {
+		return true
+	}
+	if name == "number" {
+		return t.Numeric()
+	}
+	return t.Kind.String() == name
+}
+
+// typeNames are the names that may appear on the right of 'is'.
+var typeNames = []string{
+	"bool", "bytes", "duration", "float", "int", "latlng", "list", "map", "number",
+	"path", "set", "string", "timestamp",
+}
+
+// TypeNames returns the names that may appear on the right of 'is', sorted.
+func TypeNames() []string {
+	return append([]string(nil), typeNames...)
+}
+
+// IsTypeName reports whether name may appear on the right of 'is'.
+func IsTypeName(name string) bool {
+	for _, n := range typeNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Named returns the type of the values that satisfy 'is name', or nil if name
+// is not a type name. The elements of lists, sets and maps may have any type,
+// and a number is any value, since it may be an int or a float.
+func Named(name string) *Type {
+	if !IsTypeName(name) {
+		return nil
+	}
+	if name == "number" {
+		return AnyType
+	}
+	for k, n := range kindNames {
+		if n != name {
+			continue
+		}
+		switch kind := Kind(k); kind {
+		case List, Set, Map:
+			return &Type{Kind: kind, Elem: AnyType}
+		default:
+			return &Type{Kind: kind}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestString(t *testing.T) {
+	assert.Equal(t, "list<string>", ListOf(StringType).String())
+	assert.Equal(t, "list", ListOf(AnyType).String())
+	assert.Equal(t, "set<int>", SetOf(IntType).String())
+	assert.Equal(t, "map", MapOf(AnyType).String())
+	assert.Equal(t, "map<string, bool>", MapOf(BoolType).String())
+	assert.Equal(t, "map{token, uid}", Auth.String())
+	assert.Equal(t, "math", NamespaceOf("math").String())
+}
+
+func TestUnify(t *testing.T) {
+	assert.Equal(t, IntType, Unify(IntType, IntType))
+	assert.Equal(t, FloatType, Unify(IntType, FloatType))
+	assert.Equal(t, AnyType, Unify(IntType, StringType))
+	assert.Equal(t, StringType, Unify(InvalidType, StringType))
+	assert.Equal(t, "list<float>", Unify(ListOf(IntType), ListOf(FloatType)).String())
+}
+
+func TestComparisons(t *testing.T) {
+	assert.True(t, Comparable(IntType, FloatType))
+	assert.True(t, Comparable(Auth, NullType))
+	assert.True(t, Comparable(AnyType, StringType))
+	assert.False(t, Comparable(StringType, IntType))
+
+	assert.True(t, Ordered(StringType, StringType))
+	assert.True(t, Ordered(TimeType, TimeType))
+	assert.False(t, Ordered(TimeType, IntType))
+	assert.False(t, Ordered(BoolType, BoolType))
+
+	assert.True(t, Is(IntType, "number"))
+	assert.True(t, Is(AnyType, "string"))
+	assert.False(t, Is(StringType, "int"))
+}
+
+func TestField(t *testing.T) {
+	assert.Equal(t, StringType, Auth.Field("uid"))
+	assert.Nil(t, Auth.Field("nope"))
+	assert.Equal(t, AnyType, Token.Field("custom"))
+}
+
+func TestNamed(t *testing.T) {
+	assert.Equal(t, StringType, Named("string"))
+	assert.Equal(t, TimeType, Named("timestamp"))
+	assert.Equal(t, ListOf(AnyType), Named("list"))
+	assert.Equal(t, MapOf(AnyType), Named("map"))
+	assert.Equal(t, AnyType, Named("number"))
+	assert.Nil(t, Named("Issue"))
+
+	issue := Record(map[string]*Type{"title": StringType})
+	assert.Equal(t, StringType, RequestOf(DocumentOf(issue)).Field("resource").Field("data").Field("title"))
+}